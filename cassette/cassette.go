@@ -2,14 +2,19 @@ package cassette
 
 import (
 	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -29,10 +34,45 @@ type Cassette struct {
 	name            string
 	trackSliceMutex sync.RWMutex
 	tracksLoaded    int32
+	tracksRecorded  int32
+	// existed indicates whether the cassette was present in the store at the time it was loaded.
+	existed bool
 	// crypter provides an encryption abstraction for cassette read/write operations.
 	crypter Crypter
+	// logicalName is the name that the encrypted cassette data is bound to, if any.
+	logicalName string
+	// acceptUnbound permits to load the encrypted data that is not bound to a logical name,
+	// in order to bind it to logicalName when it is next saved.
+	acceptUnbound bool
+	// streamChunkSize is the size of the plaintext chunks of a cassette that is saved as a
+	// stream, or zero when the cassette is saved whole.
+	streamChunkSize int
+	// fieldCrypter encrypts the fields of the tracks that are selected by fields.
+	fieldCrypter Crypter
+	fields       FieldSelection
+	// sealedFields holds the encrypted values of the fields, by location (see fieldLocation).
+	sealedFields      map[string]sealedField
+	sealedFieldsMutex sync.Mutex
+	// signer signs the cassette files such that their alterations are detected, if any.
+	signer Signer
 	// store provides a storage backend abstraction: file system, cloud storage, etc
 	store FileIO
+
+	// deferredSave indicates that new tracks are kept in memory until the cassette is flushed.
+	deferredSave atomic.Bool
+	// dirty indicates that the cassette holds tracks that have not been persisted yet.
+	dirty atomic.Bool
+	// flushInterval is the period at which a cassette with deferred persistence is flushed.
+	flushInterval time.Duration
+	stopFlush     chan struct{}
+	ejectOnce     sync.Once
+
+	// appendable indicates that the cassette in storage is known to be in sync with the
+	// cassette in memory, such that new tracks can be appended to it (JSON Lines only).
+	appendable atomic.Bool
+	// trackFiles holds the names of the track files that are known to be in storage and
+	// whether they are encoded as wanted (directory cassettes only).
+	trackFiles map[string]bool
 }
 
 type FileIO interface {
@@ -42,9 +82,53 @@ type FileIO interface {
 	NotExist(name string) (bool, error)
 }
 
+// FileAppender is optionally implemented by a FileIO storage backend that can append data
+// to an existing file.
+// It permits JSON Lines cassettes to record new tracks without re-writing the whole cassette.
+type FileAppender interface {
+	AppendFile(name string, data []byte, perm os.FileMode) error
+}
+
+// FileStreamer is optionally implemented by a FileIO storage backend that can read and write
+// files as streams. It permits large cassettes to be loaded and saved with bounded memory.
+type FileStreamer interface {
+	// OpenFile opens the named file for reading.
+	OpenFile(name string) (io.ReadCloser, error)
+
+	// WriteFileStream writes the named file with the data that write writes to w.
+	// The file is left untouched when write returns an error.
+	WriteFileStream(name string, perm os.FileMode, write func(w io.Writer) error) error
+}
+
+// FileRemover is optionally implemented by a FileIO storage backend that can remove a file.
+// It permits directory cassettes to remove the files of tracks that are no longer on the
+// cassette.
+type FileRemover interface {
+	Remove(name string) error
+}
+
 const (
 	encryptedCassetteHeaderMarkerV1 = "$ENC$" // legacy aesgcm V1 signature
 	encryptedCassetteHeaderMarkerV2 = "$ENC:V2$"
+	encryptedCassetteHeaderMarkerV3 = "$ENC:V3$" // V3 header: not authenticated
+	encryptedCassetteHeaderMarkerV4 = "$ENC:V4$"
+	// stream header: the V4 header fields, followed by a stream of encrypted chunks.
+	encryptedCassetteHeaderMarkerStream = "$ENC:STREAM$"
+)
+
+// Tags of the fields of the V3 and V4 encrypted cassette headers.
+const (
+	headerFieldEnd    byte = 0
+	headerFieldKind   byte = 1
+	headerFieldKeyID  byte = 2
+	headerFieldNonce  byte = 3
+	headerFieldParams byte = 4
+	headerFieldName   byte = 5
+	// headerFieldChunkSize is the size of the plaintext chunks of a stream (4 bytes, big endian).
+	headerFieldChunkSize byte = 6
+	// headerFieldFieldPath is the path of the track field that an encrypted field is bound to
+	// (field-level encryption only).
+	headerFieldFieldPath byte = 7
 )
 
 // Crypter defines encryption behaviour.
@@ -54,6 +138,61 @@ type Crypter interface {
 	Kind() string
 }
 
+// KeyringCrypter is implemented by a Crypter that holds several keys, such as
+// encryption.Keyring. This permits to rotate keys: the ID of the key used for encryption is
+// recorded in the cassette header and the matching key is used for decryption.
+type KeyringCrypter interface {
+	Crypter
+
+	// KeyID returns the ID of the key that Encrypt uses.
+	KeyID() string
+
+	// DecryptWithKey decrypts with the key of the specified cipher kind and ID and
+	// authenticates the associated data.
+	// An empty keyID denotes a cassette that was encrypted without a key ID.
+	DecryptWithKey(kind, keyID string, ciphertext, nonce, aad []byte) ([]byte, error)
+}
+
+// AADCrypter is implemented by a Crypter that authenticates associated data (AAD) with the
+// ciphertext: the cassette header, which includes the logical name of the cassette, if any.
+// This prevents encrypted cassettes from being swapped or their header from being altered.
+// The crypter may also record parameters in the cassette header, such as the wrapped data
+// key of encryption.EnvelopeCrypter.
+type AADCrypter interface {
+	Crypter
+
+	// EncryptWithAAD calls aad with the nonce and the parameters to obtain the associated
+	// data to authenticate. It returns the ciphertext, the nonce and the parameters.
+	EncryptWithAAD(plaintext []byte, aad func(nonce, params []byte) ([]byte, error)) (ciphertext, nonce, params []byte, err error)
+
+	// DecryptWithAAD decrypts with the parameters recorded in the cassette header and
+	// authenticates the associated data.
+	DecryptWithAAD(ciphertext, nonce, params, aad []byte) ([]byte, error)
+}
+
+// Signer defines signature behaviour. It permits to detect the alterations of the cassette
+// files in storage, such as hand edits or corruption, notably of plain cassettes.
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+	Verify(data, signature []byte) error
+	Kind() string
+}
+
+// StreamCrypter is implemented by a Crypter that can encrypt the cassette data as a stream of
+// chunks, which permits to encrypt and decrypt large cassettes with bounded memory.
+// The chunks are encrypted with the AEAD cipher and the STREAM construction.
+type StreamCrypter interface {
+	Crypter
+
+	// EncryptionStreamCipher returns the AEAD cipher to encrypt a new stream with the current
+	// key, along with the parameters to record in the cassette header, if any.
+	EncryptionStreamCipher() (aead cipher.AEAD, params []byte, err error)
+
+	// DecryptionStreamCipher returns the AEAD cipher to decrypt a stream with the key of the
+	// specified cipher kind and ID and the parameters recorded in the cassette header.
+	DecryptionStreamCipher(kind, keyID string, params []byte) (cipher.AEAD, error)
+}
+
 // Option defines a signature for options that can be passed
 // to create a new Cassette.
 type Option func(*Cassette)
@@ -69,6 +208,68 @@ func WithCrypter(crypter Crypter) Option {
 	}
 }
 
+// WithLogicalName binds the encrypted cassette data to the logical name of the cassette: the
+// name is authenticated with the cassette data, which then only decrypts under this name.
+// This prevents encrypted cassettes from being swapped, for instance by a careless copy.
+// Encrypted data that is not bound to a logical name, such as that of a cassette encrypted
+// with a legacy header (V1 to V3), is refused: see WithLogicalNameMigration.
+// It requires a crypter that implements AADCrypter.
+func WithLogicalName(name string) Option {
+	return func(k7 *Cassette) {
+		k7.logicalName = name
+	}
+}
+
+// WithLogicalNameMigration accepts the encrypted data that is not bound to a logical name,
+// such as that of a cassette encrypted with a legacy header (V1 to V3) or without a logical
+// name, when the cassette has a logical name (see WithLogicalName). The data is bound to the
+// logical name when it is next saved.
+// This is meant to migrate cassettes once: it permits to swap in an unbound cassette, which
+// WithLogicalName otherwise prevents.
+func WithLogicalNameMigration() Option {
+	return func(k7 *Cassette) {
+		k7.acceptUnbound = true
+	}
+}
+
+// WithFieldEncryption provides a crypter to encrypt/decrypt the selected fields of the tracks
+// rather than the whole cassette, which remains plain JSON otherwise.
+// Encrypted fields are decrypted when the cassette is loaded.
+// It is not meant to be used together with WithCrypter.
+func WithFieldEncryption(crypter Crypter, fields FieldSelection) Option {
+	return func(k7 *Cassette) {
+		k7.fieldCrypter = crypter
+		k7.fields = fields
+	}
+}
+
+// WithSigner provides a signer to sign the cassette files when they are saved and verify
+// their signature when they are loaded.
+func WithSigner(signer Signer) Option {
+	return func(k7 *Cassette) {
+		k7.signer = signer
+	}
+}
+
+// WithStreaming saves the cassette as a stream, track by track, rather than whole, such that
+// large cassettes are saved with bounded memory.
+// When the cassette is encrypted, it is encrypted in chunks of chunkSize bytes, which requires
+// a StreamCrypter. A chunkSize of zero selects DefaultStreamChunkSize.
+// The store must be a FileStreamer and the cassette must not be signed, since a signature
+// covers the whole cassette: otherwise, the cassette fails to save.
+// Streamed cassettes are loaded with bounded memory whether this option is set or not, under
+// the same conditions: a signed cassette is read whole to verify its signature.
+// This does not apply to JSON Lines and directory cassettes, which are saved track by track.
+func WithStreaming(chunkSize int) Option {
+	return func(k7 *Cassette) {
+		if chunkSize <= 0 {
+			chunkSize = DefaultStreamChunkSize
+		}
+
+		k7.streamChunkSize = chunkSize
+	}
+}
+
 // WithStore provides a dedicated storage engine for the cassette data.
 func WithStore(store FileIO) Option {
 	return func(k7 *Cassette) {
@@ -80,9 +281,29 @@ func WithStore(store FileIO) Option {
 	}
 }
 
+// WithDeferredPersistence keeps new tracks in memory rather than saving the cassette on every
+// recording. The cassette is persisted when it is flushed or ejected and, if flushInterval is
+// greater than zero, periodically in the background.
+func WithDeferredPersistence(flushInterval time.Duration) Option {
+	return func(k7 *Cassette) {
+		k7.deferredSave.Store(true)
+		k7.flushInterval = flushInterval
+	}
+}
+
 // NewCassette creates a ready to use new cassette.
 // When no storage backend (store) is provided, the default OSFile storage is used.
+// A cassette with periodic deferred persistence flushes in the background until it is ejected.
 func NewCassette(name string, opts ...Option) *Cassette {
+	k7 := newCassette(name, opts...)
+	k7.startFlushing()
+
+	return k7
+}
+
+// newCassette creates a new cassette without starting its background persistence, such that
+// no goroutine is left behind when the cassette fails to load or when it is only read.
+func newCassette(name string, opts ...Option) *Cassette {
 	k7 := Cassette{
 		name:            name,
 		trackSliceMutex: sync.RWMutex{},
@@ -99,6 +320,123 @@ func NewCassette(name string, opts ...Option) *Cassette {
 	return &k7
 }
 
+// startFlushing starts the periodic persistence of a cassette with deferred persistence, if
+// it has a flush interval. It is stopped by Eject.
+func (k7 *Cassette) startFlushing() {
+	if k7.deferredSave.Load() && k7.flushInterval > 0 {
+		k7.stopFlush = make(chan struct{})
+		go k7.flushPeriodically()
+	}
+}
+
+func (k7 *Cassette) flushPeriodically() {
+	ticker := time.NewTicker(k7.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k7.stopFlush:
+			return
+
+		case <-ticker.C:
+			if err := k7.Flush(); err != nil {
+				slog.Error("failed to flush cassette", slog.String("cassette", k7.name), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// Flush persists the cassette if it holds tracks that have not been saved yet.
+// This is only useful with deferred persistence, otherwise tracks are saved as they are recorded.
+func (k7 *Cassette) Flush() error {
+	if !k7.dirty.Swap(false) {
+		return nil
+	}
+
+	if err := k7.save(); err != nil {
+		k7.dirty.Store(true)
+		return err
+	}
+
+	return nil
+}
+
+// Eject flushes the cassette and stops its background persistence, if any.
+// Tracks recorded after the cassette is ejected are saved immediately.
+// Eject can safely be called more than once, for instance from testing.T.Cleanup.
+func (k7 *Cassette) Eject() error {
+	k7.ejectOnce.Do(func() {
+		if k7.stopFlush != nil {
+			close(k7.stopFlush)
+		}
+
+		k7.deferredSave.Store(false)
+	})
+
+	return k7.Flush()
+}
+
+// PruneUnusedTracks removes the tracks that have neither been replayed nor recorded and
+// saves the cassette, with its current compression and crypter, when any track was removed.
+// It returns the number of tracks removed.
+func (k7 *Cassette) PruneUnusedTracks() (int, error) {
+	k7.trackSliceMutex.Lock()
+
+	tracks := make([]track.Track, 0, len(k7.Tracks))
+
+	for i := range k7.Tracks {
+		if k7.Tracks[i].IsReplayed() {
+			tracks = append(tracks, k7.Tracks[i])
+		}
+	}
+
+	pruned := len(k7.Tracks) - len(tracks)
+	k7.Tracks = tracks
+
+	k7.trackSliceMutex.Unlock()
+
+	if pruned == 0 {
+		return 0, nil
+	}
+
+	return pruned, k7.persist(nil)
+}
+
+// ReplaceTracks replaces all the tracks of the cassette and saves it, with its current
+// settings, even when it is left with no tracks.
+func (k7 *Cassette) ReplaceTracks(tracks []track.Track) error {
+	k7.trackSliceMutex.Lock()
+
+	// the files of the tracks must be re-written when the new tracks have the same UUIDs.
+	k7.invalidateTrackFiles()
+
+	k7.Tracks = append([]track.Track{}, tracks...)
+
+	k7.trackSliceMutex.Unlock()
+
+	return k7.persist(nil)
+}
+
+// persist saves the cassette or, with deferred persistence, marks it for saving later.
+// When newTrk is the only change since the cassette was last saved, it may be appended to
+// the cassette in storage rather than re-writing the whole cassette.
+// A signed cassette is always re-written, such that its signature, which covers the whole
+// cassette, is never out of date.
+func (k7 *Cassette) persist(newTrk *track.Track) error {
+	if k7.deferredSave.Load() {
+		k7.dirty.Store(true)
+		return nil
+	}
+
+	if newTrk != nil && k7.IsJSONLines() && k7.signer == nil && k7.appendable.Load() {
+		if appender, ok := k7.store.(FileAppender); ok {
+			return k7.appendJSONLinesTrack(appender, newTrk)
+		}
+	}
+
+	return k7.save()
+}
+
 // Stats returns the cassette's Stats.
 func (k7 *Cassette) Stats() *stats.Stats {
 	if k7 == nil {
@@ -109,7 +447,7 @@ func (k7 *Cassette) Stats() *stats.Stats {
 		TotalTracks: k7.NumberOfTracks(),
 	}
 	s.TracksLoaded = atomic.LoadInt32(&k7.tracksLoaded)
-	s.TracksRecorded = k7.NumberOfTracks() - s.TracksLoaded
+	s.TracksRecorded = atomic.LoadInt32(&k7.tracksRecorded)
 	s.TracksPlayed = k7.tracksPlayed() - s.TracksRecorded
 
 	return &s
@@ -167,11 +505,62 @@ func (k7 *Cassette) AddTrack(trk *track.Track) {
 	}
 
 	k7.Tracks = append(k7.Tracks, *trk)
+
+	atomic.AddInt32(&k7.tracksRecorded, 1)
+}
+
+// ReplaceTrack replaces the specified track number on the cassette with a new track.
+// '0' is the first track.
+// Note that the Track does not receive mutations here, it must be mutated
+// before passed to the cassette for recording.
+func (k7 *Cassette) ReplaceTrack(trackNumber int32, trk *track.Track) error {
+	k7.trackSliceMutex.Lock()
+	defer k7.trackSliceMutex.Unlock()
+
+	numberOfTracks := int32(len(k7.Tracks)) //nolint:gosec // int32 can more than sufficiently hold the number of tracks on a cassette.
+	if trackNumber < 0 || trackNumber >= numberOfTracks {
+		return govcrerr.NewErrGoVCR(fmt.Sprintf("invalid track number %d (only %d available) (track #0 stands for first track)", trackNumber, numberOfTracks))
+	}
+
+	if trk.UUID == "" {
+		trk.UUID = uuid.NewString()
+	}
+
+	// the file of the track must be re-written when the new track has the same UUID.
+	k7.invalidateTrackFile(&k7.Tracks[trackNumber])
+
+	k7.Tracks[trackNumber] = *trk
+
+	atomic.AddInt32(&k7.tracksRecorded, 1)
+
+	return nil
+}
+
+// IsNew returns true if the cassette did not exist in its store at the time it was loaded.
+func (k7 *Cassette) IsNew() bool {
+	return !k7.existed
 }
 
 // IsLongPlay returns true if the cassette content is compressed.
+// The tracks of a directory cassette with a name that ends with ".gz/" are compressed.
 func (k7 *Cassette) IsLongPlay() bool {
-	return strings.HasSuffix(k7.name, ".gz")
+	return strings.HasSuffix(strings.TrimSuffix(k7.name, "/"), ".gz")
+}
+
+// IsDirectory returns true if the cassette is stored as a directory with one file per track.
+// Such cassettes have a name that ends with "/".
+func (k7 *Cassette) IsDirectory() bool {
+	return strings.HasSuffix(k7.name, "/")
+}
+
+// IsJSONLines returns true if the cassette is stored in JSON Lines format, with one track
+// per line. Such cassettes have a name that ends with ".jsonl" (or ".jsonl.gz").
+func (k7 *Cassette) IsJSONLines() bool {
+	return isJSONLinesName(k7.name)
+}
+
+func isJSONLinesName(name string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(name, ".gz"), ".jsonl")
 }
 
 func (k7 *Cassette) wantEncrypted() bool {
@@ -187,20 +576,23 @@ func (k7 *Cassette) save() error {
 		k7.store = &fileio.OSFile{}
 	}
 
-	data, err := json.MarshalIndent(k7, "", "  ")
-	if err != nil {
-		return errors.WithStack(err)
+	if k7.IsDirectory() {
+		return k7.saveDirectory()
 	}
 
-	// compress before encryption to get better results
-	gData, err := k7.GzipFilter(*bytes.NewBuffer(data))
-	if err != nil {
-		return errors.WithStack(err)
+	if k7.wantStreaming() {
+		if err := k7.saveStream(); err != nil {
+			return err
+		}
+
+		k7.appendable.Store(true)
+
+		return nil
 	}
 
-	eData, err := k7.EncryptionFilter(gData)
+	eData, err := k7.encode()
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
 
 	path := filepath.Dir(k7.name)
@@ -208,8 +600,52 @@ func (k7 *Cassette) save() error {
 		return errors.Wrap(err, path)
 	}
 
-	err = k7.store.WriteFile(k7.name, eData, 0o600)
-	return errors.Wrap(err, k7.name)
+	if err = k7.store.WriteFile(k7.name, eData, 0o600); err != nil {
+		return errors.Wrap(err, k7.name)
+	}
+
+	if err = k7.writeSignature(k7.name, eData); err != nil {
+		return err
+	}
+
+	k7.appendable.Store(true)
+
+	return nil
+}
+
+// encode returns the cassette data as it is to be written to storage, filters included.
+// The caller is responsible for locking the cassette.
+func (k7 *Cassette) encode() ([]byte, error) {
+	if k7.IsJSONLines() {
+		return k7.encodeJSONLines()
+	}
+
+	tracks, err := k7.sealTracks(k7.Tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Tracks []track.Track `json:"Tracks"`
+	}{
+		Tracks: tracks,
+	}, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// compress before encryption to get better results
+	gData, err := k7.GzipFilter(*bytes.NewBuffer(data))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	eData, err := k7.EncryptionFilter(gData)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return eData, nil
 }
 
 // GzipFilter compresses the cassette data in gzip format if the cassette
@@ -237,32 +673,7 @@ func (k7 *Cassette) EncryptionFilter(data []byte) ([]byte, error) {
 		return data, nil
 	}
 
-	ciphertext, nonce, err := k7.crypter.Encrypt(data)
-	if err != nil {
-		return nil, err
-	}
-
-	kindLen := len(k7.crypter.Kind())
-	if kindLen > 255 {
-		return nil, errors.New("cipher kind is too long, must be 255 max")
-	}
-
-	nonceLen := len(nonce)
-	if nonceLen > 255 {
-		return nil, errors.New("nonce is too long, must be 255 max")
-	}
-
-	// first add header
-	eData := []byte(encryptedCassetteHeaderMarkerV2)
-	eData = append(eData, byte(kindLen))
-	eData = append(eData, []byte(k7.crypter.Kind())...)
-	eData = append(eData, byte(nonceLen))
-	eData = append(eData, nonce...)
-
-	// then add cassette data
-	eData = append(eData, ciphertext...)
-
-	return eData, nil
+	return encrypt(data, k7.crypter, k7.logicalName)
 }
 
 // DecryptionFilter decrypts the cassette data if a cryptographer Crypter
@@ -282,7 +693,34 @@ func (k7 *Cassette) DecryptionFilter(data []byte) ([]byte, error) {
 		return data, nil
 	}
 
-	return Decrypt(data, k7.crypter)
+	plaintext, h, err := decrypt(data, k7.crypter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = k7.checkLogicalName(h, "cassette data"); err != nil {
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+// checkLogicalName returns an error when the encrypted data (described by what) is bound to
+// another logical name than that of the cassette.
+// The legacy headers (V1 to V3) are not authenticated and they cannot hold a logical name:
+// such data, like the data encrypted without a logical name, is refused when the cassette has
+// a logical name, since it would otherwise permit to swap in an unbound cassette, unless the
+// migration is accepted (see WithLogicalNameMigration).
+func (k7 *Cassette) checkLogicalName(h *encryptionHeader, what string) error {
+	if h.name == k7.logicalName || (h.name == "" && k7.acceptUnbound) {
+		return nil
+	}
+
+	if h.name == "" {
+		return cryptoerr.NewErrCrypto(fmt.Sprintf("%s is not bound to a logical name but the cassette logical name is '%s'", what, k7.logicalName))
+	}
+
+	return cryptoerr.NewErrCrypto(fmt.Sprintf("%s is bound to logical name '%s' but the cassette logical name is '%s'", what, h.name, k7.logicalName))
 }
 
 // SetCrypter sets the cassette Crypter.
@@ -290,7 +728,11 @@ func (k7 *Cassette) DecryptionFilter(data []byte) ([]byte, error) {
 // when loading a cassette) or change the cipher when one is already present.
 // The cassette is saved to persist the change with the new selected cipher.
 func (k7 *Cassette) SetCrypter(crypter Crypter) error {
+	k7.trackSliceMutex.Lock()
 	k7.crypter = crypter
+	k7.invalidateTrackFiles() // the tracks of a directory cassette must all be re-written
+	k7.trackSliceMutex.Unlock()
+
 	return k7.save()
 }
 
@@ -318,9 +760,14 @@ func (k7 *Cassette) readCassette(cassetteName string) ([]byte, error) {
 		k7.store = &fileio.OSFile{}
 	}
 
+	if k7.IsDirectory() {
+		return k7.readDirectory()
+	}
+
 	if notExist, err := k7.store.NotExist(cassetteName); err != nil {
 		return nil, errors.Wrap(err, "failed to check cassette existence")
 	} else if notExist {
+		k7.appendable.Store(k7.IsJSONLines())
 		return nil, nil // not found, return nil data
 	}
 
@@ -329,6 +776,14 @@ func (k7 *Cassette) readCassette(cassetteName string) ([]byte, error) {
 		return nil, errors.Wrap(err, "failed to read cassette data from source")
 	}
 
+	if err = k7.verifySignature(cassetteName, data); err != nil {
+		return nil, err
+	}
+
+	if k7.IsJSONLines() {
+		return k7.decodeJSONLines(data)
+	}
+
 	dData, err := k7.DecryptionFilter(data)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -363,58 +818,322 @@ func getEncryptionMarker(data []byte) string {
 	return marker
 }
 
-// Decrypt is a utility function that decrypts the cassette raw data
-// with the use of the supplied crypter.
-func Decrypt(data []byte, crypter Crypter) ([]byte, error) {
-	encMarker := getEncryptionMarker(data)
-	markerLen := len(encMarker)
+// Encrypt is a utility function that encrypts the cassette raw data with the use of the
+// supplied crypter and prefixes it with the encryption header.
+// The V4 header, which is authenticated as associated data, is used when the crypter is an
+// AADCrypter, otherwise the legacy V2 header is used.
+func Encrypt(data []byte, crypter Crypter) ([]byte, error) {
+	return encrypt(data, crypter, "")
+}
+
+// encrypt encrypts the cassette raw data and binds it to the logical name of the cassette,
+// when not empty.
+func encrypt(data []byte, crypter Crypter, logicalName string) ([]byte, error) {
+	return encryptWithHeader(data, crypter, encryptionHeader{name: logicalName})
+}
+
+// encryptWithHeader encrypts the data and binds it to the logical name and the field path of
+// the header, when not empty.
+func encryptWithHeader(data []byte, crypter Crypter, h encryptionHeader) ([]byte, error) {
+	if ac, ok := crypter.(AADCrypter); ok {
+		h.kind = crypter.Kind()
+		if kc, ok := crypter.(KeyringCrypter); ok {
+			h.keyID = kc.KeyID()
+		}
+
+		var header []byte
+
+		ciphertext, _, _, err := ac.EncryptWithAAD(data, func(nonce, params []byte) ([]byte, error) {
+			h.nonce, h.params = nonce, params
+
+			var err error
+
+			header, err = encryptionHeaderV4(&h)
+
+			return header, err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return append(header, ciphertext...), nil
+	}
+
+	if h.name != "" {
+		return nil, errors.New("the cassette crypter does not support associated data, which the logical name requires")
+	}
+
+	if h.field != "" {
+		return nil, errors.New("the field crypter does not support associated data, which field-level encryption requires")
+	}
+
+	ciphertext, nonce, err := crypter.Encrypt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	kindLen := len(crypter.Kind())
+	if kindLen > 255 {
+		return nil, errors.New("cipher kind is too long, must be 255 max")
+	}
+
+	nonceLen := len(nonce)
+	if nonceLen > 255 {
+		return nil, errors.New("nonce is too long, must be 255 max")
+	}
+
+	// first add header
+	eData := []byte(encryptedCassetteHeaderMarkerV2)
+	eData = append(eData, byte(kindLen))
+	eData = append(eData, []byte(crypter.Kind())...)
+	eData = append(eData, byte(nonceLen))
+	eData = append(eData, nonce...)
+
+	// then add cassette data
+	eData = append(eData, ciphertext...)
+
+	return eData, nil
+}
+
+// encryptionHeaderV4 returns the V4 header:
+// - marker
+// - fields, each made of a tag (1 byte), a value length (2 bytes, big endian) and a value
+// - end tag (1 byte)
+//
+// Empty optional fields (key ID, parameters, logical name and field path) are omitted.
+// The V3 header has the same layout but it is not authenticated.
+func encryptionHeaderV4(h *encryptionHeader) ([]byte, error) {
+	return encodeEncryptionHeader(encryptedCassetteHeaderMarkerV4, h)
+}
+
+// encodeEncryptionHeader returns the header with the layout of the V4 header and the
+// specified marker. The chunk size field is only present in the header of streams.
+func encodeEncryptionHeader(marker string, h *encryptionHeader) ([]byte, error) {
+	header := []byte(marker)
+
+	var chunkSize []byte
+	if h.chunkSize != 0 {
+		chunkSize = binary.BigEndian.AppendUint32(nil, h.chunkSize)
+	}
+
+	for _, field := range []struct {
+		tag   byte
+		value []byte
+	}{
+		{tag: headerFieldKind, value: []byte(h.kind)},
+		{tag: headerFieldKeyID, value: []byte(h.keyID)},
+		{tag: headerFieldNonce, value: h.nonce},
+		{tag: headerFieldParams, value: h.params},
+		{tag: headerFieldName, value: []byte(h.name)},
+		{tag: headerFieldChunkSize, value: chunkSize},
+		{tag: headerFieldFieldPath, value: []byte(h.field)},
+	} {
+		if len(field.value) == 0 && field.tag != headerFieldKind && field.tag != headerFieldNonce {
+			continue
+		}
 
-	var nonce []byte
+		if len(field.value) > math.MaxUint16 {
+			return nil, errors.Errorf("encryption header field %d is too long, must be %d max", field.tag, math.MaxUint16)
+		}
+
+		header = append(header, field.tag)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(field.value)))
+		header = append(header, field.value...)
+	}
+
+	return append(header, headerFieldEnd), nil
+}
+
+// encryptionHeader holds the details of the encryption header of the cassette data.
+type encryptionHeader struct {
+	marker string
+	kind   string
+	keyID  string
+	nonce  []byte
+	params []byte
+	// name is the logical name of the cassette that the data is bound to, if any.
+	name string
+	// chunkSize is the size of the plaintext chunks (stream header only).
+	chunkSize uint32
+	// field is the path of the track field that the data is bound to (encrypted fields only).
+	field string
+	// aad holds the associated data to authenticate (V4 and stream headers only).
+	aad []byte
+}
+
+// parseEncryptionHeader returns the encryption header of the cassette data and the ciphertext
+// that follows it.
+func parseEncryptionHeader(data []byte) (*encryptionHeader, []byte, error) {
+	encMarker := getEncryptionMarker(data)
+	r := headerReader{data: data, pos: len(encMarker)}
 
-	pos := markerLen
+	h := encryptionHeader{marker: encMarker}
 
 	switch encMarker {
 	case encryptedCassetteHeaderMarkerV1:
-		// Header V1 (aes gcm only, will automatically convert to V2 on save):
+		// Header V1:
 		// - marker ($ENC$)
 		// - nonce length (1 byte)
 		// - nonce
-		nonceLen := int(data[pos])
-		pos++
-
-		nonce = data[pos : pos+nonceLen]
-		pos += nonceLen
+		h.kind = "aesgcm"
+		h.nonce = r.next(int(r.readByte()))
 
 	case encryptedCassetteHeaderMarkerV2:
 		// Header V2:
-		// - marker
+		// - marker ($ENC:V2$)
 		// - cipher name length (1 byte)
 		// - cipher name
 		// - nonce length (1 byte)
 		// - nonce
-		cipherKindLen := int(data[pos])
-		pos++
+		h.kind = string(r.next(int(r.readByte())))
+		h.nonce = r.next(int(r.readByte()))
+
+	case encryptedCassetteHeaderMarkerV3, encryptedCassetteHeaderMarkerV4, encryptedCassetteHeaderMarkerStream:
+		// Headers V3, V4 and stream: see encodeEncryptionHeader.
+		for tag := r.readByte(); tag != headerFieldEnd && r.err == nil; tag = r.readByte() {
+			value := r.next(int(binary.BigEndian.Uint16(r.next(2))))
+
+			switch tag {
+			case headerFieldKind:
+				h.kind = string(value)
+			case headerFieldKeyID:
+				h.keyID = string(value)
+			case headerFieldNonce:
+				h.nonce = value
+			case headerFieldParams:
+				h.params = value
+			case headerFieldName:
+				h.name = string(value)
+			case headerFieldChunkSize:
+				if len(value) == 4 {
+					h.chunkSize = binary.BigEndian.Uint32(value)
+				}
+			case headerFieldFieldPath:
+				h.field = string(value)
+			}
+		}
 
-		cipherKind := data[pos : pos+cipherKindLen]
-		pos += cipherKindLen
-		if string(cipherKind) != crypter.Kind() {
-			return nil, errors.Errorf("cassette crypter is '%s' but cassette data indicates '%s'", crypter.Kind(), string(cipherKind))
+		if encMarker != encryptedCassetteHeaderMarkerV3 && r.err == nil {
+			h.aad = data[:r.pos]
 		}
 
-		nonceLen := int(data[pos])
-		pos++
+	case "":
+		return nil, nil, errors.New("missing encrypted cassette header marker")
 
-		nonce = data[pos : pos+nonceLen]
-		pos += nonceLen
+	default:
+		return nil, nil, errors.Errorf("encrypted cassette header marker not recognised: '%s'", encMarker)
+	}
 
-	case "":
-		return nil, errors.New("missing encrypted cassette header marker")
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+
+	return &h, data[r.pos:], nil
+}
+
+// headerReader reads the encryption header of the cassette data.
+// Once an error has occurred, it returns zero values.
+type headerReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *headerReader) next(n int) []byte {
+	if r.err != nil || r.pos+n > len(r.data) {
+		r.err = errors.New("encrypted cassette header is truncated")
+		return make([]byte, n)
+	}
+
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
 
+	return b
+}
+
+func (r *headerReader) readByte() byte {
+	return r.next(1)[0]
+}
+
+// Decrypt is a utility function that decrypts the cassette raw data
+// with the use of the supplied crypter.
+// The V4 header is authenticated, including the logical name of the cassette when present.
+// However, Decrypt does not verify the logical name: see Cassette.DecryptionFilter.
+func Decrypt(data []byte, crypter Crypter) ([]byte, error) {
+	plaintext, _, err := decrypt(data, crypter)
+	return plaintext, err
+}
+
+// decrypt decrypts the cassette raw data and returns it with its encryption header.
+func decrypt(data []byte, crypter Crypter) ([]byte, *encryptionHeader, error) {
+	if getEncryptionMarker(data) == encryptedCassetteHeaderMarkerStream {
+		return decryptStream(data, crypter)
+	}
+
+	h, ciphertext, err := parseEncryptionHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var plaintext []byte
+
+	if kc, ok := crypter.(KeyringCrypter); ok {
+		plaintext, err = kc.DecryptWithKey(h.kind, h.keyID, ciphertext, h.nonce, h.aad)
+		return plaintext, h, err
+	}
+
+	if h.kind != crypter.Kind() {
+		return nil, nil, errors.Errorf("cassette crypter is '%s' but cassette data indicates '%s'", crypter.Kind(), h.kind)
+	}
+
+	switch ac, ok := crypter.(AADCrypter); {
+	case ok:
+		plaintext, err = ac.DecryptWithAAD(ciphertext, h.nonce, h.params, h.aad)
+	case h.aad != nil:
+		return nil, nil, errors.New("the cassette crypter does not support associated data, which the cassette header requires")
 	default:
-		return nil, errors.Errorf("encrypted cassette header marker not recognised: '%s'", encMarker)
+		plaintext, err = crypter.Decrypt(ciphertext, h.nonce)
 	}
 
-	return crypter.Decrypt(data[pos:], nonce)
+	return plaintext, h, err
+}
+
+// isEncodedAsWanted returns true if the encryption of the cassette raw data agrees with the
+// cassette crypter, including its current key and the logical name of the cassette.
+// Otherwise, the data is due for re-encryption.
+func (k7 *Cassette) isEncodedAsWanted(data []byte) bool {
+	if !k7.wantEncrypted() {
+		return getEncryptionMarker(data) == ""
+	}
+
+	if !isEncryptedWithCurrentKey(data, k7.crypter) {
+		return false
+	}
+
+	h, _, err := parseEncryptionHeader(data)
+
+	return err == nil && h.name == k7.logicalName
+}
+
+// isEncryptedWithCurrentKey returns true if the cassette data is encrypted with the
+// current key of the crypter and the current header version, in which case it does not
+// need to be re-encrypted.
+func isEncryptedWithCurrentKey(data []byte, crypter Crypter) bool {
+	h, _, err := parseEncryptionHeader(data)
+	if err != nil || crypter == nil || h.kind != crypter.Kind() {
+		return false
+	}
+
+	if _, ok := crypter.(AADCrypter); ok && h.marker != encryptedCassetteHeaderMarkerV4 && h.marker != encryptedCassetteHeaderMarkerStream {
+		return false
+	}
+
+	var keyID string
+	if kc, ok := crypter.(KeyringCrypter); ok {
+		keyID = kc.KeyID()
+	}
+
+	return h.keyID == keyID
 }
 
 // AddTrackToCassette saves a new track using the specified details to a cassette.
@@ -426,15 +1145,51 @@ func AddTrackToCassette(cassette *Cassette, trk *track.Track) error {
 	cassette.AddTrack(trk)
 
 	// save cassette
-	return cassette.save()
+	return cassette.persist(trk)
+}
+
+// ReplaceTrackOnCassette saves a new track in place of the specified track number on a cassette.
+func ReplaceTrackOnCassette(cassette *Cassette, trackNumber int32, trk *track.Track) error {
+	// mark track as replayed since it's coming from a live Request!
+	trk.SetReplayed(true)
+
+	// replace track on cassette
+	if err := cassette.ReplaceTrack(trackNumber, trk); err != nil {
+		return err
+	}
+
+	// save cassette
+	return cassette.persist(nil)
 }
 
 // LoadCassette loads a cassette from source and initialises its associated stats.
 // It panics when a cassette exists but cannot be loaded because that indicates
 // corruption (or a severe bug).
+// The background persistence of the cassette, if any, starts once the cassette is loaded.
 func LoadCassette(cassetteName string, opts ...Option) *Cassette {
-	k7 := NewCassette(cassetteName, opts...)
+	k7 := newCassette(cassetteName, opts...)
+
+	if k7.store == nil {
+		k7.store = &fileio.OSFile{}
+	}
+
+	if k7.IsDirectory() || k7.IsJSONLines() {
+		k7.load(cassetteName)
+	} else {
+		k7.loadStream(cassetteName)
+	}
+
+	// initial stats
+	atomic.StoreInt32(&k7.tracksLoaded, k7.NumberOfTracks())
+
+	k7.startFlushing()
+
+	return k7
+}
 
+// load loads the tracks of a JSON Lines or directory cassette from source.
+// It panics when the cassette exists but cannot be loaded: see LoadCassette.
+func (k7 *Cassette) load(cassetteName string) {
 	data, err := k7.readCassette(cassetteName)
 	if err != nil {
 		panic(fmt.Sprintf("unable to load invalid / corrupted cassette '%s': %+v", cassetteName, err))
@@ -442,22 +1197,29 @@ func LoadCassette(cassetteName string, opts ...Option) *Cassette {
 
 	if data != nil {
 		// NOTE: Properties which are of type 'interface{} / any' are not handled very well
-		if err = json.Unmarshal(data, k7); err != nil {
-			panic(fmt.Sprintf("failed to interpret cassette data in source '%s': %+v", cassetteName, err))
+		if k7.IsJSONLines() {
+			err = k7.unmarshalJSONLines(data)
+		} else {
+			err = json.Unmarshal(data, k7)
 		}
-	}
 
-	// initial stats
-	atomic.StoreInt32(&k7.tracksLoaded, k7.NumberOfTracks())
+		if err == nil {
+			err = k7.unsealTracks()
+		}
 
-	return k7
+		if err != nil {
+			panic(fmt.Sprintf("failed to interpret cassette data in source '%s': %+v", cassetteName, err))
+		}
+
+		k7.existed = true
+	}
 }
 
 // DumpCassette loads a cassette from source and returns its (decrypted) contents.
 // It panics when a cassette exists but cannot be loaded because that indicates
 // corruption (or a severe bug).
 func DumpCassette(cassetteName string, opts ...Option) []byte {
-	k7 := NewCassette(cassetteName, opts...)
+	k7 := newCassette(cassetteName, opts...)
 
 	data, err := k7.readCassette(cassetteName)
 	if err != nil {
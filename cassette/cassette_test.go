@@ -2,9 +2,19 @@ package cassette_test
 
 import (
 	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -12,6 +22,8 @@ import (
 	"github.com/seborama/govcr/v17/cassette"
 	"github.com/seborama/govcr/v17/cassette/track"
 	"github.com/seborama/govcr/v17/encryption"
+	govcrerr "github.com/seborama/govcr/v17/errors"
+	"github.com/seborama/govcr/v17/fileio"
 )
 
 func Test_cassette_GzipFilter(t *testing.T) {
@@ -77,6 +89,134 @@ func Test_cassette_AddTrackToCassette(t *testing.T) {
 	})
 }
 
+func Test_cassette_ReplaceTrackOnCassette(t *testing.T) {
+	s := &StoreMock{}
+	k7 := cassette.NewCassette("", cassette.WithStore(s))
+
+	k7.AddTrack(&track.Track{UUID: "trk-1"})
+	k7.AddTrack(&track.Track{UUID: "trk-2"})
+
+	err := cassette.ReplaceTrackOnCassette(k7, 0, &track.Track{UUID: "trk-3"})
+	require.NoError(t, err)
+
+	require.Len(t, k7.Tracks, 2)
+	assert.Equal(t, "trk-3", k7.Tracks[0].UUID)
+	assert.True(t, k7.Tracks[0].IsReplayed())
+	assert.Equal(t, "trk-2", k7.Tracks[1].UUID)
+
+	if assert.NotNil(t, s.Data) {
+		var got cassette.Cassette
+		err = json.Unmarshal(s.Data, &got)
+		require.NoError(t, err)
+		require.Len(t, got.Tracks, 2)
+		assert.Equal(t, "trk-3", got.Tracks[0].UUID)
+	}
+
+	err = cassette.ReplaceTrackOnCassette(k7, 2, &track.Track{UUID: "trk-4"})
+	require.Error(t, err)
+}
+
+func Test_cassette_PruneUnusedTracks(t *testing.T) {
+	s := &StoreMock{}
+	k7 := cassette.NewCassette("", cassette.WithStore(s))
+
+	k7.AddTrack(&track.Track{UUID: "trk-1"})
+	k7.AddTrack(&track.Track{UUID: "trk-2"})
+
+	err := cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-3"})
+	require.NoError(t, err)
+
+	_, err = k7.ReplayTrack(0)
+	require.NoError(t, err)
+
+	pruned, err := k7.PruneUnusedTracks()
+	require.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+
+	require.Len(t, k7.Tracks, 2)
+	assert.Equal(t, "trk-1", k7.Tracks[0].UUID)
+	assert.Equal(t, "trk-3", k7.Tracks[1].UUID)
+
+	var got cassette.Cassette
+	require.NoError(t, json.Unmarshal(s.Data, &got))
+	require.Len(t, got.Tracks, 2)
+
+	s.Data = nil
+	pruned, err = k7.PruneUnusedTracks()
+	require.NoError(t, err)
+	assert.Zero(t, pruned)
+	assert.Nil(t, s.Data)
+}
+
+func Test_cassette_DeferredPersistence(t *testing.T) {
+	t.Run("Tracks are persisted on Flush and Eject", func(t *testing.T) {
+		s := &StoreMock{}
+		k7 := cassette.NewCassette("", cassette.WithStore(s), cassette.WithDeferredPersistence(0))
+
+		err := cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"})
+		require.NoError(t, err)
+		assert.Nil(t, s.Data)
+
+		require.NoError(t, k7.Flush())
+		require.NotNil(t, s.Data)
+
+		var got cassette.Cassette
+		require.NoError(t, json.Unmarshal(s.Data, &got))
+		assert.Len(t, got.Tracks, 1)
+
+		err = cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"})
+		require.NoError(t, err)
+
+		require.NoError(t, k7.Eject())
+		require.NoError(t, json.Unmarshal(s.Data, &got))
+		assert.Len(t, got.Tracks, 2)
+
+		// once ejected, the cassette is saved immediately
+		s.Data = nil
+		err = cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-3"})
+		require.NoError(t, err)
+		assert.NotNil(t, s.Data)
+
+		require.NoError(t, k7.Eject())
+	})
+
+	t.Run("Tracks are persisted periodically", func(t *testing.T) {
+		s := &StoreMock{}
+		k7 := cassette.NewCassette("", cassette.WithStore(s), cassette.WithDeferredPersistence(10*time.Millisecond))
+		defer func() { require.NoError(t, k7.Eject()) }()
+
+		err := cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { return s.data() != nil }, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("Tracks of a loaded cassette are persisted periodically", func(t *testing.T) {
+		cassetteName := filepath.Join(t.TempDir(), "loaded.cassette.json")
+
+		k7 := cassette.LoadCassette(cassetteName, cassette.WithDeferredPersistence(10*time.Millisecond))
+		defer func() { require.NoError(t, k7.Eject()) }()
+
+		err := cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { _, err := os.Stat(cassetteName); return err == nil }, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("No background persistence is left behind when the cassette fails to load", func(t *testing.T) {
+		cassetteName := filepath.Join(t.TempDir(), "corrupt.cassette.json")
+		require.NoError(t, os.WriteFile(cassetteName, []byte("{not json"), 0o600))
+
+		goroutines := runtime.NumGoroutine()
+
+		require.Panics(t, func() {
+			cassette.LoadCassette(cassetteName, cassette.WithDeferredPersistence(10*time.Millisecond))
+		})
+
+		assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines)
+	})
+}
+
 func Test_cassette_IsLongPlay(t *testing.T) {
 	tt := []*struct {
 		name         string
@@ -105,6 +245,292 @@ func Test_cassette_IsLongPlay(t *testing.T) {
 	}
 }
 
+func Test_cassette_IsJSONLines(t *testing.T) {
+	tt := []*struct {
+		name         string
+		cassetteName string
+		want         bool
+	}{
+		{
+			name:         "Should detect JSON Lines cassette",
+			cassetteName: "cassette.jsonl",
+			want:         true,
+		},
+		{
+			name:         "Should detect Long Play JSON Lines cassette",
+			cassetteName: "cassette.jsonl.gz",
+			want:         true,
+		},
+		{
+			name:         "Should detect JSON cassette",
+			cassetteName: "cassette.json.gz",
+			want:         false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			k7 := cassette.NewCassette(tc.cassetteName)
+
+			got := k7.IsJSONLines()
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func Test_cassette_JSONLines(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	c, err := encryption.NewAESGCMWithRandomNonceGenerator(key)
+	require.NoError(t, err)
+
+	tt := []*struct {
+		name         string
+		cassetteName string
+		opts         []cassette.Option
+		wantLines    bool
+	}{
+		{
+			name:         "Plain cassette",
+			cassetteName: "temp-fixtures/Test_cassette_JSONLines.jsonl",
+			wantLines:    true,
+		},
+		{
+			name:         "Long Play cassette",
+			cassetteName: "temp-fixtures/Test_cassette_JSONLines.jsonl.gz",
+		},
+		{
+			name:         "Encrypted cassette",
+			cassetteName: "temp-fixtures/Test_cassette_JSONLines_Encrypted.jsonl",
+			opts:         []cassette.Option{cassette.WithCrypter(c)},
+			wantLines:    true,
+		},
+		{
+			name:         "Encrypted Long Play cassette",
+			cassetteName: "temp-fixtures/Test_cassette_JSONLines_Encrypted.jsonl.gz",
+			opts:         []cassette.Option{cassette.WithCrypter(c)},
+			wantLines:    true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_ = os.Remove(tc.cassetteName)
+
+			// STEP 1: record a track on a new cassette.
+			k7 := cassette.LoadCassette(tc.cassetteName, tc.opts...)
+			err := cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"})
+			require.NoError(t, err)
+
+			data1, err := os.ReadFile(tc.cassetteName)
+			require.NoError(t, err)
+
+			// STEP 2: record a track on the existing cassette, it must be appended.
+			k7 = cassette.LoadCassette(tc.cassetteName, tc.opts...)
+			require.EqualValues(t, 1, k7.NumberOfTracks())
+
+			err = cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"})
+			require.NoError(t, err)
+
+			data2, err := os.ReadFile(tc.cassetteName)
+			require.NoError(t, err)
+			require.True(t, bytes.HasPrefix(data2, data1))
+
+			if tc.wantLines {
+				assert.Equal(t, 2, bytes.Count(data2, []byte{'\n'}))
+			}
+
+			// STEP 3: ensure all tracks load.
+			k8 := cassette.LoadCassette(tc.cassetteName, tc.opts...)
+			require.EqualValues(t, 2, k8.NumberOfTracks())
+			assert.Equal(t, "trk-1", k8.Tracks[0].UUID)
+			assert.Equal(t, "trk-2", k8.Tracks[1].UUID)
+		})
+	}
+}
+
+func Test_cassette_JSONLinesCanEncryptPlainCassette(t *testing.T) {
+	const cassetteName = "temp-fixtures/Test_cassette_JSONLinesCanEncryptPlainCassette.jsonl"
+
+	_ = os.Remove(cassetteName)
+
+	k7 := cassette.LoadCassette(cassetteName)
+	err := cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"})
+	require.NoError(t, err)
+
+	key := []byte("12345678901234567890123456789012")
+	c, err := encryption.NewAESGCMWithRandomNonceGenerator(key)
+	require.NoError(t, err)
+
+	k7 = cassette.LoadCassette(cassetteName, cassette.WithCrypter(c))
+	err = cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"})
+	require.NoError(t, err)
+
+	// the cassette must have been re-written rather than appended to
+	data, err := os.ReadFile(cassetteName)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "trk-1")
+
+	k8 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(c))
+	require.EqualValues(t, 2, k8.NumberOfTracks())
+}
+
+func Test_cassette_Directory(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+	c, err := encryption.NewAESGCMWithRandomNonceGenerator(key)
+	require.NoError(t, err)
+
+	tt := []*struct {
+		name         string
+		cassetteName string
+		opts         []cassette.Option
+		wantTrackExt string
+	}{
+		{
+			name:         "Plain cassette",
+			cassetteName: "temp-fixtures/Test_cassette_Directory/",
+			wantTrackExt: ".json",
+		},
+		{
+			name:         "Long Play cassette",
+			cassetteName: "temp-fixtures/Test_cassette_Directory.gz/",
+			wantTrackExt: ".json.gz",
+		},
+		{
+			name:         "Encrypted cassette",
+			cassetteName: "temp-fixtures/Test_cassette_Directory_Encrypted/",
+			opts:         []cassette.Option{cassette.WithCrypter(c)},
+			wantTrackExt: ".json",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_ = os.RemoveAll(tc.cassetteName)
+
+			// STEP 1: record tracks on a new cassette.
+			k7 := cassette.LoadCassette(tc.cassetteName, tc.opts...)
+			require.True(t, k7.IsDirectory())
+
+			err := cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"})
+			require.NoError(t, err)
+			err = cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"})
+			require.NoError(t, err)
+
+			trk1Data, err := os.ReadFile(tc.cassetteName + "trk-1" + tc.wantTrackExt)
+			require.NoError(t, err)
+
+			index, err := os.ReadFile(tc.cassetteName + "index.json")
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"Tracks":["trk-1`+tc.wantTrackExt+`","trk-2`+tc.wantTrackExt+`"]}`, string(index))
+
+			// STEP 2: replace a track on the existing cassette, other track files must be untouched.
+			k7 = cassette.LoadCassette(tc.cassetteName, tc.opts...)
+			require.EqualValues(t, 2, k7.NumberOfTracks())
+
+			err = cassette.ReplaceTrackOnCassette(k7, 1, &track.Track{UUID: "trk-3"})
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(tc.cassetteName + "trk-1" + tc.wantTrackExt)
+			require.NoError(t, err)
+			assert.Equal(t, trk1Data, data)
+
+			_, err = os.Stat(tc.cassetteName + "trk-2" + tc.wantTrackExt)
+			assert.True(t, os.IsNotExist(err))
+
+			// STEP 3: ensure all tracks load.
+			k8 := cassette.LoadCassette(tc.cassetteName, tc.opts...)
+			require.EqualValues(t, 2, k8.NumberOfTracks())
+			assert.Equal(t, "trk-1", k8.Tracks[0].UUID)
+			assert.Equal(t, "trk-3", k8.Tracks[1].UUID)
+
+			// STEP 4: replace a track with a track of the same UUID, its file must be re-written.
+			err = cassette.ReplaceTrackOnCassette(k8, 0, &track.Track{UUID: "trk-1", Request: track.Request{Method: http.MethodPost}})
+			require.NoError(t, err)
+
+			k9 := cassette.LoadCassette(tc.cassetteName, tc.opts...)
+			require.EqualValues(t, 2, k9.NumberOfTracks())
+			assert.Equal(t, http.MethodPost, k9.Tracks[0].Request.Method)
+		})
+	}
+}
+
+func Test_cassette_Directory_TracksWithoutUUID(t *testing.T) {
+	const cassetteName = "temp-fixtures/Test_cassette_Directory_TracksWithoutUUID/"
+
+	_ = os.RemoveAll(cassetteName)
+
+	// STEP 1: a cassette with the track files of an earlier version, named after the track number.
+	require.NoError(t, os.MkdirAll(cassetteName, 0o750))
+	require.NoError(t, os.WriteFile(cassetteName+"index.json", []byte(`{"Tracks":["track-0000.json","track-0001.json"]}`), 0o600))
+	require.NoError(t, os.WriteFile(cassetteName+"track-0000.json", []byte(`{"Request":{"Method":"GET"}}`), 0o600))
+	require.NoError(t, os.WriteFile(cassetteName+"track-0001.json", []byte(`{"Request":{"Method":"POST"}}`), 0o600))
+
+	// STEP 2: the tracks are saved under their UUID and the former track files are removed.
+	k7 := cassette.LoadCassette(cassetteName)
+	require.EqualValues(t, 2, k7.NumberOfTracks())
+
+	err := cassette.AddTrackToCassette(k7, &track.Track{Request: track.Request{Method: http.MethodPut}})
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(cassetteName)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), "track-")
+	}
+
+	k8 := cassette.LoadCassette(cassetteName)
+	require.EqualValues(t, 3, k8.NumberOfTracks())
+	assert.Equal(t, http.MethodGet, k8.Tracks[0].Request.Method)
+	assert.Equal(t, http.MethodPost, k8.Tracks[1].Request.Method)
+	assert.Equal(t, http.MethodPut, k8.Tracks[2].Request.Method)
+	assert.NotEmpty(t, k8.Tracks[0].UUID)
+
+	// STEP 3: a pruned track file is removed.
+	k8.Tracks[0].SetReplayed(true)
+	k8.Tracks[2].SetReplayed(true)
+
+	pruned, err := k8.PruneUnusedTracks()
+	require.NoError(t, err)
+	require.Equal(t, 1, pruned)
+
+	entries, err = os.ReadDir(cassetteName)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+}
+
+func Test_cassette_Directory_InvalidTrackFileNames(t *testing.T) {
+	const cassetteName = "temp-fixtures/Test_cassette_Directory_InvalidTrackFileNames/cassette/"
+
+	_ = os.RemoveAll("temp-fixtures/Test_cassette_Directory_InvalidTrackFileNames/")
+
+	victim := "temp-fixtures/Test_cassette_Directory_InvalidTrackFileNames/victim.json"
+
+	// STEP 1: an index entry outside the cassette directory is rejected on load.
+	require.NoError(t, os.MkdirAll(cassetteName, 0o750))
+	require.NoError(t, os.WriteFile(victim, []byte(`{"Request":{"Method":"GET"}}`), 0o600))
+	require.NoError(t, os.WriteFile(cassetteName+"index.json", []byte(`{"Tracks":["../victim.json"]}`), 0o600))
+
+	require.Panics(t, func() {
+		_ = cassette.LoadCassette(cassetteName)
+	})
+
+	_, err := os.Stat(victim)
+	require.NoError(t, err)
+
+	// STEP 2: a track UUID outside the cassette directory is rejected on save.
+	require.NoError(t, os.Remove(cassetteName+"index.json"))
+
+	k7 := cassette.LoadCassette(cassetteName)
+
+	err = cassette.AddTrackToCassette(k7, &track.Track{UUID: "../escaped"})
+	require.EqualError(t, err, "invalid cassette track file name: '../escaped.json'")
+
+	_, err = os.Stat("temp-fixtures/Test_cassette_Directory_InvalidTrackFileNames/escaped.json")
+	assert.True(t, os.IsNotExist(err))
+}
+
 func Test_cassette_GunzipFilter(t *testing.T) {
 	tt := []*struct {
 		name         string
@@ -171,12 +597,20 @@ func Test_cassette_Encryption(t *testing.T) {
 	data, err := os.ReadFile(cassetteName)
 	require.NoError(t, err)
 
-	const encryptedCassetteHeader = "$ENC:V2$"
+	const encryptedCassetteHeader = "$ENC:V4$"
 
 	require.True(t, bytes.HasPrefix(data, []byte(encryptedCassetteHeader)))
 
-	nonceLen := int(data[len(encryptedCassetteHeader)])
-	nonce := data[len(encryptedCassetteHeader)+1 : len(encryptedCassetteHeader)+1+nonceLen]
+	// header fields: tag (1 byte), length (2 bytes), value - the cipher kind is followed by the nonce
+	pos := len(encryptedCassetteHeader)
+	require.EqualValues(t, 1, data[pos])
+	kindLen := int(binary.BigEndian.Uint16(data[pos+1:]))
+	require.Equal(t, "aesgcm", string(data[pos+3:pos+3+kindLen]))
+
+	pos += 3 + kindLen
+	require.EqualValues(t, 3, data[pos])
+	nonceLen := int(binary.BigEndian.Uint16(data[pos+1:]))
+	nonce := data[pos+3 : pos+3+nonceLen]
 
 	t.Logf("nonce: %x\n", nonce)
 
@@ -226,12 +660,20 @@ func Test_cassette_CanEncryptPlainCassette(t *testing.T) {
 	data, err := os.ReadFile(cassetteName)
 	require.NoError(t, err)
 
-	const encryptedCassetteHeader = "$ENC:V2$"
+	const encryptedCassetteHeader = "$ENC:V4$"
 
 	require.True(t, bytes.HasPrefix(data, []byte(encryptedCassetteHeader)))
 
-	nonceLen := int(data[len(encryptedCassetteHeader)])
-	nonce := data[len(encryptedCassetteHeader)+1 : len(encryptedCassetteHeader)+1+nonceLen]
+	// header fields: tag (1 byte), length (2 bytes), value - the cipher kind is followed by the nonce
+	pos := len(encryptedCassetteHeader)
+	require.EqualValues(t, 1, data[pos])
+	kindLen := int(binary.BigEndian.Uint16(data[pos+1:]))
+	require.Equal(t, "aesgcm", string(data[pos+3:pos+3+kindLen]))
+
+	pos += 3 + kindLen
+	require.EqualValues(t, 3, data[pos])
+	nonceLen := int(binary.BigEndian.Uint16(data[pos+1:]))
+	nonce := data[pos+3 : pos+3+nonceLen]
 
 	t.Logf("nonce: %x\n", nonce)
 
@@ -244,19 +686,797 @@ func Test_cassette_CanEncryptPlainCassette(t *testing.T) {
 	require.Equal(t, k7.Tracks, k8.Tracks)
 }
 
-type StoreMock struct {
-	Data []byte
-}
+func Test_cassette_KeyRotation(t *testing.T) {
+	const cassetteName = "temp-fixtures/Test_cassette_KeyRotation"
 
-func (s *StoreMock) MkdirAll(_ string, _ os.FileMode) error {
-	return nil
-}
+	_ = os.Remove(cassetteName)
 
-func (s *StoreMock) ReadFile(_ string) ([]byte, error) {
-	return nil, nil
+	oldCrypter, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	newCrypter, err := encryption.NewChaCha20Poly1305WithRandomNonceGenerator([]byte("abcdefghijklmnopqrstuvwxyz123456"))
+	require.NoError(t, err)
+
+	// STEP 1: create a cassette encrypted with the old key, without a key ID.
+	k7 := cassette.NewCassette(cassetteName, cassette.WithCrypter(oldCrypter))
+	err = cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(cassetteName)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("$ENC:V4$")))
+
+	// STEP 2: load the cassette with a keyring that holds the old key as a previous key.
+	keyring, err := encryption.NewKeyring(
+		encryption.KeyedCrypter{KeyID: "key-2", Crypter: newCrypter},
+		encryption.KeyedCrypter{Crypter: oldCrypter},
+	)
+	require.NoError(t, err)
+
+	k7 = cassette.LoadCassette(cassetteName, cassette.WithCrypter(keyring))
+	require.EqualValues(t, 1, k7.NumberOfTracks())
+
+	// STEP 3: the cassette is re-encrypted with the primary key when next saved.
+	err = cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"})
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(cassetteName)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("$ENC:V4$")))
+	require.Contains(t, string(data[:64]), "key-2")
+
+	// STEP 4: the old key alone can no longer decrypt the cassette, the primary key can.
+	require.Panics(t, func() {
+		cassette.LoadCassette(cassetteName, cassette.WithCrypter(oldCrypter))
+	})
+
+	primaryOnly, err := encryption.NewKeyring(encryption.KeyedCrypter{KeyID: "key-2", Crypter: newCrypter})
+	require.NoError(t, err)
+
+	k8 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(primaryOnly))
+	require.EqualValues(t, 2, k8.NumberOfTracks())
 }
 
-func (s *StoreMock) WriteFile(_ string, data []byte, _ os.FileMode) error {
+func Test_cassette_ReEncryptFile(t *testing.T) {
+	oldCrypter, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	newCrypter, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("abcdefghijklmnopqrstuvwxyz123456"))
+	require.NoError(t, err)
+
+	keyring, err := encryption.NewKeyring(
+		encryption.KeyedCrypter{KeyID: "key-2", Crypter: newCrypter},
+		encryption.KeyedCrypter{KeyID: "key-1", Crypter: oldCrypter},
+	)
+	require.NoError(t, err)
+
+	tt := []string{
+		"temp-fixtures/Test_cassette_ReEncryptFile.json",
+		"temp-fixtures/Test_cassette_ReEncryptFile.json.gz",
+		"temp-fixtures/Test_cassette_ReEncryptFile.jsonl",
+	}
+
+	for _, cassetteName := range tt {
+		t.Run(cassetteName, func(t *testing.T) {
+			_ = os.Remove(cassetteName)
+
+			k7 := cassette.NewCassette(cassetteName, cassette.WithCrypter(oldCrypter))
+			require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"}))
+			require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"}))
+
+			store := &fileio.OSFile{}
+
+			rotated, err := cassette.ReEncryptFile(store, cassetteName, keyring, nil)
+			require.NoError(t, err)
+			require.True(t, rotated)
+
+			// already encrypted with the primary key
+			rotated, err = cassette.ReEncryptFile(store, cassetteName, keyring, nil)
+			require.NoError(t, err)
+			require.False(t, rotated)
+
+			require.Panics(t, func() {
+				cassette.LoadCassette(cassetteName, cassette.WithCrypter(oldCrypter))
+			})
+
+			k8 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(newCrypter))
+			require.EqualValues(t, 2, k8.NumberOfTracks())
+		})
+	}
+
+	t.Run("plain cassette", func(t *testing.T) {
+		const cassetteName = "temp-fixtures/Test_cassette_ReEncryptFile_Plain.json"
+
+		_ = os.Remove(cassetteName)
+
+		k7 := cassette.NewCassette(cassetteName)
+		require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"}))
+
+		rotated, err := cassette.ReEncryptFile(&fileio.OSFile{}, cassetteName, keyring, nil)
+		require.NoError(t, err)
+		require.False(t, rotated)
+	})
+
+	t.Run("signed cassette", func(t *testing.T) {
+		const cassetteName = "temp-fixtures/Test_cassette_ReEncryptFile_Signed.json"
+
+		_ = os.Remove(cassetteName)
+
+		signer, err := encryption.NewHMACSigner([]byte("12345678901234567890123456789012"))
+		require.NoError(t, err)
+
+		k7 := cassette.NewCassette(cassetteName, cassette.WithCrypter(oldCrypter), cassette.WithSigner(signer))
+		require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"}))
+
+		store := &fileio.OSFile{}
+
+		signed, err := cassette.IsSigned(store, cassetteName)
+		require.NoError(t, err)
+		require.True(t, signed)
+
+		// a signed cassette is not re-written without a signer.
+		_, err = cassette.ReEncryptFile(store, cassetteName, keyring, nil)
+		require.ErrorContains(t, err, "a signer is required")
+
+		rotated, err := cassette.ReEncryptFile(store, cassetteName, keyring, signer)
+		require.NoError(t, err)
+		require.True(t, rotated)
+
+		require.NoError(t, cassette.VerifyCassette(store, cassetteName, signer))
+
+		k8 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(newCrypter), cassette.WithSigner(signer))
+		require.EqualValues(t, 1, k8.NumberOfTracks())
+	})
+}
+
+func Test_cassette_EnvelopeEncryption(t *testing.T) {
+	const cassetteName = "temp-fixtures/Test_cassette_EnvelopeEncryption.json.gz"
+
+	_ = os.Remove(cassetteName)
+
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	publicWrapper, err := encryption.NewX25519KeyWrapper(privateKey.PublicKey(), nil)
+	require.NoError(t, err)
+
+	encrypter, err := encryption.NewEnvelopeCrypter(publicWrapper, encryption.NewAESGCMWithRandomNonceGenerator)
+	require.NoError(t, err)
+
+	// STEP 1: record a cassette with the public key only.
+	k7 := cassette.NewCassette(cassetteName, cassette.WithCrypter(encrypter))
+	require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"}))
+
+	data, err := os.ReadFile(cassetteName)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("$ENC:V4$")))
+
+	// STEP 2: the public key cannot load the cassette, the private key can.
+	require.Panics(t, func() {
+		cassette.LoadCassette(cassetteName, cassette.WithCrypter(encrypter))
+	})
+
+	wrapper, err := encryption.NewX25519KeyWrapper(nil, privateKey)
+	require.NoError(t, err)
+
+	decrypter, err := encryption.NewEnvelopeCrypter(wrapper, encryption.NewAESGCMWithRandomNonceGenerator)
+	require.NoError(t, err)
+
+	k8 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(decrypter))
+	require.EqualValues(t, 1, k8.NumberOfTracks())
+	require.Equal(t, "trk-1", k8.Track(0).UUID)
+
+	// STEP 3: a different payload cipher is rejected.
+	otherDecrypter, err := encryption.NewEnvelopeCrypter(wrapper, encryption.NewChaCha20Poly1305WithRandomNonceGenerator)
+	require.NoError(t, err)
+
+	require.Panics(t, func() {
+		cassette.LoadCassette(cassetteName, cassette.WithCrypter(otherDecrypter))
+	})
+}
+
+func Test_cassette_LogicalName(t *testing.T) {
+	const (
+		cassetteName     = "temp-fixtures/Test_cassette_LogicalName.json"
+		copyCassetteName = "temp-fixtures/Test_cassette_LogicalName_Copy.json"
+	)
+
+	_ = os.Remove(cassetteName)
+
+	c, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	k7 := cassette.NewCassette(cassetteName, cassette.WithCrypter(c), cassette.WithLogicalName("cassette-a"))
+	require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"}))
+
+	data, err := os.ReadFile(cassetteName)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(copyCassetteName, data, 0o600))
+
+	k8 := cassette.LoadCassette(copyCassetteName, cassette.WithCrypter(c), cassette.WithLogicalName("cassette-a"))
+	require.EqualValues(t, 1, k8.NumberOfTracks())
+
+	require.Panics(t, func() {
+		cassette.LoadCassette(copyCassetteName, cassette.WithCrypter(c), cassette.WithLogicalName("cassette-b"))
+	})
+
+	require.Panics(t, func() {
+		cassette.LoadCassette(copyCassetteName, cassette.WithCrypter(c))
+	})
+
+	// a cassette that is not bound to a logical name cannot be swapped in either.
+	unbound := cassette.NewCassette(copyCassetteName, cassette.WithCrypter(c))
+	require.NoError(t, cassette.AddTrackToCassette(unbound, &track.Track{UUID: "trk-2"}))
+	require.EqualValues(t, 1, cassette.LoadCassette(copyCassetteName, cassette.WithCrypter(c)).NumberOfTracks())
+
+	require.Panics(t, func() {
+		cassette.LoadCassette(copyCassetteName, cassette.WithCrypter(c), cassette.WithLogicalName("cassette-a"))
+	})
+}
+
+func Test_cassette_EncryptionV2Migration(t *testing.T) {
+	const cassetteName = "temp-fixtures/Test_cassette_EncryptionV2Migration.json"
+
+	data, err := os.ReadFile("../cmd/govcr/test-fixtures/TestExample4.cassette.enc_v2.json")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll("temp-fixtures", 0o750))
+	require.NoError(t, os.WriteFile(cassetteName, data, 0o600))
+
+	key, err := os.ReadFile("../cmd/govcr/test-fixtures/TestExample4.unsafe.key")
+	require.NoError(t, err)
+
+	c, err := encryption.NewAESGCMWithRandomNonceGenerator(key)
+	require.NoError(t, err)
+
+	// the V2 cassette is read and it is saved with the V4 header.
+	k7 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(c))
+	require.EqualValues(t, 1, k7.NumberOfTracks())
+	require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"}))
+
+	data, err = os.ReadFile(cassetteName)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("$ENC:V4$")))
+
+	k8 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(c))
+	require.EqualValues(t, 2, k8.NumberOfTracks())
+}
+
+func Test_cassette_EncryptionV2Migration_LogicalName(t *testing.T) {
+	const cassetteName = "temp-fixtures/Test_cassette_EncryptionV2Migration_LogicalName.json"
+
+	data, err := os.ReadFile("../cmd/govcr/test-fixtures/TestExample4.cassette.enc_v2.json")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll("temp-fixtures", 0o750))
+	require.NoError(t, os.WriteFile(cassetteName, data, 0o600))
+
+	key, err := os.ReadFile("../cmd/govcr/test-fixtures/TestExample4.unsafe.key")
+	require.NoError(t, err)
+
+	c, err := encryption.NewAESGCMWithRandomNonceGenerator(key)
+	require.NoError(t, err)
+
+	// the unnamed V2 cassette is refused under a logical name, such that it cannot be swapped in.
+	require.Panics(t, func() {
+		cassette.LoadCassette(cassetteName, cassette.WithCrypter(c), cassette.WithLogicalName("cassette-a"))
+	})
+
+	// the migration reads the unnamed V2 cassette and binds it to the logical name when it is
+	// saved.
+	k7 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(c), cassette.WithLogicalName("cassette-a"), cassette.WithLogicalNameMigration())
+	require.EqualValues(t, 1, k7.NumberOfTracks())
+	require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"}))
+
+	k8 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(c), cassette.WithLogicalName("cassette-a"))
+	require.EqualValues(t, 2, k8.NumberOfTracks())
+
+	require.Panics(t, func() {
+		cassette.LoadCassette(cassetteName, cassette.WithCrypter(c), cassette.WithLogicalName("cassette-b"))
+	})
+
+	require.Panics(t, func() {
+		cassette.LoadCassette(cassetteName, cassette.WithCrypter(c))
+	})
+}
+
+func Test_cassette_FieldEncryption(t *testing.T) {
+	c, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	fields := cassette.FieldSelection{
+		Headers:   []string{"Authorization", "Set-Cookie"},
+		BodyPaths: []string{"user.password", "items.*.token"},
+		BodyHosts: []string{"vault.example.com"},
+	}
+
+	newTrack := func(uuid, rawURL string, reqBody, respBody []byte) *track.Track {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+
+		return &track.Track{
+			UUID: uuid,
+			Request: track.Request{
+				Method: http.MethodPost,
+				URL:    u,
+				Header: http.Header{"Authorization": {"Bearer s3cr3t-t0k3n"}, "Accept": {"application/json"}},
+				Body:   reqBody,
+			},
+			Response: &track.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Set-Cookie": {"session=s3cr3t-c00k1e"}},
+				Body:       respBody,
+			},
+		}
+	}
+
+	trk1 := newTrack(
+		"trk-1",
+		"https://api.example.com/login",
+		[]byte(`{"user":{"name":"bob","password":"s3cr3t-p4ss"}}`),
+		[]byte(`{"items":[{"id":1,"token":"s3cr3t-1"},{"id":2,"token":{"value":"s3cr3t-2"}}]}`),
+	)
+	trk2 := newTrack("trk-2", "https://vault.example.com:8443/secret", nil, []byte("s3cr3t-v4ult"))
+	trk3 := newTrack("trk-3", "https://api.example.com/other", nil, []byte("not JSON"))
+
+	// rawTracks returns the tracks of the cassette in storage, as they are recorded.
+	rawTracks := func(t *testing.T, cassetteName string) []track.Track {
+		t.Helper()
+
+		data, err := os.ReadFile(cassetteName)
+		require.NoError(t, err)
+		require.NotContains(t, string(data), "s3cr3t")
+
+		if cassette.NewCassette(cassetteName).IsJSONLines() {
+			data = append([]byte(`{"Tracks":[`), append(bytes.ReplaceAll(bytes.TrimSpace(data), []byte{'\n'}, []byte{','}), []byte(`]}`)...)...)
+		}
+
+		var k7 struct{ Tracks []track.Track }
+		require.NoError(t, json.Unmarshal(data, &k7))
+
+		for _, trk := range k7.Tracks {
+			require.NotContains(t, string(trk.Request.Body), "s3cr3t")
+			require.NotContains(t, string(trk.Response.Body), "s3cr3t")
+		}
+
+		return k7.Tracks
+	}
+
+	for _, cassetteName := range []string{
+		"temp-fixtures/Test_cassette_FieldEncryption.json",
+		"temp-fixtures/Test_cassette_FieldEncryption.jsonl",
+	} {
+		t.Run(cassetteName, func(t *testing.T) {
+			_ = os.Remove(cassetteName)
+
+			k7 := cassette.LoadCassette(cassetteName, cassette.WithFieldEncryption(c, fields))
+			require.NoError(t, cassette.AddTrackToCassette(k7, trk1))
+			require.NoError(t, cassette.AddTrackToCassette(k7, trk2))
+
+			tracks := rawTracks(t, cassetteName)
+			require.Len(t, tracks, 2)
+			assert.Equal(t, "application/json", tracks[0].Request.Header.Get("Accept"))
+			assert.True(t, strings.HasPrefix(tracks[0].Request.Header.Get("Authorization"), "$ENC:FIELD$"))
+			assert.True(t, strings.HasPrefix(tracks[0].Response.Header.Get("Set-Cookie"), "$ENC:FIELD$"))
+			assert.Contains(t, string(tracks[0].Request.Body), `"name":"bob"`)
+			assert.Contains(t, string(tracks[0].Response.Body), `"id":2`)
+			assert.True(t, bytes.HasPrefix(tracks[1].Response.Body, []byte("$ENC:FIELD$")))
+
+			// the encrypted fields are found on the cassette in storage.
+			found, err := cassette.FindEncryptedFields(cassetteName)
+			require.NoError(t, err)
+			require.NotNil(t, found)
+			assert.Equal(t, "aesgcm", found.Kind)
+			assert.Empty(t, found.LogicalName)
+			assert.ElementsMatch(t, []string{"Authorization", "Set-Cookie"}, found.Fields.Headers)
+			assert.Equal(t, []string{"user.password", "items.0.token", "items.1.token"}, found.Fields.BodyPaths)
+			assert.Equal(t, []string{"vault.example.com:8443"}, found.Fields.BodyHosts)
+
+			// the encrypted fields are decrypted when the cassette is loaded.
+			k8 := cassette.LoadCassette(cassetteName, cassette.WithFieldEncryption(c, fields))
+			require.EqualValues(t, 2, k8.NumberOfTracks())
+			assert.Equal(t, trk1.Request.Header, k8.Track(0).Request.Header)
+			assert.Equal(t, trk1.Response.Header, k8.Track(0).Response.Header)
+			assert.JSONEq(t, string(trk1.Request.Body), string(k8.Track(0).Request.Body))
+			assert.JSONEq(t, string(trk1.Response.Body), string(k8.Track(0).Response.Body))
+			assert.Equal(t, trk2.Response.Body, k8.Track(1).Response.Body)
+
+			// the tracks that have not changed are not altered when the cassette is saved.
+			require.NoError(t, cassette.AddTrackToCassette(k8, trk3))
+
+			newTracks := rawTracks(t, cassetteName)
+			require.Len(t, newTracks, 3)
+			assert.Equal(t, tracks, newTracks[:2])
+			assert.Equal(t, trk3.Response.Body, newTracks[2].Response.Body)
+
+			require.Panics(t, func() {
+				cassette.LoadCassette(cassetteName)
+			})
+
+			// equal values are encrypted with a fresh nonce.
+			assert.NotEqual(t, tracks[0].Request.Header.Get("Authorization"), tracks[1].Request.Header.Get("Authorization"))
+
+			// the encrypted values are bound to their field: they cannot be swapped.
+			data, err := os.ReadFile(cassetteName)
+			require.NoError(t, err)
+
+			swapped := bytes.ReplaceAll(data, []byte(tracks[0].Response.Header.Get("Set-Cookie")), []byte(tracks[0].Request.Header.Get("Authorization")))
+			require.NoError(t, os.WriteFile(cassetteName, swapped, 0o600))
+
+			require.Panics(t, func() {
+				cassette.LoadCassette(cassetteName, cassette.WithFieldEncryption(c, fields))
+			})
+		})
+	}
+}
+
+func Test_cassette_FieldEncryption_PlainValuesWithMarker(t *testing.T) {
+	c, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	newTrack := func() *track.Track {
+		return &track.Track{
+			UUID: "trk-1",
+			Request: track.Request{
+				Method: http.MethodPost,
+				Header: http.Header{"X-Note": {"$ENC:FIELD$not encrypted", "$$ENC:FIELD$"}},
+				Body:   []byte(`{"note":"$ENC:FIELD$not encrypted","password":"$ENC:FIELD$s3cr3t"}`),
+			},
+			Response: &track.Response{
+				Body: []byte("$ENC:FIELD$ is the marker of the encrypted fields"),
+			},
+		}
+	}
+
+	for name, opts := range map[string][]cassette.Option{
+		"Plain cassette": nil,
+		"Cassette with field-level encryption": {
+			cassette.WithFieldEncryption(c, cassette.FieldSelection{BodyPaths: []string{"password"}}),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cassetteName := "temp-fixtures/Test_cassette_FieldEncryption_PlainValuesWithMarker.json"
+
+			_ = os.Remove(cassetteName)
+
+			k7 := cassette.LoadCassette(cassetteName, opts...)
+			require.NoError(t, cassette.AddTrackToCassette(k7, newTrack()))
+
+			k8 := cassette.LoadCassette(cassetteName, opts...)
+			require.EqualValues(t, 1, k8.NumberOfTracks())
+
+			want := newTrack()
+			assert.Equal(t, want.Request.Header, k8.Track(0).Request.Header)
+			assert.Equal(t, string(want.Request.Body), string(k8.Track(0).Request.Body))
+			assert.Equal(t, string(want.Response.Body), string(k8.Track(0).Response.Body))
+		})
+	}
+}
+
+func Test_cassette_ReplaceTracks(t *testing.T) {
+	for _, cassetteName := range []string{
+		"temp-fixtures/Test_cassette_ReplaceTracks.json",
+		"temp-fixtures/Test_cassette_ReplaceTracks.jsonl",
+		"temp-fixtures/Test_cassette_ReplaceTracks/",
+	} {
+		t.Run(cassetteName, func(t *testing.T) {
+			_ = os.RemoveAll(cassetteName)
+
+			k7 := cassette.NewCassette(cassetteName)
+			require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"}))
+			require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"}))
+
+			k8 := cassette.LoadCassette(cassetteName, cassette.WithDeferredPersistence(0))
+			require.NoError(t, k8.ReplaceTracks([]track.Track{{UUID: "trk-3"}}))
+			require.NoError(t, k8.Eject())
+
+			k9 := cassette.LoadCassette(cassetteName)
+			require.EqualValues(t, 1, k9.NumberOfTracks())
+			assert.Equal(t, "trk-3", k9.Tracks[0].UUID)
+
+			// a cassette left with no tracks is saved too.
+			require.NoError(t, k9.ReplaceTracks(nil))
+
+			_, err := os.Stat(cassetteName)
+			require.NoError(t, err)
+
+			k10 := cassette.LoadCassette(cassetteName)
+			require.Zero(t, k10.NumberOfTracks())
+		})
+	}
+}
+
+func Test_cassette_Signature(t *testing.T) {
+	signer, err := encryption.NewHMACSigner([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	otherSigner, err := encryption.NewHMACSigner([]byte("98765432109876543210987654321098"))
+	require.NoError(t, err)
+
+	store := &fileio.OSFile{}
+
+	tt := []*struct {
+		name         string
+		cassetteName string
+		tamperedFile string
+	}{
+		{
+			name:         "Cassette",
+			cassetteName: "temp-fixtures/Test_cassette_Signature.json",
+			tamperedFile: "temp-fixtures/Test_cassette_Signature.json",
+		},
+		{
+			name:         "JSON Lines cassette",
+			cassetteName: "temp-fixtures/Test_cassette_Signature.jsonl",
+			tamperedFile: "temp-fixtures/Test_cassette_Signature.jsonl",
+		},
+		{
+			name:         "Directory cassette",
+			cassetteName: "temp-fixtures/Test_cassette_Signature/",
+			tamperedFile: "temp-fixtures/Test_cassette_Signature/trk-1.json",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_ = os.RemoveAll(tc.cassetteName)
+
+			// STEP 1: the cassette files are signed when they are saved.
+			k7 := cassette.LoadCassette(tc.cassetteName, cassette.WithSigner(signer))
+			require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"}))
+			require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"}))
+
+			k8 := cassette.LoadCassette(tc.cassetteName, cassette.WithSigner(signer))
+			require.EqualValues(t, 2, k8.NumberOfTracks())
+			require.NoError(t, cassette.VerifyCassette(store, tc.cassetteName, signer))
+
+			var tamperedErr *govcrerr.ErrTamperedCassette
+
+			err := cassette.VerifyCassette(store, tc.cassetteName, otherSigner)
+			require.ErrorAs(t, err, &tamperedErr)
+
+			// STEP 2: a hand edit is detected.
+			data, err := os.ReadFile(tc.tamperedFile)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(tc.tamperedFile, bytes.Replace(data, []byte("trk-1"), []byte("trk-X"), 1), 0o600))
+
+			err = cassette.VerifyCassette(store, tc.cassetteName, signer)
+			require.ErrorAs(t, err, &tamperedErr)
+			assert.Equal(t, tc.tamperedFile, tamperedErr.FileName)
+
+			require.Panics(t, func() {
+				cassette.LoadCassette(tc.cassetteName, cassette.WithSigner(signer))
+			})
+
+			// STEP 3: signing the cassette approves the hand edit.
+			require.NoError(t, cassette.SignCassette(store, tc.cassetteName, signer))
+
+			k9 := cassette.LoadCassette(tc.cassetteName, cassette.WithSigner(signer))
+			require.EqualValues(t, 2, k9.NumberOfTracks())
+			assert.Equal(t, "trk-X", k9.Tracks[0].UUID)
+
+			// STEP 4: a missing signature is detected.
+			require.NoError(t, os.Remove(tc.tamperedFile+".sig"))
+
+			err = cassette.VerifyCassette(store, tc.cassetteName, signer)
+			require.ErrorAs(t, err, &tamperedErr)
+			assert.Equal(t, "the signature file is missing", tamperedErr.Reason)
+		})
+	}
+}
+
+func Test_cassette_Streaming(t *testing.T) {
+	aesCrypter, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	chachaCrypter, err := encryption.NewChaCha20Poly1305WithRandomNonceGenerator([]byte("abcdefghijklmnopqrstuvwxyz123456"))
+	require.NoError(t, err)
+
+	keyring, err := encryption.NewKeyring(encryption.KeyedCrypter{KeyID: "key-2", Crypter: chachaCrypter})
+	require.NoError(t, err)
+
+	// a large body that spans many chunks.
+	body := make([]byte, 200*1024)
+	_, err = rand.Read(body)
+	require.NoError(t, err)
+
+	tt := []*struct {
+		name         string
+		cassetteName string
+		crypter      cassette.Crypter
+	}{
+		{
+			name:         "Plain cassette",
+			cassetteName: "temp-fixtures/Test_cassette_Streaming.json",
+		},
+		{
+			name:         "Compressed cassette",
+			cassetteName: "temp-fixtures/Test_cassette_Streaming.json.gz",
+		},
+		{
+			name:         "Encrypted cassette",
+			cassetteName: "temp-fixtures/Test_cassette_Streaming_Encrypted.json",
+			crypter:      aesCrypter,
+		},
+		{
+			name:         "Compressed, encrypted cassette with a keyring",
+			cassetteName: "temp-fixtures/Test_cassette_Streaming_Keyring.json.gz",
+			crypter:      keyring,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_ = os.Remove(tc.cassetteName)
+
+			opts := []cassette.Option{cassette.WithStreaming(4096), cassette.WithLogicalName("my-cassette")}
+			if tc.crypter != nil {
+				opts = append(opts, cassette.WithCrypter(tc.crypter))
+			}
+
+			// STEP 1: the cassette is saved as a stream.
+			k7 := cassette.LoadCassette(tc.cassetteName, opts...)
+			require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1", Response: &track.Response{Body: body}}))
+			require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-2"}))
+
+			data, err := os.ReadFile(tc.cassetteName)
+			require.NoError(t, err)
+
+			if tc.crypter != nil {
+				require.True(t, bytes.HasPrefix(data, []byte("$ENC:STREAM$")))
+			}
+
+			// STEP 2: the cassette loads, with or without the streaming option.
+			k8 := cassette.LoadCassette(tc.cassetteName, opts...)
+			require.EqualValues(t, 2, k8.NumberOfTracks())
+			assert.Equal(t, body, k8.Tracks[0].Response.Body)
+			assert.Equal(t, "trk-2", k8.Tracks[1].UUID)
+
+			k9 := cassette.LoadCassette(tc.cassetteName, opts[1:]...)
+			require.EqualValues(t, 2, k9.NumberOfTracks())
+			assert.Equal(t, body, k9.Tracks[0].Response.Body)
+
+			if tc.crypter == nil {
+				return
+			}
+
+			// STEP 3: the stream is bound to the logical name of the cassette.
+			require.Panics(t, func() {
+				cassette.LoadCassette(tc.cassetteName, cassette.WithCrypter(tc.crypter), cassette.WithLogicalName("other-cassette"))
+			})
+
+			// STEP 4: truncation and alteration of the stream are detected.
+			for _, tampered := range [][]byte{
+				data[:len(data)-100],
+				append(bytes.Clone(data[:len(data)-1]), data[len(data)-1]^1),
+			} {
+				require.NoError(t, os.WriteFile(tc.cassetteName, tampered, 0o600))
+				require.Panics(t, func() {
+					cassette.LoadCassette(tc.cassetteName, opts...)
+				})
+			}
+		})
+	}
+}
+
+func Test_cassette_Streaming_Refused(t *testing.T) {
+	const cassetteName = "temp-fixtures/Test_cassette_Streaming_Refused.json"
+
+	_ = os.Remove(cassetteName)
+
+	signer, err := encryption.NewHMACSigner([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	// a signed cassette cannot be streamed, since its signature covers the whole cassette.
+	k7 := cassette.LoadCassette(cassetteName, cassette.WithStreaming(0), cassette.WithSigner(signer))
+	err = cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1"})
+	require.ErrorContains(t, err, "a signed cassette cannot be streamed")
+
+	// a store that is not a FileStreamer cannot stream the cassette.
+	store := struct{ cassette.FileIO }{FileIO: &fileio.OSFile{}}
+
+	k8 := cassette.LoadCassette(cassetteName, cassette.WithStreaming(0), cassette.WithStore(store))
+	err = cassette.AddTrackToCassette(k8, &track.Track{UUID: "trk-1"})
+	require.ErrorContains(t, err, "the cassette store does not support streaming")
+
+	_, err = os.Stat(cassetteName)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_cassette_StreamingAgreesWithWholeCassette(t *testing.T) {
+	const (
+		cassetteName       = "temp-fixtures/Test_cassette_StreamingAgreesWithWholeCassette.json"
+		streamCassetteName = "temp-fixtures/Test_cassette_StreamingAgreesWithWholeCassette_Stream.json"
+	)
+
+	_ = os.Remove(cassetteName)
+	_ = os.Remove(streamCassetteName)
+
+	k7 := cassette.LoadCassette(cassetteName)
+	k8 := cassette.LoadCassette(streamCassetteName, cassette.WithStreaming(0))
+
+	for _, trk := range []*track.Track{
+		{UUID: "trk-1", Request: track.Request{Method: http.MethodGet}},
+		{UUID: "trk-2", Response: &track.Response{Body: []byte(`{"a":"<b>"}`)}},
+	} {
+		require.NoError(t, cassette.AddTrackToCassette(k7, trk))
+		require.NoError(t, cassette.AddTrackToCassette(k8, trk))
+	}
+
+	data, err := os.ReadFile(cassetteName)
+	require.NoError(t, err)
+
+	streamData, err := os.ReadFile(streamCassetteName)
+	require.NoError(t, err)
+
+	assert.Equal(t, string(data), string(streamData))
+}
+
+func Test_cassette_StreamingEncryptsLargeCassetteWithDecrypt(t *testing.T) {
+	const cassetteName = "temp-fixtures/Test_cassette_StreamingEncryptsLargeCassetteWithDecrypt.json"
+
+	_ = os.Remove(cassetteName)
+
+	crypter, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	k7 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(crypter), cassette.WithStreaming(1024))
+	require.NoError(t, cassette.AddTrackToCassette(k7, &track.Track{UUID: "trk-1", Response: &track.Response{Body: bytes.Repeat([]byte("x"), 10_000)}}))
+
+	data, err := os.ReadFile(cassetteName)
+	require.NoError(t, err)
+
+	// Decrypt, hence the govcr CLI, also decrypts streamed cassettes.
+	plaintext, err := cassette.Decrypt(data, crypter)
+	require.NoError(t, err)
+
+	var k8 cassette.Cassette
+	require.NoError(t, json.Unmarshal(plaintext, &k8))
+	require.Len(t, k8.Tracks, 1)
+	assert.Equal(t, "trk-1", k8.Tracks[0].UUID)
+
+	// a stream can be rotated to another key, which preserves the stream format.
+	keyring, err := encryption.NewKeyring(
+		encryption.KeyedCrypter{KeyID: "key-2", Crypter: crypter},
+		encryption.KeyedCrypter{Crypter: crypter},
+	)
+	require.NoError(t, err)
+
+	ok, err := cassette.ReEncryptFile(&fileio.OSFile{}, cassetteName, keyring, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	data, err = os.ReadFile(cassetteName)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("$ENC:STREAM$")))
+	require.Contains(t, string(data[:64]), "key-2")
+
+	k9 := cassette.LoadCassette(cassetteName, cassette.WithCrypter(keyring))
+	require.EqualValues(t, 1, k9.NumberOfTracks())
+}
+
+type StoreMock struct {
+	mu   sync.Mutex
+	Data []byte
+}
+
+func (s *StoreMock) data() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Data
+}
+
+func (s *StoreMock) MkdirAll(_ string, _ os.FileMode) error {
+	return nil
+}
+
+func (s *StoreMock) ReadFile(_ string) ([]byte, error) {
+	return nil, nil
+}
+
+func (s *StoreMock) WriteFile(_ string, data []byte, _ os.FileMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.Data = data
 	return nil
 }
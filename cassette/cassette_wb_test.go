@@ -1,10 +1,13 @@
 package cassette
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/seborama/govcr/v17/encryption"
 	"github.com/seborama/govcr/v17/stats"
 )
 
@@ -36,3 +39,88 @@ func Test_cassette_Stats_ZeroWhenEmptyCassette(t *testing.T) {
 
 	assert.Equal(t, expected, got)
 }
+
+func Test_cassette_Decrypt_AuthenticatesHeader(t *testing.T) {
+	crypter, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	eData, err := encrypt([]byte("cassette data"), crypter, "my-cassette")
+	require.NoError(t, err)
+
+	plaintext, h, err := decrypt(eData, crypter)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("cassette data"), plaintext)
+	assert.Equal(t, "my-cassette", h.name)
+
+	// remove the logical name from the header
+	h, ciphertext, err := parseEncryptionHeader(eData)
+	require.NoError(t, err)
+
+	h.name = ""
+	header, err := encryptionHeaderV4(h)
+	require.NoError(t, err)
+
+	_, err = Decrypt(append(header, ciphertext...), crypter)
+	require.Error(t, err)
+
+	// downgrade the header to V3, which is not authenticated
+	header[len(encryptedCassetteHeaderMarkerV4)-2] = '3'
+
+	_, err = Decrypt(append(header, ciphertext...), crypter)
+	require.Error(t, err)
+}
+
+func Test_cassette_StreamDetectsTruncationAndReordering(t *testing.T) {
+	crypter, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	const chunkSize = 16
+
+	for _, size := range []int{0, 1, chunkSize, 3 * chunkSize, 3*chunkSize + 1} {
+		plaintext := bytes.Repeat([]byte("x"), size)
+
+		eData, err := encryptStream(plaintext, crypter, "my-cassette", chunkSize)
+		require.NoError(t, err)
+
+		dData, h, err := decryptStream(eData, crypter)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, dData)
+		assert.Equal(t, "my-cassette", h.name)
+		assert.EqualValues(t, chunkSize, h.chunkSize)
+	}
+
+	eData, err := encryptStream(bytes.Repeat([]byte("abcd"), 3*chunkSize/4), crypter, "", chunkSize)
+	require.NoError(t, err)
+
+	_, rest, err := parseEncryptionHeader(eData)
+	require.NoError(t, err)
+
+	header := eData[:len(eData)-len(rest)]
+	sealedChunkSize := chunkSize + 16 // AES-GCM overhead
+
+	// 3 full chunks, the last of which is marked as such
+	require.Len(t, rest, 3*sealedChunkSize)
+
+	// drop the last chunk: the stream ends on a chunk that is not marked as last.
+	_, _, err = decryptStream(eData[:len(eData)-sealedChunkSize], crypter)
+	require.Error(t, err)
+
+	// swap the first two chunks.
+	reordered := append(bytes.Clone(header), rest[sealedChunkSize:2*sealedChunkSize]...)
+	reordered = append(reordered, rest[:sealedChunkSize]...)
+	reordered = append(reordered, rest[2*sealedChunkSize:]...)
+
+	_, _, err = decryptStream(reordered, crypter)
+	require.Error(t, err)
+
+	// change the chunk size in the header, which is authenticated.
+	h, _, err := parseEncryptionHeader(eData)
+	require.NoError(t, err)
+
+	h.chunkSize = chunkSize - 1
+	altered, err := encodeEncryptionHeader(encryptedCassetteHeaderMarkerStream, h)
+	require.NoError(t, err)
+
+	_, _, err = decryptStream(append(altered, rest...), crypter)
+	require.Error(t, err)
+}
@@ -0,0 +1,261 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette/track"
+)
+
+// Directory cassettes hold one file per track, plus an index file that lists the track
+// files in sequence. Each track file is pretty-printed JSON, optionally compressed and / or
+// encrypted, such that a single recorded interaction can be reviewed in isolation.
+//
+// The index is the source of truth: the directory is never listed, which permits storage
+// backends such as AWS S3.
+
+const directoryIndexName = "index.json"
+
+// directoryIndex is the content of the index file of a directory cassette.
+type directoryIndex struct {
+	Tracks []string `json:"Tracks"`
+}
+
+// directoryTrackFileName returns the name of the file of a track in a directory cassette.
+// The name derives from the UUID of the track, which is assigned by saveDirectory when the
+// track has none, such that track files never collide.
+func (k7 *Cassette) directoryTrackFileName(trk *track.Track) string {
+	name := trk.UUID + ".json"
+
+	if k7.IsLongPlay() {
+		name += ".gz"
+	}
+
+	return name
+}
+
+// checkDirectoryFileName returns an error if the name of a file of a directory cassette is not
+// a plain local base name, such that a tampered index or track UUID cannot reach the files
+// outside the cassette directory.
+func checkDirectoryFileName(name string) error {
+	if !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) || name == directoryIndexName {
+		return errors.Errorf("invalid cassette track file name: '%s'", name)
+	}
+
+	return nil
+}
+
+// saveDirectory writes the track files that are not yet in storage, or not encoded as wanted,
+// followed by the index. Track files that are no longer referenced by the index are removed
+// when the store supports it.
+// The caller is responsible for locking the cassette.
+func (k7 *Cassette) saveDirectory() error {
+	if err := k7.store.MkdirAll(k7.name, 0o750); err != nil {
+		return errors.Wrap(err, k7.name)
+	}
+
+	if k7.trackFiles == nil {
+		k7.trackFiles = map[string]bool{}
+	}
+
+	index := directoryIndex{Tracks: make([]string, 0, len(k7.Tracks))}
+	current := make(map[string]struct{}, len(k7.Tracks))
+
+	for i := range k7.Tracks {
+		if k7.Tracks[i].UUID == "" {
+			k7.Tracks[i].UUID = uuid.NewString()
+		}
+
+		name := k7.directoryTrackFileName(&k7.Tracks[i])
+		if err := checkDirectoryFileName(name); err != nil {
+			return err
+		}
+
+		index.Tracks = append(index.Tracks, name)
+		current[name] = struct{}{}
+
+		if k7.trackFiles[name] {
+			continue
+		}
+
+		eData, err := k7.encodeDirectoryTrack(&k7.Tracks[i])
+		if err != nil {
+			return err
+		}
+
+		if err = k7.store.WriteFile(k7.name+name, eData, 0o600); err != nil {
+			return errors.Wrap(err, k7.name+name)
+		}
+
+		if err = k7.writeSignature(k7.name+name, eData); err != nil {
+			return err
+		}
+
+		k7.trackFiles[name] = true
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = k7.store.WriteFile(k7.name+directoryIndexName, data, 0o600); err != nil {
+		return errors.Wrap(err, k7.name+directoryIndexName)
+	}
+
+	if err = k7.writeSignature(k7.name+directoryIndexName, data); err != nil {
+		return err
+	}
+
+	return k7.removeStaleDirectoryTracks(current)
+}
+
+// invalidateTrackFile marks the file of the track, if it is in storage, to be re-written on
+// the next save.
+func (k7 *Cassette) invalidateTrackFile(trk *track.Track) {
+	name := k7.directoryTrackFileName(trk)
+
+	if _, ok := k7.trackFiles[name]; ok {
+		k7.trackFiles[name] = false
+	}
+}
+
+// invalidateTrackFiles marks all the track files in storage to be re-written on the next save.
+func (k7 *Cassette) invalidateTrackFiles() {
+	for name := range k7.trackFiles {
+		k7.trackFiles[name] = false
+	}
+}
+
+// removeStaleDirectoryTracks removes the track files that are not in the current set.
+func (k7 *Cassette) removeStaleDirectoryTracks(current map[string]struct{}) error {
+	stale := []string{}
+
+	for name := range k7.trackFiles {
+		if _, ok := current[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+
+	sort.Strings(stale)
+
+	remover, canRemove := k7.store.(FileRemover)
+
+	for _, name := range stale {
+		if canRemove {
+			if err := remover.Remove(k7.name + name); err != nil {
+				return errors.Wrap(err, k7.name+name)
+			}
+
+			if k7.signer != nil {
+				if err := remover.Remove(k7.name + name + signatureFileSuffix); err != nil {
+					return errors.Wrap(err, k7.name+name+signatureFileSuffix)
+				}
+			}
+		}
+
+		delete(k7.trackFiles, name)
+	}
+
+	return nil
+}
+
+func (k7 *Cassette) encodeDirectoryTrack(trk *track.Track) ([]byte, error) {
+	trk, err := k7.sealTrack(trk)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(trk, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// compress before encryption to get better results
+	gData, err := k7.GzipFilter(*bytes.NewBuffer(data))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	eData, err := k7.EncryptionFilter(gData)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return eData, nil
+}
+
+// readDirectory reads the tracks of a directory cassette and returns them as a JSON cassette,
+// or nil data when the cassette does not exist.
+func (k7 *Cassette) readDirectory() ([]byte, error) {
+	indexName := k7.name + directoryIndexName
+
+	if notExist, err := k7.store.NotExist(indexName); err != nil {
+		return nil, errors.Wrap(err, "failed to check cassette existence")
+	} else if notExist {
+		return nil, nil // not found, return nil data
+	}
+
+	data, err := k7.store.ReadFile(indexName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cassette index from source")
+	}
+
+	if err = k7.verifySignature(indexName, data); err != nil {
+		return nil, err
+	}
+
+	var index directoryIndex
+	if err = json.Unmarshal(data, &index); err != nil {
+		return nil, errors.Wrap(err, "invalid cassette index")
+	}
+
+	// all the files of the index are recorded, such that they are removed when they are no
+	// longer referenced.
+	k7.trackFiles = make(map[string]bool, len(index.Tracks))
+
+	k7Data := struct {
+		Tracks []json.RawMessage `json:"Tracks"`
+	}{
+		Tracks: make([]json.RawMessage, 0, len(index.Tracks)),
+	}
+
+	for _, name := range index.Tracks {
+		if err = checkDirectoryFileName(name); err != nil {
+			return nil, err
+		}
+
+		eData, err := k7.store.ReadFile(k7.name + name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read cassette track from source: "+name)
+		}
+
+		if err = k7.verifySignature(k7.name+name, eData); err != nil {
+			return nil, err
+		}
+
+		dData, err := k7.DecryptionFilter(eData)
+		if err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+
+		gData, err := k7.GunzipFilter(dData)
+		if err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+
+		// a track file that is not encoded as wanted must be re-written on next save
+		k7.trackFiles[name] = k7.isEncodedAsWanted(eData)
+
+		k7Data.Tracks = append(k7Data.Tracks, gData)
+	}
+
+	data, err = json.Marshal(k7Data)
+	return data, errors.WithStack(err)
+}
@@ -0,0 +1,865 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette/track"
+	cryptoerr "github.com/seborama/govcr/v17/encryption/errors"
+)
+
+// Field-level encryption encrypts selected parts of the tracks rather than the whole cassette,
+// such that the rest of the cassette remains plain JSON and its changes can be reviewed.
+//
+// Each encrypted value is stored inline, in place of the plain value, as the field marker
+// followed by the base64 representation of the encrypted value, encryption header included.
+// Encrypted values are decrypted when the cassette is loaded, whatever the field selection.
+//
+// Each value is encrypted with a fresh nonce and bound to the path of its field, such as
+// "request header Authorization" or "response body items.0.token", which is authenticated in
+// the encryption header: equal values are stored as different encrypted values, and encrypted
+// values cannot be moved to other fields.
+// The encrypted value of a field of a track is re-used for as long as its plain value does not
+// change, such that saving the cassette does not alter the tracks that have not changed.
+//
+// Plain values that start like an encrypted value (i.e. one or more "$" followed by the rest
+// of the field marker) are escaped with an extra "$", which is removed when the cassette is
+// loaded.
+
+const encryptedFieldMarker = "$ENC:FIELD$"
+
+// FieldSelection selects the parts of the tracks that are encrypted by field-level encryption.
+type FieldSelection struct {
+	// Headers are the names of the request and response headers whose values are encrypted,
+	// such as "Authorization" and "Cookie". The trailers of the same names are also encrypted.
+	Headers []string
+
+	// BodyPaths are the paths of the values to encrypt in the JSON request and response
+	// bodies, in dot notation, such as "user.password". A "*" segment matches all the members
+	// of an object or all the elements of an array, such as "items.*.token".
+	// A value may be of any JSON type. Bodies that are not valid JSON are left as is.
+	// The rest of the body is left byte for byte as is, such that the decrypted body is the
+	// original body.
+	BodyPaths []string
+
+	// BodyHosts are the hosts whose request and response bodies are encrypted whole.
+	// A host matches with or without its port.
+	BodyHosts []string
+}
+
+// sealedField is the encrypted value of a field of a track, along with its plain value.
+type sealedField struct {
+	plaintext string
+	sValue    string
+}
+
+// fieldLocation returns the key of a value of a field of a track in Cassette.sealedFields,
+// or "" when the track has no UUID, in which case its encrypted values are not re-used.
+func fieldLocation(trackUUID, path string, index int) string {
+	if trackUUID == "" {
+		return ""
+	}
+
+	return trackUUID + "\x00" + path + "\x00" + strconv.Itoa(index)
+}
+
+// fieldMarkerDollars returns the number of "$" that the value starts with, when they are
+// followed by the rest of the field marker, or 0 otherwise.
+// An encrypted value has one, an escaped plain value has more than one.
+func fieldMarkerDollars(value []byte) int {
+	n := 0
+	for n < len(value) && value[n] == '$' {
+		n++
+	}
+
+	if n == 0 || !bytes.HasPrefix(value[n:], []byte(encryptedFieldMarker[1:])) {
+		return 0
+	}
+
+	return n
+}
+
+// wantFieldsEncrypted returns true if the cassette is set for field-level encryption.
+func (k7 *Cassette) wantFieldsEncrypted() bool {
+	return k7.fieldCrypter != nil
+}
+
+// sealTracks returns the tracks with their selected fields encrypted and their plain values
+// that start like an encrypted value escaped.
+func (k7 *Cassette) sealTracks(tracks []track.Track) ([]track.Track, error) {
+	var sealed []track.Track
+
+	for i := range tracks {
+		trk, err := k7.sealTrack(&tracks[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if trk == &tracks[i] && sealed == nil {
+			continue
+		}
+
+		if sealed == nil {
+			sealed = slices.Clone(tracks)
+		}
+
+		sealed[i] = *trk
+	}
+
+	if sealed == nil {
+		return tracks, nil
+	}
+
+	return sealed, nil
+}
+
+// sealTrack returns a copy of the track with its selected fields encrypted and its plain
+// values that start like an encrypted value escaped, or the track itself when it has none.
+// The original track is left untouched.
+func (k7 *Cassette) sealTrack(trk *track.Track) (*track.Track, error) {
+	if !k7.wantFieldsEncrypted() && !hasFieldMarker(trk) {
+		return trk, nil
+	}
+
+	var err error
+
+	sealed := *trk
+	wholeBody := k7.isBodyHost(trk)
+
+	sealed.Request.Header, err = k7.sealHeader(trk.UUID, "request header", trk.Request.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed.Request.Trailer, err = k7.sealHeader(trk.UUID, "request trailer", trk.Request.Trailer)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed.Request.Body, err = k7.sealBody(trk.UUID, "request body", trk.Request.Body, wholeBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if trk.Response == nil {
+		return &sealed, nil
+	}
+
+	resp := *trk.Response
+	sealed.Response = &resp
+
+	resp.Header, err = k7.sealHeader(trk.UUID, "response header", trk.Response.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Trailer, err = k7.sealHeader(trk.UUID, "response trailer", trk.Response.Trailer)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body, err = k7.sealBody(trk.UUID, "response body", trk.Response.Body, wholeBody)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealed, nil
+}
+
+// hasFieldMarker returns true if a header value or a body of the track contains the field
+// marker, in which case the track may have values to escape.
+func hasFieldMarker(trk *track.Track) bool {
+	headers := []http.Header{trk.Request.Header, trk.Request.Trailer}
+	bodies := [][]byte{trk.Request.Body}
+
+	if trk.Response != nil {
+		headers = append(headers, trk.Response.Header, trk.Response.Trailer)
+		bodies = append(bodies, trk.Response.Body)
+	}
+
+	for _, header := range headers {
+		for _, values := range header {
+			for _, value := range values {
+				if strings.Contains(value, encryptedFieldMarker) {
+					return true
+				}
+			}
+		}
+	}
+
+	for _, body := range bodies {
+		if bytes.Contains(body, []byte(encryptedFieldMarker)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isBodyHost returns true if the bodies of the track are to be encrypted whole.
+func (k7 *Cassette) isBodyHost(trk *track.Track) bool {
+	if !k7.wantFieldsEncrypted() {
+		return false
+	}
+
+	hosts := []string{trk.Request.Host}
+	if trk.Request.URL != nil {
+		hosts = append(hosts, trk.Request.URL.Host, trk.Request.URL.Hostname())
+	}
+
+	for _, bodyHost := range k7.fields.BodyHosts {
+		for _, host := range hosts {
+			if host != "" && strings.EqualFold(host, bodyHost) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// sealHeader returns a copy of the header with the values of the selected headers encrypted
+// and the other values that start like an encrypted value escaped, or the header itself when
+// it has none.
+func (k7 *Cassette) sealHeader(trackUUID, field string, header http.Header) (http.Header, error) {
+	var sealed http.Header
+
+	for name, values := range header {
+		selected := k7.isSelectedHeader(name)
+
+		for i, value := range values {
+			if !selected && fieldMarkerDollars([]byte(value)) == 0 {
+				continue
+			}
+
+			if sealed == nil {
+				sealed = header.Clone()
+			}
+
+			if !selected {
+				sealed[name][i] = "$" + value
+				continue
+			}
+
+			path := field + " " + http.CanonicalHeaderKey(name)
+
+			sValue, err := k7.sealValue(fieldLocation(trackUUID, path, i), path, []byte(value))
+			if err != nil {
+				return nil, errors.Wrap(err, path)
+			}
+
+			sealed[name][i] = sValue
+		}
+	}
+
+	if sealed == nil {
+		return header, nil
+	}
+
+	return sealed, nil
+}
+
+func (k7 *Cassette) isSelectedHeader(name string) bool {
+	if !k7.wantFieldsEncrypted() {
+		return false
+	}
+
+	for _, selected := range k7.fields.Headers {
+		if strings.EqualFold(name, selected) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sealBody returns the body whole encrypted or with its values at the selected JSON paths
+// encrypted, and its plain values that start like an encrypted value escaped. The body is
+// returned as is when it has none.
+func (k7 *Cassette) sealBody(trackUUID, field string, body []byte, wholeBody bool) ([]byte, error) {
+	if len(body) == 0 {
+		return body, nil
+	}
+
+	if wholeBody {
+		sValue, err := k7.sealValue(fieldLocation(trackUUID, field, 0), field, body)
+		if err != nil {
+			return nil, errors.Wrap(err, field)
+		}
+
+		return []byte(sValue), nil
+	}
+
+	if fieldMarkerDollars(body) > 0 {
+		return append([]byte("$"), body...), nil
+	}
+
+	var paths [][]string
+
+	if k7.wantFieldsEncrypted() {
+		for _, path := range k7.fields.BodyPaths {
+			paths = append(paths, strings.Split(path, "."))
+		}
+	}
+
+	if len(paths) == 0 && !bytes.Contains(body, []byte(encryptedFieldMarker)) {
+		return body, nil
+	}
+
+	spans, ok := jsonValueSpans(body, func(path []string, value []byte) bool {
+		return matchesAnyJSONPath(path, paths) || isEscapableJSONString(value)
+	})
+	if !ok {
+		return body, nil
+	}
+
+	return spliceJSONValues(body, spans, func(span jsonSpan, value []byte) ([]byte, error) {
+		if !matchesAnyJSONPath(span.path, paths) {
+			return escapeJSONString(value), nil
+		}
+
+		path := field + " " + strings.Join(span.path, ".")
+
+		sValue, err := k7.sealValue(fieldLocation(trackUUID, path, 0), path, value)
+		if err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+
+		return json.Marshal(sValue)
+	})
+}
+
+// isEscapableJSONString returns true if the JSON value is a string that starts like an
+// encrypted value, whether it is one, or an escaped plain value.
+func isEscapableJSONString(value []byte) bool {
+	return len(value) > 0 && value[0] == '"' && fieldMarkerDollars(value[1:]) > 0
+}
+
+// escapeJSONString returns the JSON string with an extra "$" at its start.
+func escapeJSONString(value []byte) []byte {
+	return append([]byte(`"$`), value[1:]...)
+}
+
+// matchesAnyJSONPath returns true if the path of a JSON value matches any of the paths, in
+// which a "*" segment matches any member or element.
+func matchesAnyJSONPath(path []string, paths [][]string) bool {
+	for _, p := range paths {
+		if len(p) != len(path) {
+			continue
+		}
+
+		matched := true
+
+		for i := range p {
+			if p[i] != "*" && p[i] != path[i] {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sealValue returns the inline representation of the value encrypted and bound to the path of
+// its field. The encrypted value at the location is re-used when its plain value has not
+// changed.
+func (k7 *Cassette) sealValue(location, path string, value []byte) (string, error) {
+	k7.sealedFieldsMutex.Lock()
+	defer k7.sealedFieldsMutex.Unlock()
+
+	if sealed, ok := k7.sealedFields[location]; ok && location != "" && sealed.plaintext == string(value) {
+		return sealed.sValue, nil
+	}
+
+	eData, err := encryptWithHeader(value, k7.fieldCrypter, encryptionHeader{name: k7.logicalName, field: path})
+	if err != nil {
+		return "", err
+	}
+
+	sValue := encryptedFieldMarker + base64.StdEncoding.EncodeToString(eData)
+
+	if location != "" {
+		if k7.sealedFields == nil {
+			k7.sealedFields = map[string]sealedField{}
+		}
+
+		k7.sealedFields[location] = sealedField{plaintext: string(value), sValue: sValue}
+	}
+
+	return sValue, nil
+}
+
+// unsealTracks decrypts the encrypted fields of the tracks and unescapes their escaped plain
+// values, in place.
+// Tracks that are not sealed as wanted (e.g. the field selection or the key has changed) are
+// marked for re-writing on next save.
+// The caller is responsible for locking the cassette.
+func (k7 *Cassette) unsealTracks() error {
+	for i := range k7.Tracks {
+		trk := &k7.Tracks[i]
+
+		var loaded []byte
+
+		if k7.wantFieldsEncrypted() {
+			var err error
+
+			loaded, err = json.Marshal(trk)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		if err := k7.unsealTrack(trk); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("track #%d", i))
+		}
+
+		if k7.wantFieldsEncrypted() {
+			upToDate, err := k7.isSealedAsWanted(trk, loaded)
+			if err != nil {
+				return err
+			}
+
+			if !upToDate {
+				k7.appendable.Store(false)
+				k7.invalidateTrackFile(trk)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isSealedAsWanted returns true if the track, as it was loaded, agrees with the field
+// selection and crypter of the cassette.
+func (k7 *Cassette) isSealedAsWanted(trk *track.Track, loaded []byte) (bool, error) {
+	sealed, err := k7.sealTrack(trk)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return bytes.Equal(data, loaded), nil
+}
+
+// unsealTrack decrypts the encrypted fields of the track and unescapes its escaped plain
+// values, in place.
+func (k7 *Cassette) unsealTrack(trk *track.Track) error {
+	var err error
+
+	if err = k7.unsealHeader(trk.UUID, "request header", trk.Request.Header); err != nil {
+		return err
+	}
+
+	if err = k7.unsealHeader(trk.UUID, "request trailer", trk.Request.Trailer); err != nil {
+		return err
+	}
+
+	if trk.Request.Body, err = k7.unsealBody(trk.UUID, "request body", trk.Request.Body); err != nil {
+		return err
+	}
+
+	if trk.Response == nil {
+		return nil
+	}
+
+	if err = k7.unsealHeader(trk.UUID, "response header", trk.Response.Header); err != nil {
+		return err
+	}
+
+	if err = k7.unsealHeader(trk.UUID, "response trailer", trk.Response.Trailer); err != nil {
+		return err
+	}
+
+	trk.Response.Body, err = k7.unsealBody(trk.UUID, "response body", trk.Response.Body)
+
+	return err
+}
+
+// unsealHeader decrypts the encrypted values of the header and unescapes its escaped plain
+// values, in place.
+func (k7 *Cassette) unsealHeader(trackUUID, field string, header http.Header) error {
+	for name, values := range header {
+		for i, value := range values {
+			switch fieldMarkerDollars([]byte(value)) {
+			case 0:
+				continue
+
+			case 1:
+				path := field + " " + http.CanonicalHeaderKey(name)
+
+				plaintext, err := k7.unsealValue(fieldLocation(trackUUID, path, i), path, value)
+				if err != nil {
+					return errors.Wrap(err, path)
+				}
+
+				values[i] = string(plaintext)
+
+			default:
+				values[i] = value[1:]
+			}
+		}
+	}
+
+	return nil
+}
+
+// unsealBody returns the body decrypted whole or with its encrypted JSON values decrypted,
+// and its escaped plain values unescaped.
+func (k7 *Cassette) unsealBody(trackUUID, field string, body []byte) ([]byte, error) {
+	switch fieldMarkerDollars(body) {
+	case 0:
+	case 1:
+		plaintext, err := k7.unsealValue(fieldLocation(trackUUID, field, 0), field, string(body))
+		return plaintext, errors.Wrap(err, field)
+	default:
+		return body[1:], nil
+	}
+
+	if !bytes.Contains(body, []byte(encryptedFieldMarker[1:])) {
+		return body, nil
+	}
+
+	spans, ok := jsonValueSpans(body, func(_ []string, value []byte) bool {
+		return isEscapableJSONString(value)
+	})
+	if !ok {
+		return body, nil
+	}
+
+	return spliceJSONValues(body, spans, func(span jsonSpan, value []byte) ([]byte, error) {
+		if fieldMarkerDollars(value[1:]) > 1 {
+			return append([]byte(`"`), value[2:]...), nil
+		}
+
+		path := field + " " + strings.Join(span.path, ".")
+
+		var sValue string
+		if err := json.Unmarshal(value, &sValue); err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+
+		plaintext, err := k7.unsealValue(fieldLocation(trackUUID, path, 0), path, sValue)
+		if err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+
+		if !json.Valid(plaintext) {
+			return nil, cryptoerr.NewErrCrypto("encrypted field does not hold a JSON value")
+		}
+
+		return plaintext, nil
+	})
+}
+
+// unsealValue decrypts the inline representation of an encrypted value, which must be bound
+// to the path of its field.
+// The encrypted value is re-used when the field at the location is next sealed, provided
+// that it agrees with the cassette crypter and logical name.
+func (k7 *Cassette) unsealValue(location, path, sValue string) ([]byte, error) {
+	if !k7.wantFieldsEncrypted() {
+		return nil, cryptoerr.NewErrCrypto("cassette has encrypted fields but no field cryptographer was supplied")
+	}
+
+	eData, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sValue, encryptedFieldMarker))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid encrypted field")
+	}
+
+	plaintext, h, err := decrypt(eData, k7.fieldCrypter)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.aad == nil || h.field != path {
+		return nil, cryptoerr.NewErrCrypto(fmt.Sprintf("encrypted field is bound to field '%s' but it is found in field '%s'", h.field, path))
+	}
+
+	if err = k7.checkLogicalName(h, "encrypted field"); err != nil {
+		return nil, err
+	}
+
+	if location != "" && isEncryptedWithCurrentKey(eData, k7.fieldCrypter) {
+		k7.sealedFieldsMutex.Lock()
+		defer k7.sealedFieldsMutex.Unlock()
+
+		if k7.sealedFields == nil {
+			k7.sealedFields = map[string]sealedField{}
+		}
+
+		k7.sealedFields[location] = sealedField{plaintext: string(plaintext), sValue: sValue}
+	}
+
+	return plaintext, nil
+}
+
+// EncryptedFields describes the encrypted fields found on the tracks of a cassette.
+type EncryptedFields struct {
+	// Kind is the cipher kind of the encrypted fields, as recorded in their encryption header.
+	Kind string
+
+	// LogicalName is the logical name that the encrypted fields are bound to, if any.
+	LogicalName string
+
+	// Fields selects the fields that are encrypted: the names of the encrypted headers and
+	// trailers, the paths of the encrypted JSON body values and the hosts of the tracks whose
+	// bodies are encrypted whole.
+	Fields FieldSelection
+}
+
+// FindEncryptedFields returns the encrypted fields of a cassette in storage, or nil when the
+// cassette has none, such that the cassette can be saved again with the same fields encrypted.
+// The options are those needed to read the cassette, such as its signer. The encrypted fields
+// are not decrypted.
+func FindEncryptedFields(cassetteName string, opts ...Option) (*EncryptedFields, error) {
+	k7 := newCassette(cassetteName, opts...)
+
+	data, err := k7.readCassette(cassetteName)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	if k7.IsJSONLines() {
+		err = k7.unmarshalJSONLines(data)
+	} else {
+		err = json.Unmarshal(data, k7)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, cassetteName)
+	}
+
+	var found *EncryptedFields
+
+	note := func(sValue string) error {
+		if found != nil {
+			return nil
+		}
+
+		eData, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sValue, encryptedFieldMarker))
+		if err != nil {
+			return errors.Wrap(err, "invalid encrypted field")
+		}
+
+		h, _, err := parseEncryptionHeader(eData)
+		if err != nil {
+			return err
+		}
+
+		found = &EncryptedFields{Kind: h.kind, LogicalName: h.name}
+
+		return nil
+	}
+
+	var fields FieldSelection
+
+	for i := range k7.Tracks {
+		trk := &k7.Tracks[i]
+
+		headers := []http.Header{trk.Request.Header, trk.Request.Trailer}
+		bodies := [][]byte{trk.Request.Body}
+
+		if trk.Response != nil {
+			headers = append(headers, trk.Response.Header, trk.Response.Trailer)
+			bodies = append(bodies, trk.Response.Body)
+		}
+
+		for _, header := range headers {
+			for name, values := range header {
+				for _, value := range values {
+					if !strings.HasPrefix(value, encryptedFieldMarker) {
+						continue
+					}
+
+					if err = note(value); err != nil {
+						return nil, errors.Wrap(err, fmt.Sprintf("track #%d: header %s", i, name))
+					}
+
+					fields.Headers = appendFold(fields.Headers, name)
+				}
+			}
+		}
+
+		for _, body := range bodies {
+			if bytes.HasPrefix(body, []byte(encryptedFieldMarker)) {
+				if err = note(string(body)); err != nil {
+					return nil, errors.Wrap(err, fmt.Sprintf("track #%d: body", i))
+				}
+
+				host := trk.Request.Host
+				if trk.Request.URL != nil && trk.Request.URL.Host != "" {
+					host = trk.Request.URL.Host
+				}
+
+				fields.BodyHosts = appendFold(fields.BodyHosts, host)
+
+				continue
+			}
+
+			if !bytes.Contains(body, []byte(encryptedFieldMarker)) {
+				continue
+			}
+
+			spans, ok := jsonValueSpans(body, func(_ []string, value []byte) bool {
+				return bytes.HasPrefix(value, []byte(`"`+encryptedFieldMarker))
+			})
+			if !ok {
+				continue
+			}
+
+			for _, span := range spans {
+				path := strings.Join(span.path, ".")
+
+				var sValue string
+				if err = json.Unmarshal(body[span.start:span.end], &sValue); err == nil {
+					err = note(sValue)
+				}
+
+				if err != nil {
+					return nil, errors.Wrap(err, fmt.Sprintf("track #%d: body path %s", i, path))
+				}
+
+				if !slices.Contains(fields.BodyPaths, path) {
+					fields.BodyPaths = append(fields.BodyPaths, path)
+				}
+			}
+		}
+	}
+
+	if found != nil {
+		found.Fields = fields
+	}
+
+	return found, nil
+}
+
+// appendFold appends the value to the values, unless they hold it already, regardless of case.
+func appendFold(values []string, value string) []string {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
+
+// jsonSpan is the location of a value in a JSON document, along with its path.
+type jsonSpan struct {
+	start, end int
+	path       []string
+}
+
+// jsonValueSpans returns the locations of the values of the JSON document that are selected,
+// in document order. selected is passed the path of each value and the document from the
+// start of the value. The values within a selected value are not visited.
+// It returns false when the data is not a JSON document.
+func jsonValueSpans(data []byte, selected func(path []string, value []byte) bool) ([]jsonSpan, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	var spans []jsonSpan
+
+	if err := walkJSONValue(dec, data, nil, selected, &spans); err != nil {
+		return nil, false
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false // unexpected data after the document
+	}
+
+	return spans, true
+}
+
+func walkJSONValue(dec *json.Decoder, data []byte, path []string, selected func([]string, []byte) bool, spans *[]jsonSpan) error {
+	// the decoder is positioned before the separator, if any, that precedes the value.
+	start := int(dec.InputOffset())
+	for start < len(data) && bytes.IndexByte([]byte(" \t\r\n,:"), data[start]) >= 0 {
+		start++
+	}
+
+	if len(path) > 0 && selected(path, data[start:]) {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return errors.WithStack(err)
+		}
+
+		*spans = append(*spans, jsonSpan{start: start, end: int(dec.InputOffset()), path: path})
+
+		return nil
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			name, _ := key.(string)
+
+			if err = walkJSONValue(dec, data, append(path[:len(path):len(path)], name), selected, spans); err != nil {
+				return err
+			}
+		}
+
+		_, err = dec.Token()
+
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			if err = walkJSONValue(dec, data, append(path[:len(path):len(path)], strconv.Itoa(i)), selected, spans); err != nil {
+				return err
+			}
+		}
+
+		_, err = dec.Token()
+	}
+
+	return errors.WithStack(err)
+}
+
+// spliceJSONValues returns a copy of the data with the values at the spans replaced, such
+// that the rest of the document is left byte for byte as is.
+func spliceJSONValues(data []byte, spans []jsonSpan, replace func(span jsonSpan, value []byte) ([]byte, error)) ([]byte, error) {
+	if len(spans) == 0 {
+		return data, nil
+	}
+
+	spliced := make([]byte, 0, len(data))
+	last := 0
+
+	for _, span := range spans {
+		value, err := replace(span, data[span.start:span.end])
+		if err != nil {
+			return nil, err
+		}
+
+		spliced = append(spliced, data[last:span.start]...)
+		spliced = append(spliced, value...)
+		last = span.end
+	}
+
+	return append(spliced, data[last:]...), nil
+}
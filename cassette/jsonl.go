@@ -0,0 +1,202 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette/track"
+	"github.com/seborama/govcr/v17/compression"
+)
+
+// JSON Lines cassettes hold one track per line, which permits to record a new track by
+// appending it to the cassette rather than by re-writing the whole cassette.
+//
+// Each line is the JSON representation of a track.
+// When the cassette is encrypted, each line is instead the base64 representation of the
+// (compressed, if a Long Play cassette, and) encrypted JSON track.
+// When the cassette is compressed but not encrypted, the cassette is a gzip stream of
+// JSON lines. New tracks are appended as new gzip members.
+
+// encodeJSONLines returns the cassette data in JSON Lines format, filters included.
+// The caller is responsible for locking the cassette.
+func (k7 *Cassette) encodeJSONLines() ([]byte, error) {
+	var data []byte
+
+	for i := range k7.Tracks {
+		line, err := k7.encodeJSONLinesTrack(&k7.Tracks[i])
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, line...)
+	}
+
+	if k7.wantEncrypted() {
+		return data, nil
+	}
+
+	// compress all lines at once to get better results
+	return k7.GzipFilter(*bytes.NewBuffer(data))
+}
+
+// encodeJSONLinesTrack returns the JSON Lines representation of a track.
+// Only encrypted tracks receive the compression filter here.
+func (k7 *Cassette) encodeJSONLinesTrack(trk *track.Track) ([]byte, error) {
+	trk, err := k7.sealTrack(trk)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(trk)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if !k7.wantEncrypted() {
+		return append(data, '\n'), nil
+	}
+
+	// compress before encryption to get better results
+	gData, err := k7.GzipFilter(*bytes.NewBuffer(data))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	eData, err := k7.EncryptionFilter(gData)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	line := make([]byte, base64.StdEncoding.EncodedLen(len(eData)), base64.StdEncoding.EncodedLen(len(eData))+1)
+	base64.StdEncoding.Encode(line, eData)
+
+	return append(line, '\n'), nil
+}
+
+// appendJSONLinesTrack appends a track to the cassette in storage.
+func (k7 *Cassette) appendJSONLinesTrack(appender FileAppender, trk *track.Track) error {
+	line, err := k7.encodeJSONLinesTrack(trk)
+	if err != nil {
+		return err
+	}
+
+	if !k7.wantEncrypted() {
+		// a gzip stream can be made of several members
+		line, err = k7.GzipFilter(*bytes.NewBuffer(line))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	path := filepath.Dir(k7.name)
+	if err = k7.store.MkdirAll(path, 0o750); err != nil {
+		return errors.Wrap(err, path)
+	}
+
+	if err = appender.AppendFile(k7.name, line, 0o600); err != nil {
+		return errors.Wrap(err, k7.name)
+	}
+
+	return nil
+}
+
+// decodeJSONLines returns the plain JSON Lines content of the cassette raw data,
+// i.e. decompressed and decrypted, as needed.
+// New tracks may only be appended to the cassette in storage if its encoding agrees with
+// the cassette filters (e.g. a plain cassette that is to be encrypted must be re-written).
+func (k7 *Cassette) decodeJSONLines(data []byte) ([]byte, error) {
+	compressed := compression.IsCompressed(data)
+	hasPlainLines, hasEncryptedLines, hasStaleLines := false, false, false
+
+	if compressed {
+		var err error
+
+		data, err = compression.Decompress(data)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	var plain []byte
+
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] == '{' {
+			hasPlainLines = true
+		} else {
+			hasEncryptedLines = true
+
+			var (
+				upToDate bool
+				err      error
+			)
+
+			line, upToDate, err = k7.decodeJSONLinesEncryptedTrack(line)
+			if err != nil {
+				return nil, err
+			}
+
+			hasStaleLines = hasStaleLines || !upToDate
+		}
+
+		plain = append(plain, line...)
+		plain = append(plain, '\n')
+	}
+
+	if k7.wantEncrypted() {
+		k7.appendable.Store(!compressed && !hasPlainLines && !hasStaleLines)
+	} else {
+		k7.appendable.Store(compressed == k7.IsLongPlay() && !hasEncryptedLines)
+	}
+
+	return plain, nil
+}
+
+// decodeJSONLinesEncryptedTrack returns the plain JSON track of an encrypted line and whether
+// the line is encrypted with the current key of the cassette crypter.
+func (k7 *Cassette) decodeJSONLinesEncryptedTrack(line []byte) ([]byte, bool, error) {
+	eData := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+
+	n, err := base64.StdEncoding.Decode(eData, line)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "invalid cassette line")
+	}
+
+	dData, err := k7.DecryptionFilter(eData[:n])
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	gData, err := k7.GunzipFilter(dData)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	return gData, k7.isEncodedAsWanted(eData[:n]), nil
+}
+
+// unmarshalJSONLines streams the tracks of plain JSON Lines data into the cassette.
+func (k7 *Cassette) unmarshalJSONLines(data []byte) error {
+	k7.trackSliceMutex.Lock()
+	defer k7.trackSliceMutex.Unlock()
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	for dec.More() {
+		var trk track.Track
+		if err := dec.Decode(&trk); err != nil {
+			return errors.WithStack(err)
+		}
+
+		k7.Tracks = append(k7.Tracks, trk)
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+// ReEncryptFile re-encrypts an encrypted cassette file with the current key of the crypter,
+// typically the primary key of an encryption.Keyring, which is also able to decrypt the file.
+// Files with an older encryption header are upgraded to the current header version.
+// This applies equally to the track files of a directory cassette. JSON Lines cassettes are
+// re-encrypted line by line.
+// A signed file has its signature verified and it is signed again with the signer: the file is
+// not re-encrypted when no signer is supplied, since its signature would no longer match.
+// It returns false when the file is not encrypted or is already encrypted with the current key,
+// in which case the file is left untouched.
+func ReEncryptFile(store FileIO, name string, crypter Crypter, signer Signer) (bool, error) {
+	data, err := store.ReadFile(name)
+	if err != nil {
+		return false, errors.Wrap(err, name)
+	}
+
+	var eData []byte
+
+	if isJSONLinesName(name) {
+		eData, err = reEncryptJSONLines(data, crypter)
+	} else {
+		eData, err = reEncrypt(data, crypter)
+	}
+
+	if err != nil || eData == nil {
+		return false, errors.Wrap(err, name)
+	}
+
+	signed, err := IsSigned(store, name)
+	if err != nil {
+		return false, errors.Wrap(err, name)
+	}
+
+	if signed {
+		if signer == nil {
+			return false, errors.Errorf("%s: the file is signed, a signer is required to sign it again", name)
+		}
+
+		if err = verifySignature(store, name, data, signer); err != nil {
+			return false, errors.WithStack(err)
+		}
+	}
+
+	if err = store.WriteFile(name, eData, 0o600); err != nil {
+		return false, errors.Wrap(err, name)
+	}
+
+	if signed {
+		if err = writeSignature(store, name, eData, signer); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// reEncrypt returns the data re-encrypted with the current key of the crypter and the
+// current header version, or nil if the data need not be re-encrypted.
+// The logical name that the data is bound to, if any, is preserved, as is the chunk size of
+// streamed cassettes.
+func reEncrypt(data []byte, crypter Crypter) ([]byte, error) {
+	if getEncryptionMarker(data) == "" || isEncryptedWithCurrentKey(data, crypter) {
+		return nil, nil
+	}
+
+	plaintext, h, err := decrypt(data, crypter)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if h.marker == encryptedCassetteHeaderMarkerStream {
+		return encryptStream(plaintext, crypter, h.name, int(h.chunkSize))
+	}
+
+	return encrypt(plaintext, crypter, h.name)
+}
+
+// reEncryptJSONLines returns the JSON Lines data with its encrypted lines re-encrypted with
+// the current key of the crypter, or nil if no line needs to be re-encrypted.
+func reEncryptJSONLines(data []byte, crypter Crypter) ([]byte, error) {
+	var (
+		out     []byte
+		changed bool
+	)
+
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] != '{' {
+			eData, err := base64.StdEncoding.DecodeString(string(line))
+			if err != nil {
+				// e.g. a compressed plain cassette
+				return nil, nil //nolint:nilerr // not an encrypted cassette
+			}
+
+			newEData, err := reEncrypt(eData, crypter)
+			if err != nil {
+				return nil, err
+			}
+
+			if newEData != nil {
+				line = []byte(base64.StdEncoding.EncodeToString(newEData))
+				changed = true
+			}
+		}
+
+		out = append(out, line...)
+		out = append(out, '\n')
+	}
+
+	if !changed {
+		return nil, nil
+	}
+
+	return out, nil
+}
+
+// CipherKind returns the kind of the cipher that a cassette in storage is encrypted with, as
+// recorded in its encryption header, for instance "aesgcm" or "passphrase+chacha20poly1305".
+// It returns an empty string when the cassette is not encrypted.
+// A directory cassette (i.e. a name that ends with "/") is inspected through its track files
+// and a JSON Lines cassette through its lines: the first encrypted one decides.
+func CipherKind(store FileIO, cassetteName string) (string, error) {
+	h, err := readEncryptionHeader(store, cassetteName)
+	if err != nil || h == nil {
+		return "", err
+	}
+
+	return h.kind, nil
+}
+
+// EncryptionOptions returns the options that preserve the encryption settings recorded in the
+// encryption header of a cassette in storage, when the cassette is saved again: the logical
+// name that the cassette is bound to and the chunk size of a streamed cassette.
+// It returns no options when the cassette is not encrypted.
+// The cassette is inspected like with CipherKind.
+func EncryptionOptions(store FileIO, cassetteName string) ([]Option, error) {
+	h, err := readEncryptionHeader(store, cassetteName)
+	if err != nil || h == nil {
+		return nil, err
+	}
+
+	var opts []Option
+
+	if h.name != "" {
+		opts = append(opts, WithLogicalName(h.name))
+	}
+
+	if h.marker == encryptedCassetteHeaderMarkerStream {
+		opts = append(opts, WithStreaming(int(h.chunkSize)))
+	}
+
+	return opts, nil
+}
+
+// readEncryptionHeader returns the encryption header of the first encrypted file of the
+// cassette in storage, or nil when the cassette is not encrypted.
+func readEncryptionHeader(store FileIO, cassetteName string) (*encryptionHeader, error) {
+	names, err := cassetteFileNames(store, cassetteName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) > 1 {
+		names = names[1:] // the index of a directory cassette is never encrypted
+	}
+
+	for _, name := range names {
+		data, err := store.ReadFile(name)
+		if err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+
+		if !isJSONLinesName(name) {
+			h, err := dataEncryptionHeader(data)
+			if err != nil || h != nil {
+				return h, errors.Wrap(err, name)
+			}
+
+			continue
+		}
+
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			if len(line) == 0 || line[0] == '{' {
+				continue
+			}
+
+			eData, err := base64.StdEncoding.DecodeString(string(line))
+			if err != nil {
+				// e.g. a compressed plain cassette
+				return nil, nil //nolint:nilerr // not an encrypted cassette
+			}
+
+			return dataEncryptionHeader(eData)
+		}
+	}
+
+	return nil, nil
+}
+
+// dataEncryptionHeader returns the encryption header of the cassette raw data, or nil when the
+// data is not encrypted.
+func dataEncryptionHeader(data []byte) (*encryptionHeader, error) {
+	if getEncryptionMarker(data) == "" {
+		return nil, nil
+	}
+
+	h, _, err := parseEncryptionHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
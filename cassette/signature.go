@@ -0,0 +1,177 @@
+package cassette
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	govcrerr "github.com/seborama/govcr/v17/errors"
+)
+
+// Signed cassettes have a signature file alongside each of their files, with the same name
+// and the ".sig" suffix. The signature covers the data of the file as it is in storage, which
+// permits to detect the alterations of plain cassettes, such as hand edits or corruption.
+// The index and each track file of a directory cassette are signed individually.
+
+const signatureFileSuffix = ".sig"
+
+// signatureFile is the content of a signature file.
+type signatureFile struct {
+	Kind      string `json:"Kind"`
+	Signature []byte `json:"Signature"`
+}
+
+// writeSignature writes the signature of a cassette file, if the cassette is signed.
+func (k7 *Cassette) writeSignature(name string, data []byte) error {
+	if k7.signer == nil {
+		return nil
+	}
+
+	return writeSignature(k7.store, name, data, k7.signer)
+}
+
+// verifySignature verifies the signature of a cassette file, if the cassette is signed.
+func (k7 *Cassette) verifySignature(name string, data []byte) error {
+	if k7.signer == nil {
+		return nil
+	}
+
+	return verifySignature(k7.store, name, data, k7.signer)
+}
+
+func writeSignature(store FileIO, name string, data []byte, signer Signer) error {
+	signature, err := signer.Sign(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to sign "+name)
+	}
+
+	sData, err := json.MarshalIndent(signatureFile{Kind: signer.Kind(), Signature: signature}, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = store.WriteFile(name+signatureFileSuffix, sData, 0o600)
+
+	return errors.Wrap(err, name+signatureFileSuffix)
+}
+
+func verifySignature(store FileIO, name string, data []byte, signer Signer) error {
+	sigName := name + signatureFileSuffix
+
+	if notExist, err := store.NotExist(sigName); err != nil {
+		return errors.Wrap(err, "failed to check signature existence")
+	} else if notExist {
+		return &govcrerr.ErrTamperedCassette{FileName: name, Reason: "the signature file is missing"}
+	}
+
+	sData, err := store.ReadFile(sigName)
+	if err != nil {
+		return errors.Wrap(err, "failed to read signature from source")
+	}
+
+	var sig signatureFile
+	if err = json.Unmarshal(sData, &sig); err != nil {
+		return &govcrerr.ErrTamperedCassette{FileName: name, Reason: "invalid signature file: " + err.Error()}
+	}
+
+	if sig.Kind != signer.Kind() {
+		return &govcrerr.ErrTamperedCassette{FileName: name, Reason: fmt.Sprintf("the signature is of kind '%s' but the signer is of kind '%s'", sig.Kind, signer.Kind())}
+	}
+
+	if err = signer.Verify(data, sig.Signature); err != nil {
+		return &govcrerr.ErrTamperedCassette{FileName: name, Reason: "the signature does not match the file data"}
+	}
+
+	return nil
+}
+
+// SignCassette signs a cassette in storage, which approves its current content, for instance
+// after a hand edit. A directory cassette (i.e. a name that ends with "/") has its index and
+// each of its track files signed.
+func SignCassette(store FileIO, cassetteName string, signer Signer) error {
+	names, err := cassetteFileNames(store, cassetteName)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		data, err := store.ReadFile(name)
+		if err != nil {
+			return errors.Wrap(err, name)
+		}
+
+		if err = writeSignature(store, name, data, signer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IsSigned returns true if a cassette in storage is signed, i.e. it has a signature file.
+// A directory cassette (i.e. a name that ends with "/") is signed when its index is.
+func IsSigned(store FileIO, cassetteName string) (bool, error) {
+	name := cassetteName
+	if strings.HasSuffix(cassetteName, "/") {
+		name += directoryIndexName
+	}
+
+	notExist, err := store.NotExist(name + signatureFileSuffix)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check signature existence")
+	}
+
+	return !notExist, nil
+}
+
+// VerifyCassette verifies the signature of a cassette in storage.
+// It returns an errors.ErrTamperedCassette when a cassette file does not agree with its
+// signature.
+func VerifyCassette(store FileIO, cassetteName string, signer Signer) error {
+	names, err := cassetteFileNames(store, cassetteName)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		data, err := store.ReadFile(name)
+		if err != nil {
+			return errors.Wrap(err, name)
+		}
+
+		if err = verifySignature(store, name, data, signer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cassetteFileNames returns the names of the files of a cassette: the cassette file itself or,
+// for a directory cassette, its index file followed by its track files.
+func cassetteFileNames(store FileIO, cassetteName string) ([]string, error) {
+	if !strings.HasSuffix(cassetteName, "/") {
+		return []string{cassetteName}, nil
+	}
+
+	indexName := cassetteName + directoryIndexName
+
+	data, err := store.ReadFile(indexName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cassette index from source")
+	}
+
+	var index directoryIndex
+	if err = json.Unmarshal(data, &index); err != nil {
+		return nil, errors.Wrap(err, "invalid cassette index")
+	}
+
+	names := []string{indexName}
+	for _, name := range index.Tracks {
+		names = append(names, cassetteName+name)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,714 @@
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette/track"
+	"github.com/seborama/govcr/v17/compression"
+	cryptoerr "github.com/seborama/govcr/v17/encryption/errors"
+)
+
+// Streamed cassettes are encrypted in chunks with the STREAM construction (Hoang, Reyhanitabar,
+// Rogaway and Vizár, "Online Authenticated-Encryption and its Nonce-Reuse Misuse-Resistance"):
+// - the stream header, which has the layout of the V4 header with the chunk size field
+// - chunks of chunk size plaintext bytes, the last of which may be shorter (or even empty),
+// each sealed with the AEAD cipher.
+//
+// The nonce of each chunk is made of a random prefix, which is recorded in the header, the
+// number of the chunk (4 bytes, big endian) and a flag (1 byte) that is set for the last chunk
+// only. This prevents the chunks from being re-ordered, removed or the stream from being
+// truncated. The header is authenticated as associated data with each chunk.
+
+const (
+	// DefaultStreamChunkSize is the default size of the plaintext chunks of streamed cassettes.
+	DefaultStreamChunkSize = 64 * 1024
+
+	// maxStreamChunkSize bounds the memory that a stream header can require.
+	maxStreamChunkSize = 16 * 1024 * 1024
+
+	// maxStreamHeaderSize bounds the size of a stream header.
+	maxStreamHeaderSize = 1024 * 1024
+
+	// streamNonceSuffixSize is the size of the chunk number and last chunk flag of a nonce.
+	streamNonceSuffixSize = 5
+)
+
+// streamWriter encrypts the data written to it as a stream of chunks.
+type streamWriter struct {
+	w           io.Writer
+	aead        cipher.AEAD
+	header      []byte
+	noncePrefix []byte
+	chunkNumber uint32
+	plaintext   []byte
+	ciphertext  []byte
+	err         error
+}
+
+// newStreamWriter writes the stream header to w and returns a streamWriter that encrypts the
+// data written to it to w. The streamWriter must be closed to write the last chunk.
+func newStreamWriter(w io.Writer, crypter Crypter, logicalName string, chunkSize int) (*streamWriter, error) {
+	sc, ok := crypter.(StreamCrypter)
+	if !ok {
+		return nil, errors.New("the cassette crypter does not support streaming")
+	}
+
+	if chunkSize <= 0 || chunkSize > maxStreamChunkSize {
+		return nil, errors.Errorf("stream chunk size must be between 1 and %d", maxStreamChunkSize)
+	}
+
+	aead, params, err := sc.EncryptionStreamCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	if aead.NonceSize() < 12 {
+		return nil, errors.Errorf("the nonce of cipher '%s' is too short for streaming", crypter.Kind())
+	}
+
+	noncePrefix := make([]byte, aead.NonceSize()-streamNonceSuffixSize)
+	if _, err = rand.Read(noncePrefix); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	h := encryptionHeader{
+		kind:      crypter.Kind(),
+		nonce:     noncePrefix,
+		params:    params,
+		name:      logicalName,
+		chunkSize: uint32(chunkSize), //nolint:gosec // bounded by maxStreamChunkSize
+	}
+
+	if kc, ok := crypter.(KeyringCrypter); ok {
+		h.keyID = kc.KeyID()
+	}
+
+	header, err := encodeEncryptionHeader(encryptedCassetteHeaderMarkerStream, &h)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(header); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &streamWriter{
+		w:           w,
+		aead:        aead,
+		header:      header,
+		noncePrefix: noncePrefix,
+		plaintext:   make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// Write encrypts p. A full chunk is only sealed once more data is written, since the last
+// chunk is sealed differently.
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	n := 0
+
+	for sw.err == nil && len(p) > 0 {
+		if len(sw.plaintext) == cap(sw.plaintext) {
+			sw.err = sw.sealChunk(false)
+			continue
+		}
+
+		m := copy(sw.plaintext[len(sw.plaintext):cap(sw.plaintext)], p)
+		sw.plaintext = sw.plaintext[:len(sw.plaintext)+m]
+		p = p[m:]
+		n += m
+	}
+
+	return n, sw.err
+}
+
+// Close seals the last chunk. It does not close the underlying writer.
+func (sw *streamWriter) Close() error {
+	if sw.err != nil {
+		return sw.err
+	}
+
+	sw.err = sw.sealChunk(true)
+	if sw.err == nil {
+		sw.err = errors.New("stream is closed")
+		return nil
+	}
+
+	return sw.err
+}
+
+func (sw *streamWriter) sealChunk(last bool) error {
+	if sw.chunkNumber == math.MaxUint32 {
+		return errors.New("stream has too many chunks")
+	}
+
+	sw.ciphertext = sw.aead.Seal(sw.ciphertext[:0], streamNonce(sw.noncePrefix, sw.chunkNumber, last), sw.plaintext, sw.header)
+	sw.plaintext = sw.plaintext[:0]
+	sw.chunkNumber++
+
+	_, err := sw.w.Write(sw.ciphertext)
+
+	return errors.WithStack(err)
+}
+
+// streamReader decrypts a stream of chunks.
+type streamReader struct {
+	r           *bufio.Reader
+	aead        cipher.AEAD
+	header      []byte
+	noncePrefix []byte
+	chunkNumber uint32
+	ciphertext  []byte
+	plaintext   []byte
+	pos         int
+	last        bool
+}
+
+// newStreamReader reads the stream header from r and returns a streamReader that decrypts the
+// chunks that follow it, along with the header.
+func newStreamReader(r *bufio.Reader, crypter Crypter) (*streamReader, *encryptionHeader, error) {
+	header, err := readStreamHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h, _, err := parseEncryptionHeader(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if h.marker != encryptedCassetteHeaderMarkerStream {
+		return nil, nil, errors.Errorf("encrypted cassette is not a stream: '%s'", h.marker)
+	}
+
+	if h.chunkSize == 0 || h.chunkSize > maxStreamChunkSize {
+		return nil, nil, errors.Errorf("stream chunk size must be between 1 and %d", maxStreamChunkSize)
+	}
+
+	sc, ok := crypter.(StreamCrypter)
+	if !ok {
+		return nil, nil, errors.New("the cassette crypter does not support streaming")
+	}
+
+	if _, isKeyring := crypter.(KeyringCrypter); !isKeyring && h.kind != crypter.Kind() {
+		return nil, nil, errors.Errorf("cassette crypter is '%s' but cassette data indicates '%s'", crypter.Kind(), h.kind)
+	}
+
+	aead, err := sc.DecryptionStreamCipher(h.kind, h.keyID, h.params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(h.nonce)+streamNonceSuffixSize != aead.NonceSize() {
+		return nil, nil, cryptoerr.NewErrCrypto("invalid nonce size for cipher '" + h.kind + "'")
+	}
+
+	return &streamReader{
+		r:           r,
+		aead:        aead,
+		header:      h.aad,
+		noncePrefix: h.nonce,
+		ciphertext:  make([]byte, int(h.chunkSize)+aead.Overhead()),
+	}, h, nil
+}
+
+// readStreamHeader reads the raw stream header from r: the marker and the fields, up to and
+// including the end tag.
+func readStreamHeader(r *bufio.Reader) ([]byte, error) {
+	peek, _ := r.Peek(len(encryptedCassetteHeaderMarkerStream))
+
+	marker := getEncryptionMarker(peek)
+	if marker != encryptedCassetteHeaderMarkerStream {
+		return nil, errors.New("missing stream header marker")
+	}
+
+	header := make([]byte, len(marker))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for len(header) <= maxStreamHeaderSize {
+		tag, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.New("encrypted cassette header is truncated")
+		}
+
+		header = append(header, tag)
+		if tag == headerFieldEnd {
+			return header, nil
+		}
+
+		size := make([]byte, 2)
+		if _, err = io.ReadFull(r, size); err != nil {
+			return nil, errors.New("encrypted cassette header is truncated")
+		}
+
+		value := make([]byte, binary.BigEndian.Uint16(size))
+		if _, err = io.ReadFull(r, value); err != nil {
+			return nil, errors.New("encrypted cassette header is truncated")
+		}
+
+		header = append(header, size...)
+		header = append(header, value...)
+	}
+
+	return nil, errors.New("encrypted cassette header is too long")
+}
+
+// Read decrypts the stream into p.
+func (sr *streamReader) Read(p []byte) (int, error) {
+	for sr.pos == len(sr.plaintext) {
+		if sr.last {
+			return 0, io.EOF
+		}
+
+		if err := sr.openChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, sr.plaintext[sr.pos:])
+	sr.pos += n
+
+	return n, nil
+}
+
+func (sr *streamReader) openChunk() error {
+	n, err := io.ReadFull(sr.r, sr.ciphertext)
+
+	switch {
+	case err == nil:
+		// a full chunk is the last one when it is followed by the end of the stream
+		if _, err = sr.r.Peek(1); errors.Is(err, io.EOF) {
+			sr.last = true
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		sr.last = true
+
+	default:
+		return errors.WithStack(err)
+	}
+
+	if sr.chunkNumber == math.MaxUint32 {
+		return errors.New("stream has too many chunks")
+	}
+
+	sr.plaintext, err = sr.aead.Open(sr.plaintext[:0], streamNonce(sr.noncePrefix, sr.chunkNumber, sr.last), sr.ciphertext[:n], sr.header)
+	if err != nil {
+		return cryptoerr.NewErrCrypto(fmt.Sprintf("failed to decrypt chunk #%d of the cassette stream: %v", sr.chunkNumber, err))
+	}
+
+	sr.pos = 0
+	sr.chunkNumber++
+
+	return nil
+}
+
+// streamNonce returns the nonce of a chunk of the stream.
+func streamNonce(noncePrefix []byte, chunkNumber uint32, last bool) []byte {
+	nonce := make([]byte, len(noncePrefix), len(noncePrefix)+streamNonceSuffixSize)
+	copy(nonce, noncePrefix)
+	nonce = binary.BigEndian.AppendUint32(nonce, chunkNumber)
+
+	if last {
+		return append(nonce, 1)
+	}
+
+	return append(nonce, 0)
+}
+
+// encryptStream encrypts the cassette raw data as a stream of chunks.
+func encryptStream(data []byte, crypter Crypter, logicalName string, chunkSize int) ([]byte, error) {
+	var buf bytes.Buffer
+
+	sw, err := newStreamWriter(&buf, crypter, logicalName, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = sw.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err = sw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decryptStream decrypts the cassette raw data of a stream and returns it with its header.
+func decryptStream(data []byte, crypter Crypter) ([]byte, *encryptionHeader, error) {
+	sr, h, err := newStreamReader(bufio.NewReader(bytes.NewReader(data)), crypter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plaintext, err := io.ReadAll(sr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return plaintext, h, nil
+}
+
+// wantStreaming returns true if the cassette is to be saved as a stream.
+func (k7 *Cassette) wantStreaming() bool {
+	return k7.streamChunkSize > 0 && !k7.IsDirectory() && !k7.IsJSONLines()
+}
+
+// saveStream writes the cassette to storage as a stream.
+// Streaming is refused, rather than holding the cassette in memory, when the store is not a
+// FileStreamer or the cassette is signed, since the signature covers the whole cassette.
+// The caller is responsible for locking the cassette.
+func (k7 *Cassette) saveStream() error {
+	if k7.signer != nil {
+		return errors.New("a signed cassette cannot be streamed: its signature covers the whole cassette")
+	}
+
+	streamer, ok := k7.store.(FileStreamer)
+	if !ok {
+		return errors.New("the cassette store does not support streaming: it must implement cassette.FileStreamer")
+	}
+
+	path := filepath.Dir(k7.name)
+	if err := k7.store.MkdirAll(path, 0o750); err != nil {
+		return errors.Wrap(err, path)
+	}
+
+	return errors.Wrap(streamer.WriteFileStream(k7.name, 0o600, k7.encodeStream), k7.name)
+}
+
+// encodeStream writes the cassette data to w, filters included.
+// The caller is responsible for locking the cassette.
+func (k7 *Cassette) encodeStream(w io.Writer) error {
+	out := w
+
+	var sw *streamWriter
+
+	if k7.wantEncrypted() {
+		var err error
+
+		sw, err = newStreamWriter(w, k7.crypter, k7.logicalName, k7.streamChunkSize)
+		if err != nil {
+			return err
+		}
+
+		out = sw
+	}
+
+	var gw io.WriteCloser
+
+	// compress before encryption to get better results
+	if k7.IsLongPlay() {
+		gw = compression.NewWriter(out)
+		out = gw
+	}
+
+	bw := bufio.NewWriter(out)
+
+	if err := k7.writeTracks(bw); err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if gw != nil {
+		if err := gw.Close(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if sw != nil {
+		return sw.Close()
+	}
+
+	return nil
+}
+
+// writeTracks writes the cassette in JSON to w, track by track, such that the whole JSON
+// is not held in memory. The JSON is the same as that of json.MarshalIndent.
+func (k7 *Cassette) writeTracks(w io.Writer) error {
+	if len(k7.Tracks) == 0 {
+		data, err := json.MarshalIndent(struct {
+			Tracks []track.Track `json:"Tracks"`
+		}{
+			Tracks: k7.Tracks,
+		}, "", "  ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = w.Write(data)
+
+		return errors.WithStack(err)
+	}
+
+	if _, err := io.WriteString(w, "{\n  \"Tracks\": [\n"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for i := range k7.Tracks {
+		trk, err := k7.sealTrack(&k7.Tracks[i])
+		if err != nil {
+			return err
+		}
+
+		data, err := json.MarshalIndent(trk, "    ", "  ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		separator := ",\n"
+		if i == len(k7.Tracks)-1 {
+			separator = "\n"
+		}
+
+		if _, err = io.WriteString(w, "    "); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if _, err = w.Write(data); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if _, err = io.WriteString(w, separator); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	_, err := io.WriteString(w, "  ]\n}")
+
+	return errors.WithStack(err)
+}
+
+// loadStream loads the tracks of a single file cassette from source, track by track.
+// It panics when the cassette exists but cannot be loaded: see LoadCassette.
+func (k7 *Cassette) loadStream(cassetteName string) {
+	r, err := k7.openCassette(cassetteName)
+	if err != nil {
+		panic(fmt.Sprintf("unable to load invalid / corrupted cassette '%s': %+v", cassetteName, err))
+	}
+
+	if r == nil {
+		return
+	}
+
+	defer func() { _ = r.Close() }()
+
+	err = k7.decodeTracks(r)
+	if err == nil {
+		err = k7.unsealTracks()
+	}
+
+	if err != nil {
+		panic(fmt.Sprintf("failed to interpret cassette data in source '%s': %+v", cassetteName, err))
+	}
+
+	k7.existed = true
+}
+
+// openCassette opens the source of a single file cassette as a stream of plain JSON data,
+// i.e. decrypted and decompressed, as needed, or returns nil when the cassette does not exist.
+// Streamed cassettes are decrypted chunk by chunk, other encrypted cassettes are decrypted
+// whole. When the cassette is signed, the cassette is read whole to verify its signature.
+func (k7 *Cassette) openCassette(cassetteName string) (io.ReadCloser, error) {
+	if cassetteName == "" {
+		return nil, errors.New("a cassette name is required")
+	}
+
+	if notExist, err := k7.store.NotExist(cassetteName); err != nil {
+		return nil, errors.Wrap(err, "failed to check cassette existence")
+	} else if notExist {
+		return nil, nil // not found, return nil data
+	}
+
+	src, err := k7.openSource(cassetteName)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader
+
+	br := bufio.NewReader(src)
+	peek, _ := br.Peek(len(encryptedCassetteHeaderMarkerStream))
+
+	switch marker := getEncryptionMarker(peek); {
+	case marker == encryptedCassetteHeaderMarkerStream && k7.wantEncrypted():
+		sr, h, err := newStreamReader(br, k7.crypter)
+		if err != nil {
+			_ = src.Close()
+			return nil, err
+		}
+
+		if err = k7.checkLogicalName(h, "cassette data"); err != nil {
+			_ = src.Close()
+			return nil, err
+		}
+
+		r = sr
+
+	case marker != "":
+		// encrypted whole, or a stream without a crypter: the decryption filter reports it
+		data, err := io.ReadAll(br)
+		if err != nil {
+			_ = src.Close()
+			return nil, errors.WithStack(err)
+		}
+
+		dData, err := k7.DecryptionFilter(data)
+		if err != nil {
+			_ = src.Close()
+			return nil, errors.WithStack(err)
+		}
+
+		r = bytes.NewReader(dData)
+
+	default:
+		r = br
+	}
+
+	if !k7.IsLongPlay() {
+		return &readCloser{Reader: r, close: src.Close}, nil
+	}
+
+	gr, err := compression.NewReader(r)
+	if err != nil {
+		_ = src.Close()
+		return nil, err
+	}
+
+	return &readCloser{
+		Reader: gr,
+		close: func() error {
+			_ = gr.Close()
+			return src.Close()
+		},
+	}, nil
+}
+
+// openSource opens the cassette file for reading.
+func (k7 *Cassette) openSource(cassetteName string) (io.ReadCloser, error) {
+	if streamer, ok := k7.store.(FileStreamer); ok && k7.signer == nil {
+		src, err := streamer.OpenFile(cassetteName)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read cassette data from source")
+		}
+
+		return src, nil
+	}
+
+	data, err := k7.store.ReadFile(cassetteName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cassette data from source")
+	}
+
+	if err = k7.verifySignature(cassetteName, data); err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// readCloser is an io.ReadCloser made of a reader and a close function.
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc *readCloser) Close() error {
+	return rc.close()
+}
+
+// decodeTracks decodes the cassette JSON data from r, track by track, such that the whole
+// JSON is not held in memory.
+func (k7 *Cassette) decodeTracks(r io.Reader) error {
+	dec := json.NewDecoder(r)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// like json.Unmarshal, field names are matched case-insensitively and unknown
+		// fields are ignored.
+		if key, _ := tok.(string); !strings.EqualFold(key, "Tracks") {
+			var discard json.RawMessage
+			if err = dec.Decode(&discard); err != nil {
+				return errors.WithStack(err)
+			}
+
+			continue
+		}
+
+		if err = k7.decodeTrackArray(dec); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+// decodeTrackArray decodes the array of tracks, or null, that comes next from dec.
+func (k7 *Cassette) decodeTrackArray(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tok == nil {
+		k7.Tracks = nil
+		return nil
+	}
+
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return errors.Errorf("invalid cassette: 'Tracks' is not an array")
+	}
+
+	k7.Tracks = []track.Track{}
+
+	for dec.More() {
+		var trk track.Track
+		if err = dec.Decode(&trk); err != nil {
+			return errors.WithStack(err)
+		}
+
+		k7.Tracks = append(k7.Tracks, trk)
+	}
+
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return errors.Errorf("invalid cassette: expected '%s' but found '%v'", want, tok)
+	}
+
+	return nil
+}
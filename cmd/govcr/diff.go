@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/seborama/govcr/v17/cassette/track"
+)
+
+// volatileHeaders are the headers that commonly change from a recording to the next.
+var volatileHeaders = []string{
+	"Age",
+	"Cf-Ray",
+	"Date",
+	"Etag",
+	"Expires",
+	"Last-Modified",
+	"Set-Cookie",
+	"X-Amz-Cf-Id",
+	"X-Amz-Request-Id",
+	"X-Correlation-Id",
+	"X-Request-Id",
+	"X-Trace-Id",
+}
+
+// diffCommand reports the interactions that were added, removed or changed from the tracks of
+// cassette a to those of cassette b. Tracks are paired by request method and URL, in sequence
+// when the same request was placed several times.
+// It returns true when the cassettes differ.
+func diffCommand(w io.Writer, a, b string, ignoreHeaders []string, ignoreVolatileHeaders bool, flags *crypterFlags) (bool, error) {
+	k7a, err := flags.openCassette(a)
+	if err != nil {
+		return false, err
+	}
+
+	k7b, err := flags.openCassette(b)
+	if err != nil {
+		return false, err
+	}
+
+	ignored := map[string]struct{}{}
+
+	if ignoreVolatileHeaders {
+		ignoreHeaders = append(ignoreHeaders, volatileHeaders...)
+	}
+
+	for _, h := range ignoreHeaders {
+		ignored[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+
+	differ := false
+
+	for _, pair := range pairTracks(k7a.Tracks, k7b.Tracks) {
+		switch {
+		case pair.a == nil:
+			_, _ = fmt.Fprintf(w, "+ %s (added)\n", requestLine(pair.b))
+			differ = true
+
+		case pair.b == nil:
+			_, _ = fmt.Fprintf(w, "- %s (removed)\n", requestLine(pair.a))
+			differ = true
+
+		default:
+			changes := diffTracks(pair.a, pair.b, ignored)
+			if len(changes) == 0 {
+				continue
+			}
+
+			_, _ = fmt.Fprintf(w, "~ %s\n", requestLine(pair.a))
+			for _, change := range changes {
+				_, _ = fmt.Fprintf(w, "    %s\n", change)
+			}
+
+			differ = true
+		}
+	}
+
+	return differ, nil
+}
+
+type trackPair struct {
+	a *track.Track
+	b *track.Track
+}
+
+// pairTracks pairs the tracks of a and b by request, in the order of a followed by the tracks
+// that are only in b.
+func pairTracks(a, b []track.Track) []trackPair {
+	pending := map[string][]*track.Track{}
+	for i := range b {
+		key := requestLine(&b[i])
+		pending[key] = append(pending[key], &b[i])
+	}
+
+	paired := map[*track.Track]struct{}{}
+
+	var pairs []trackPair
+
+	for i := range a {
+		pair := trackPair{a: &a[i]}
+
+		key := requestLine(&a[i])
+		if candidates := pending[key]; len(candidates) > 0 {
+			pair.b = candidates[0]
+			pending[key] = candidates[1:]
+			paired[pair.b] = struct{}{}
+		}
+
+		pairs = append(pairs, pair)
+	}
+
+	for i := range b {
+		if _, ok := paired[&b[i]]; !ok {
+			pairs = append(pairs, trackPair{b: &b[i]})
+		}
+	}
+
+	return pairs
+}
+
+func requestLine(trk *track.Track) string {
+	return trk.Request.Method + " " + trackURL(trk)
+}
+
+// diffTracks returns the changes from track a to track b.
+func diffTracks(a, b *track.Track, ignoredHeaders map[string]struct{}) []string {
+	var changes []string
+
+	changes = append(changes, diffHeaders("request header", a.Request.Header, b.Request.Header, ignoredHeaders)...)
+	changes = append(changes, diffBodies("request body", a.Request.Header, a.Request.Body, b.Request.Header, b.Request.Body)...)
+
+	if errA, errB := derefString(a.ErrType)+" "+derefString(a.ErrMsg), derefString(b.ErrType)+" "+derefString(b.ErrMsg); errA != errB {
+		changes = append(changes, fmt.Sprintf("error: %q -> %q", strings.TrimSpace(errA), strings.TrimSpace(errB)))
+	}
+
+	switch {
+	case a.Response == nil && b.Response == nil:
+
+	case a.Response == nil:
+		changes = append(changes, "response: (absent) -> "+b.Response.Status)
+
+	case b.Response == nil:
+		changes = append(changes, "response: "+a.Response.Status+" -> (absent)")
+
+	default:
+		if a.Response.Status != b.Response.Status {
+			changes = append(changes, fmt.Sprintf("response status: %s -> %s", a.Response.Status, b.Response.Status))
+		}
+
+		changes = append(changes, diffHeaders("response header", a.Response.Header, b.Response.Header, ignoredHeaders)...)
+		changes = append(changes, diffBodies("response body", a.Response.Header, a.Response.Body, b.Response.Header, b.Response.Body)...)
+	}
+
+	return changes
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+// diffHeaders returns the changes from header a to header b, ignored headers excepted.
+func diffHeaders(field string, a, b http.Header, ignored map[string]struct{}) []string {
+	keys := map[string]struct{}{}
+	for key := range a {
+		keys[http.CanonicalHeaderKey(key)] = struct{}{}
+	}
+
+	for key := range b {
+		keys[http.CanonicalHeaderKey(key)] = struct{}{}
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		if _, ok := ignored[key]; !ok {
+			sortedKeys = append(sortedKeys, key)
+		}
+	}
+
+	sort.Strings(sortedKeys)
+
+	var changes []string
+
+	for _, key := range sortedKeys {
+		valuesA, valuesB := a.Values(key), b.Values(key)
+
+		switch {
+		case reflect.DeepEqual(valuesA, valuesB):
+
+		case len(valuesA) == 0:
+			changes = append(changes, fmt.Sprintf("%s %s: (absent) -> %q", field, key, valuesB))
+
+		case len(valuesB) == 0:
+			changes = append(changes, fmt.Sprintf("%s %s: %q -> (absent)", field, key, valuesA))
+
+		default:
+			changes = append(changes, fmt.Sprintf("%s %s: %q -> %q", field, key, valuesA, valuesB))
+		}
+	}
+
+	return changes
+}
+
+// diffBodies returns the changes from body a to body b. JSON bodies are compared structurally.
+func diffBodies(field string, headerA http.Header, a []byte, headerB http.Header, b []byte) []string {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+
+	if bodyKind(headerA, a) == "json" && bodyKind(headerB, b) == "json" {
+		var valueA, valueB any
+
+		if decodeJSON(a, &valueA) == nil && decodeJSON(b, &valueB) == nil {
+			var changes []string
+			diffJSON(field+" $", valueA, valueB, &changes)
+
+			return changes
+		}
+	}
+
+	return []string{fmt.Sprintf("%s: differs (%d bytes -> %d bytes)", field, len(a), len(b))}
+}
+
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	return dec.Decode(v)
+}
+
+// diffJSON appends to changes the differences from JSON value a to JSON value b, by path.
+func diffJSON(path string, a, b any, changes *[]string) {
+	switch valueA := a.(type) {
+	case map[string]any:
+		valueB, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+
+		keys := map[string]struct{}{}
+		for key := range valueA {
+			keys[key] = struct{}{}
+		}
+
+		for key := range valueB {
+			keys[key] = struct{}{}
+		}
+
+		sortedKeys := make([]string, 0, len(keys))
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+
+		sort.Strings(sortedKeys)
+
+		for _, key := range sortedKeys {
+			subA, okA := valueA[key]
+			subB, okB := valueB[key]
+
+			switch {
+			case !okA:
+				*changes = append(*changes, fmt.Sprintf("%s.%s: (absent) -> %s", path, key, jsonString(subB)))
+			case !okB:
+				*changes = append(*changes, fmt.Sprintf("%s.%s: %s -> (absent)", path, key, jsonString(subA)))
+			default:
+				diffJSON(path+"."+key, subA, subB, changes)
+			}
+		}
+
+		return
+
+	case []any:
+		valueB, ok := b.([]any)
+		if !ok {
+			break
+		}
+
+		for i := 0; i < len(valueA) || i < len(valueB); i++ {
+			itemPath := path + "[" + strconv.Itoa(i) + "]"
+
+			switch {
+			case i >= len(valueA):
+				*changes = append(*changes, fmt.Sprintf("%s: (absent) -> %s", itemPath, jsonString(valueB[i])))
+			case i >= len(valueB):
+				*changes = append(*changes, fmt.Sprintf("%s: %s -> (absent)", itemPath, jsonString(valueA[i])))
+			default:
+				diffJSON(itemPath, valueA[i], valueB[i], changes)
+			}
+		}
+
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, jsonString(a), jsonString(b)))
+	}
+}
+
+func jsonString(v any) string {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return abbreviate(strings.TrimSpace(buf.String()), 200)
+}
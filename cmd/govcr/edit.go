@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette/track"
+)
+
+// editedCassette is the structure of the cassette presented to the editor.
+type editedCassette struct {
+	Tracks []track.Track `json:"Tracks"`
+}
+
+// editCommand decrypts and decompresses the cassette to a temporary file, which it opens with
+// the editor. When the edited file is a valid cassette, the cassette is saved with its tracks,
+// encrypted and compressed like it was. An invalid file is reported and opened again with the
+// editor, until it is valid or it is left unchanged, which abandons the edit.
+// The cassette keeps its settings, such as its logical name, its field encryption and its
+// signature. The files of the temporary directory, including those of the editor such as its
+// swap and backup files, are overwritten before they are removed.
+func editCommand(cassetteFile string, editor func(path string) error, flags *crypterFlags) error {
+	k7, err := flags.openCassette(cassetteFile)
+	if err != nil {
+		return err
+	}
+
+	original, err := json.MarshalIndent(editedCassette{Tracks: k7.Tracks}, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dir, err := os.MkdirTemp("", "govcr-edit-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() { _ = shredDir(dir) }()
+
+	tempFile := filepath.Join(dir, "cassette.json")
+
+	if err = os.WriteFile(tempFile, original, 0o600); err != nil {
+		return errors.WithStack(err)
+	}
+
+	previous := original
+
+	for {
+		if err = editor(tempFile); err != nil {
+			return errors.Wrap(err, "editor")
+		}
+
+		edited, err := os.ReadFile(tempFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if bytes.Equal(edited, original) {
+			fmt.Println("unchanged:", cassetteFile)
+			return nil
+		}
+
+		tracks, err := parseEditedCassette(edited)
+		if err == nil {
+			if err = k7.ReplaceTracks(tracks); err != nil {
+				return errors.Wrap(err, cassetteFile)
+			}
+
+			fmt.Println("edited:", cassetteFile)
+
+			return nil
+		}
+
+		if bytes.Equal(edited, previous) {
+			return errors.Wrap(err, "edit abandoned, the cassette is unchanged")
+		}
+
+		fmt.Println("invalid cassette:", err)
+		fmt.Println("please correct the cassette, or leave it unchanged to abandon the edit")
+
+		previous = edited
+	}
+}
+
+// parseEditedCassette returns the tracks of the edited cassette. The cassette must have the
+// structure of a cassette and its tracks must each have a request method and URL.
+func parseEditedCassette(data []byte) ([]track.Track, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var k7 editedCassette
+
+	if err := dec.Decode(&k7); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if dec.More() {
+		return nil, errors.New("unexpected data after the cassette")
+	}
+
+	for i := range k7.Tracks {
+		if k7.Tracks[i].Request.Method == "" {
+			return nil, errors.Errorf("track #%d: the request has no method", i)
+		}
+
+		if k7.Tracks[i].Request.URL == nil {
+			return nil, errors.Errorf("track #%d: the request has no URL", i)
+		}
+	}
+
+	return k7.Tracks, nil
+}
+
+// runEditor opens the file with the editor of the VISUAL or EDITOR environment variable, or vi.
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	if editor == "" {
+		editor = "vi"
+	}
+
+	args := strings.Fields(editor)
+
+	cmd := exec.Command(args[0], append(args[1:], path)...) //nolint:gosec // the editor is chosen by the user
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return errors.WithStack(cmd.Run())
+}
+
+// shredDir shreds the files of the directory and its sub-directories, before it removes it.
+func shredDir(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		return shred(path)
+	})
+
+	if removeErr := os.RemoveAll(dir); err == nil {
+		err = removeErr
+	}
+
+	return errors.WithStack(err)
+}
+
+// shred overwrites the file with zeros before it removes it, such that the decrypted cassette
+// does not linger in the file system.
+func shred(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return errors.WithStack(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = f.Write(make([]byte, info.Size()))
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if removeErr := os.Remove(path); err == nil {
+		err = removeErr
+	}
+
+	return errors.WithStack(err)
+}
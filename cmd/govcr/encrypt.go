@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette"
+	"github.com/seborama/govcr/v17/fileio"
+)
+
+// encryptCommand encrypts plain cassettes with a key and a cipher.
+func encryptCommand(pattern, keyFile, keyEnv, cipherKind string, signFlags *signerFlags) error {
+	keyProvider, err := makeKeyProvider(keyFile, keyEnv)
+	if err != nil {
+		return err
+	}
+
+	key, err := keyProvider.Key()
+	if err != nil {
+		return err
+	}
+
+	return changeCassettesEncryption("encrypted", pattern, nil, key, cipherKind, signFlags)
+}
+
+// reencryptCommand re-encrypts encrypted cassettes from a key to another key.
+// The cipher of each cassette is kept unless cipherKind is set.
+func reencryptCommand(pattern, fromKeyFile, toKeyFile, cipherKind string, signFlags *signerFlags) error {
+	if fromKeyFile == "" || toKeyFile == "" {
+		return errors.New("please specify the current key file with the 'from-key' argument and the new key file with the 'to-key' argument")
+	}
+
+	if fromKeyFile == "-" && toKeyFile == "-" {
+		return errors.New("only one of the 'from-key' and 'to-key' arguments can be read from the standard input")
+	}
+
+	fromKey, err := readKeyFile(fromKeyFile)
+	if err != nil {
+		return errors.Wrap(err, "from-key")
+	}
+
+	toKey, err := readKeyFile(toKeyFile)
+	if err != nil {
+		return errors.Wrap(err, "to-key")
+	}
+
+	return changeCassettesEncryption("re-encrypted", pattern, fromKey, toKey, cipherKind, signFlags)
+}
+
+// convertCommand re-encrypts encrypted cassettes with another cipher and the same key.
+func convertCommand(pattern, keyFile, keyEnv, cipherKind string, signFlags *signerFlags) error {
+	if cipherKind == "" {
+		return errors.New("please specify the new cipher with the 'cipher' argument: aesgcm or chacha20poly1305")
+	}
+
+	keyProvider, err := makeKeyProvider(keyFile, keyEnv)
+	if err != nil {
+		return err
+	}
+
+	key, err := keyProvider.Key()
+	if err != nil {
+		return err
+	}
+
+	return changeCassettesEncryption("converted", pattern, key, key, cipherKind, signFlags)
+}
+
+func readKeyFile(keyFile string) ([]byte, error) {
+	keyProvider, err := makeKeyProvider(keyFile, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return keyProvider.Key()
+}
+
+// changeCassettesEncryption changes the encryption of the cassettes that match the pattern.
+// fromKey is nil for plain cassettes. An empty toCipherKind keeps the cipher of each cassette.
+// It reports each cassette that it changes with the verb.
+func changeCassettesEncryption(verb, pattern string, fromKey, toKey []byte, toCipherKind string, signFlags *signerFlags) error {
+	names, err := cassetteNames(pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err = changeCassetteEncryption(name, fromKey, toKey, toCipherKind, signFlags); err != nil {
+			return errors.Wrap(err, name)
+		}
+
+		fmt.Println(verb+":", name)
+	}
+
+	return nil
+}
+
+// changeCassetteEncryption loads the cassette with fromKey, or as a plain cassette when fromKey
+// is nil, and saves it encrypted with toKey. A signed cassette is signed again, and the logical
+// name and the streaming of an encrypted cassette are preserved.
+func changeCassetteEncryption(name string, fromKey, toKey []byte, toCipherKind string, signFlags *signerFlags) error {
+	kind, err := cassette.CipherKind(&fileio.OSFile{}, name)
+	if err != nil {
+		return err
+	}
+
+	opts, err := signFlags.signerOptions(name)
+	if err != nil {
+		return err
+	}
+
+	encryptionOpts, err := cassette.EncryptionOptions(&fileio.OSFile{}, name)
+	if err != nil {
+		return err
+	}
+
+	opts = append(opts, encryptionOpts...)
+
+	switch {
+	case fromKey == nil && kind != "":
+		return errors.Errorf("cassette is already encrypted ('%s')", kind)
+
+	case fromKey != nil && kind == "":
+		return errors.New("cassette is not encrypted")
+
+	case fromKey != nil:
+		newCrypter, err := payloadCipher(kind)
+		if err != nil {
+			return errors.Wrap(err, "cassette header")
+		}
+
+		crypter, err := newCrypter(fromKey)
+		if err != nil {
+			return errors.Wrap(err, "cryptographer")
+		}
+
+		opts = append(opts, cassette.WithCrypter(crypter))
+	}
+
+	if toCipherKind == "" {
+		toCipherKind = kind
+	}
+
+	newCrypter, err := payloadCipher(toCipherKind)
+	if err != nil {
+		return err
+	}
+
+	crypter, err := newCrypter(toKey)
+	if err != nil {
+		return errors.Wrap(err, "cryptographer")
+	}
+
+	k7, err := loadCassette(name, opts...)
+	if err != nil {
+		return err
+	}
+
+	return k7.SetCrypter(crypter)
+}
+
+// cassetteNames returns the names of the cassettes that match the pattern (see filepath.Match).
+// Directory cassettes are named with a trailing "/". Signature files are ignored.
+func cassetteNames(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, errors.New("please specify a cassette file or a glob pattern with the 'cassette-file' argument")
+	}
+
+	matches, err := filepath.Glob(strings.TrimSuffix(pattern, "/"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var names []string
+
+	for _, match := range matches {
+		if strings.HasSuffix(match, ".sig") {
+			continue
+		}
+
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if info.IsDir() {
+			match += "/"
+		}
+
+		names = append(names, match)
+	}
+
+	if len(names) == 0 {
+		return nil, errors.Errorf("no cassette matches '%s'", pattern)
+	}
+
+	return names, nil
+}
+
+// loadCassette loads a cassette and returns an error rather than panic when the cassette
+// cannot be loaded.
+func loadCassette(name string, opts ...cassette.Option) (k7 *cassette.Cassette, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("%v", r)
+		}
+	}()
+
+	return cassette.LoadCassette(name, opts...), nil
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette"
+	"github.com/seborama/govcr/v17/cassette/track"
+	"github.com/seborama/govcr/v17/encryption"
+	"github.com/seborama/govcr/v17/fileio"
+)
+
+// crypterFlags holds the flags that supply the key or the passphrase of encrypted cassettes
+// to the commands that read cassettes, and the signing key of signed cassettes to the
+// commands that write cassettes.
+type crypterFlags struct {
+	keyFile        string
+	keyEnv         string
+	passphraseFile string
+	passphraseEnv  string
+
+	// signer is nil for the commands that only read cassettes.
+	signer *signerFlags
+}
+
+func addCrypterFlags(fs *flag.FlagSet) *crypterFlags {
+	f := &crypterFlags{}
+
+	fs.StringVar(&f.keyFile, "key-file", "", "location of the encryption key file of encrypted cassettes, or '-' to read the key from the standard input")
+	fs.StringVar(&f.keyEnv, "key-env", "", "name of the environment variable that holds the encryption key of encrypted cassettes in base64 format")
+	fs.StringVar(&f.passphraseFile, "passphrase-file", "", "location of the encryption passphrase file of encrypted cassettes, or '-' to read the passphrase from the standard input")
+	fs.StringVar(&f.passphraseEnv, "passphrase-env", "", "name of the environment variable that holds the encryption passphrase of encrypted cassettes")
+
+	return f
+}
+
+// addWriterCrypterFlags adds the crypter flags and the signer flags, for the commands that
+// write cassettes.
+func addWriterCrypterFlags(fs *flag.FlagSet) *crypterFlags {
+	f := addCrypterFlags(fs)
+	f.signer = addSignerFlags(fs)
+
+	return f
+}
+
+// openCassette loads a cassette, which may be compressed and encrypted. An encrypted cassette
+// is decrypted with the cipher recorded in its header and the key or passphrase of the flags.
+func (f *crypterFlags) openCassette(name string) (*cassette.Cassette, error) {
+	opts, err := f.cassetteOptions(name)
+	if err != nil {
+		return nil, errors.Wrap(err, name)
+	}
+
+	k7, err := loadCassette(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if k7.IsNew() {
+		return nil, errors.Errorf("cassette '%s' does not exist", name)
+	}
+
+	return k7, nil
+}
+
+// cassetteOptions returns the options to load the cassette: its crypter, if it is encrypted,
+// whole or by field, the encryption settings recorded in its encryption headers, and its signer,
+// if it is signed and the command writes cassettes. The cassette is saved with the same settings.
+func (f *crypterFlags) cassetteOptions(name string) ([]cassette.Option, error) {
+	var opts []cassette.Option
+
+	if f.signer != nil {
+		var err error
+
+		if opts, err = f.signer.signerOptions(name); err != nil {
+			return nil, err
+		}
+	}
+
+	kind, err := cassette.CipherKind(&fileio.OSFile{}, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == "" {
+		fields, err := cassette.FindEncryptedFields(name, opts...)
+		if err != nil || fields == nil {
+			// a cassette that cannot be read is reported when it is loaded.
+			return opts, nil //nolint:nilerr // see above
+		}
+
+		crypter, err := f.crypter(fields.Kind)
+		if err != nil {
+			return nil, err
+		}
+
+		if fields.LogicalName != "" {
+			opts = append(opts, cassette.WithLogicalName(fields.LogicalName))
+		}
+
+		return append(opts, cassette.WithFieldEncryption(crypter, fields.Fields)), nil
+	}
+
+	encryptionOpts, err := cassette.EncryptionOptions(&fileio.OSFile{}, name)
+	if err != nil {
+		return nil, err
+	}
+
+	crypter, err := f.crypter(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(opts, encryptionOpts...), cassette.WithCrypter(crypter)), nil
+}
+
+// crypter returns the crypter of the cipher kind, with the key or the passphrase of the flags.
+func (f *crypterFlags) crypter(kind string) (cassette.Crypter, error) {
+	var (
+		keyProvider, passphrase encryption.KeyProvider
+		err                     error
+	)
+
+	if f.keyFile != "" || f.keyEnv != "" {
+		if keyProvider, err = makeKeyProvider(f.keyFile, f.keyEnv); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.passphraseFile != "" || f.passphraseEnv != "" {
+		if passphrase, err = makePassphraseProvider(f.passphraseFile, f.passphraseEnv); err != nil {
+			return nil, err
+		}
+	}
+
+	return makeCrypter(kind, keyProvider, passphrase)
+}
+
+// lsCommand prints one line per track of the cassette.
+func lsCommand(w io.Writer, cassetteFile string, flags *crypterFlags) error {
+	k7, err := flags.openCassette(cassetteFile)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "#\tUUID\tMETHOD\tURL\tSTATUS\tREQUEST BODY\tRESPONSE BODY")
+
+	for i, trk := range k7.Tracks {
+		status := "-"
+		responseBodySize := "-"
+
+		switch {
+		case trk.ErrType != nil:
+			status = "error: " + *trk.ErrType
+		case trk.Response != nil:
+			status = strconv.Itoa(trk.Response.StatusCode)
+			responseBodySize = strconv.Itoa(len(trk.Response.Body))
+		}
+
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			i, trk.UUID, trk.Request.Method, trackURL(&trk), status, len(trk.Request.Body), responseBodySize)
+	}
+
+	return errors.WithStack(tw.Flush())
+}
+
+// showCommand prints a track of the cassette, by number or UUID, with its bodies decoded as
+// JSON or text when their content type permits.
+func showCommand(w io.Writer, cassetteFile, trackRef string, flags *crypterFlags) error {
+	k7, err := flags.openCassette(cassetteFile)
+	if err != nil {
+		return err
+	}
+
+	trk, err := findTrack(k7, trackRef)
+	if err != nil {
+		return err
+	}
+
+	view := trackView{
+		Request: requestView{
+			Method: trk.Request.Method,
+			URL:    trackURL(trk),
+			Header: trk.Request.Header,
+			Body:   bodyView(trk.Request.Header, trk.Request.Body),
+		},
+		ErrType: trk.ErrType,
+		ErrMsg:  trk.ErrMsg,
+		UUID:    trk.UUID,
+	}
+
+	if trk.Response != nil {
+		view.Response = &responseView{
+			Status: trk.Response.Status,
+			Header: trk.Response.Header,
+			Body:   bodyView(trk.Response.Header, trk.Response.Body),
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	return errors.WithStack(enc.Encode(view))
+}
+
+// trackView is the presentation of a track by the show command.
+type trackView struct {
+	Request  requestView   `json:"Request"`
+	Response *responseView `json:"Response,omitempty"`
+	ErrType  *string       `json:"ErrType,omitempty"`
+	ErrMsg   *string       `json:"ErrMsg,omitempty"`
+	UUID     string        `json:"UUID"`
+}
+
+type requestView struct {
+	Method string      `json:"Method"`
+	URL    string      `json:"URL"`
+	Header http.Header `json:"Header,omitempty"`
+	Body   any         `json:"Body,omitempty"`
+}
+
+type responseView struct {
+	Status string      `json:"Status"`
+	Header http.Header `json:"Header,omitempty"`
+	Body   any         `json:"Body,omitempty"`
+}
+
+// findTrack returns the track of the cassette with the number or the UUID of trackRef.
+func findTrack(k7 *cassette.Cassette, trackRef string) (*track.Track, error) {
+	if n, err := strconv.Atoi(trackRef); err == nil {
+		if n < 0 || n >= len(k7.Tracks) {
+			return nil, errors.Errorf("track #%d is not on the cassette, which has %d tracks", n, len(k7.Tracks))
+		}
+
+		return &k7.Tracks[n], nil
+	}
+
+	for i := range k7.Tracks {
+		if k7.Tracks[i].UUID == trackRef {
+			return &k7.Tracks[i], nil
+		}
+	}
+
+	return nil, errors.Errorf("track '%s' is not on the cassette", trackRef)
+}
+
+// bodyView returns the body as JSON, when the content type is JSON, as text, when the content
+// type is textual, or as base64 otherwise.
+func bodyView(header http.Header, body []byte) any {
+	if len(body) == 0 {
+		return nil
+	}
+
+	switch bodyKind(header, body) {
+	case "json":
+		return json.RawMessage(body)
+	case "text":
+		return string(body)
+	}
+
+	return "base64:" + base64.StdEncoding.EncodeToString(body)
+}
+
+// bodyKind returns the kind of the body: "json", "text" or "binary".
+func bodyKind(header http.Header, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+
+	switch {
+	case (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) && json.Valid(body):
+		return "json"
+
+	case mediaType != "" && !isTextMediaType(mediaType):
+		return "binary"
+
+	case utf8.Valid(body):
+		return "text"
+	}
+
+	return "binary"
+}
+
+func isTextMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/javascript" ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+func trackURL(trk *track.Track) string {
+	if trk.Request.URL == nil {
+		return ""
+	}
+
+	return trk.Request.URL.String()
+}
+
+// grepCommand prints the URLs, headers and body lines of the tracks of the cassettes that
+// match the regular expression. It returns false when nothing matches.
+func grepCommand(w io.Writer, pattern string, cassetteFiles []string, flags *crypterFlags) (bool, error) {
+	if len(cassetteFiles) == 0 {
+		return false, errors.New("please specify a regular expression and one or more cassettes")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	found := false
+
+	for _, cassetteFile := range cassetteFiles {
+		k7, err := flags.openCassette(cassetteFile)
+		if err != nil {
+			return found, err
+		}
+
+		for i := range k7.Tracks {
+			for _, m := range grepTrack(re, &k7.Tracks[i]) {
+				_, _ = fmt.Fprintf(w, "%s:%d:%s\n", cassetteFile, i, m)
+				found = true
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// grepTrack returns the fields of the track that match the regular expression, in the format
+// "field: value". Bodies are searched line by line, binary bodies are not searched.
+func grepTrack(re *regexp.Regexp, trk *track.Track) []string {
+	var matches []string
+
+	if u := trackURL(trk); re.MatchString(u) {
+		matches = append(matches, "url: "+u)
+	}
+
+	matches = append(matches, grepHeader(re, "request header", trk.Request.Header)...)
+	matches = append(matches, grepBody(re, "request body", trk.Request.Header, trk.Request.Body)...)
+
+	if trk.Response != nil {
+		matches = append(matches, grepHeader(re, "response header", trk.Response.Header)...)
+		matches = append(matches, grepBody(re, "response body", trk.Response.Header, trk.Response.Body)...)
+	}
+
+	return matches
+}
+
+func grepHeader(re *regexp.Regexp, field string, header http.Header) []string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var matches []string
+
+	for _, key := range keys {
+		for _, value := range header[key] {
+			if line := key + ": " + value; re.MatchString(line) {
+				matches = append(matches, field+": "+line)
+			}
+		}
+	}
+
+	return matches
+}
+
+func grepBody(re *regexp.Regexp, field string, header http.Header, body []byte) []string {
+	if len(body) == 0 || bodyKind(header, body) == "binary" {
+		return nil
+	}
+
+	var matches []string
+
+	for _, line := range bytes.Split(body, []byte{'\n'}) {
+		if re.Match(line) {
+			matches = append(matches, field+": "+abbreviate(string(bytes.TrimSpace(line)), 200))
+		}
+	}
+
+	return matches
+}
+
+// abbreviate returns s shortened to about max characters.
+func abbreviate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+
+	for i := range s {
+		if i >= maxLen {
+			return s[:i] + "..."
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette/track"
+	"github.com/seborama/govcr/v17/secrets"
+)
+
+// The lint checks.
+const (
+	lintCheckLoad          = "load"
+	lintCheckError         = "error"
+	lintCheckContentLength = "content-length"
+	lintCheckDuplicate     = "duplicate"
+	lintCheckSecret        = "secret"
+	lintCheckBodySize      = "body-size"
+)
+
+var lintChecks = []string{
+	lintCheckLoad,
+	lintCheckError,
+	lintCheckContentLength,
+	lintCheckDuplicate,
+	lintCheckSecret,
+	lintCheckBodySize,
+}
+
+// lintProblem is a problem found on a cassette by the lint command.
+type lintProblem struct {
+	Cassette string `json:"Cassette"`
+	Track    *int   `json:"Track,omitempty"`
+	UUID     string `json:"UUID,omitempty"`
+	Check    string `json:"Check"`
+	Message  string `json:"Message"`
+}
+
+// lintOptions holds the settings of the lint command.
+type lintOptions struct {
+	format      string
+	maxBodySize int
+	disabled    []string
+}
+
+// lintCommand checks the cassettes found at the paths, which are cassettes or directories that
+// are searched for cassettes, and reports their problems in the text or the JSON format.
+// It returns true when problems are found.
+func lintCommand(w io.Writer, paths []string, opts lintOptions, flags *crypterFlags) (bool, error) {
+	if len(paths) == 0 {
+		return false, errors.New("please specify one or more cassettes or directories")
+	}
+
+	if opts.format != "text" && opts.format != "json" {
+		return false, errors.Errorf("unknown format '%s': expected text or json", opts.format)
+	}
+
+	disabled := map[string]struct{}{}
+
+	for _, check := range opts.disabled {
+		if !slices.Contains(lintChecks, check) {
+			return false, errors.Errorf("unknown check '%s': expected one of %s", check, strings.Join(lintChecks, ", "))
+		}
+
+		disabled[check] = struct{}{}
+	}
+
+	problems := []lintProblem{}
+
+	for _, path := range paths {
+		names, err := lintCassetteNames(path)
+		if err != nil {
+			return false, err
+		}
+
+		for _, name := range names {
+			for _, problem := range lintCassette(name, opts.maxBodySize, flags) {
+				if _, ok := disabled[problem.Check]; !ok {
+					problems = append(problems, problem)
+				}
+			}
+		}
+	}
+
+	if opts.format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+
+		return len(problems) > 0, errors.WithStack(enc.Encode(problems))
+	}
+
+	for _, problem := range problems {
+		location := problem.Cassette
+		if problem.Track != nil {
+			location += ":" + strconv.Itoa(*problem.Track)
+		}
+
+		_, _ = fmt.Fprintf(w, "%s: %s: %s\n", location, problem.Check, problem.Message)
+	}
+
+	return len(problems) > 0, nil
+}
+
+// lintCassetteExtensions are the extensions of the cassette files.
+var lintCassetteExtensions = []string{".json", ".jsonl", ".json.gz", ".jsonl.gz"}
+
+// lintCassetteNames returns the cassettes at the path. A directory that holds the index of a
+// directory cassette is a cassette, other directories are searched for the cassette files
+// and the directory cassettes that they contain.
+func lintCassetteNames(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var names []string
+
+	err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if _, err := os.Stat(filepath.Join(name, "index.json")); err == nil {
+				names = append(names, name+"/")
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if isLintCassetteFile(name) {
+			names = append(names, name)
+		}
+
+		return nil
+	})
+
+	return names, errors.WithStack(err)
+}
+
+// isLintCassetteFile returns true if the file has the extension of a cassette and, for a plain
+// JSON file, holds the tracks of a cassette, such that the other JSON files of a project, such
+// as package.json, are not linted. A JSON file that is not valid JSON, such as an encrypted or
+// a corrupt cassette, is linted.
+func isLintCassetteFile(name string) bool {
+	base := filepath.Base(name)
+
+	if !slices.ContainsFunc(lintCassetteExtensions, func(ext string) bool { return strings.HasSuffix(base, ext) }) {
+		return false
+	}
+
+	if !strings.HasSuffix(base, ".json") {
+		return true
+	}
+
+	data, err := os.ReadFile(name) //nolint:gosec // the files under the path given by the user are read
+	if err != nil || !json.Valid(data) {
+		return true
+	}
+
+	var k7 map[string]json.RawMessage
+	if err = json.Unmarshal(data, &k7); err != nil {
+		return false
+	}
+
+	_, ok := k7["Tracks"]
+
+	return ok
+}
+
+// lintCassette returns the problems of the cassette.
+func lintCassette(name string, maxBodySize int, flags *crypterFlags) []lintProblem {
+	k7, err := flags.openCassette(name)
+	if err != nil {
+		// the first line of the error omits the stack trace of the panic, if any.
+		message, _, _ := strings.Cut(err.Error(), "\n")
+
+		return []lintProblem{{Cassette: name, Check: lintCheckLoad, Message: message}}
+	}
+
+	var problems []lintProblem
+
+	requests := map[string]int{}
+
+	for i := range k7.Tracks {
+		trk := &k7.Tracks[i]
+
+		report := func(check, format string, args ...any) {
+			problems = append(problems, lintProblem{
+				Cassette: name,
+				Track:    &i,
+				UUID:     trk.UUID,
+				Check:    check,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		if trk.ErrType != nil {
+			report(lintCheckError, "the request failed with %s: %s", *trk.ErrType, derefString(trk.ErrMsg))
+		}
+
+		key := requestLine(trk) + "\n" + string(trk.Request.Body)
+		if j, ok := requests[key]; ok {
+			report(lintCheckDuplicate, "the request %s duplicates track #%d", requestLine(trk), j)
+		} else {
+			requests[key] = i
+		}
+
+		if trk.Request.ContentLength > 0 && trk.Request.ContentLength != int64(len(trk.Request.Body)) {
+			report(lintCheckContentLength, "the request body is %d bytes but its ContentLength is %d", len(trk.Request.Body), trk.Request.ContentLength)
+		}
+
+		if resp := trk.Response; resp != nil && !resp.Uncompressed && resp.ContentLength >= 0 &&
+			trk.Request.Method != http.MethodHead && resp.StatusCode != http.StatusNotModified &&
+			resp.ContentLength != int64(len(resp.Body)) {
+			report(lintCheckContentLength, "the response body is %d bytes but its ContentLength is %d", len(resp.Body), resp.ContentLength)
+		}
+
+		if maxBodySize > 0 {
+			if len(trk.Request.Body) > maxBodySize {
+				report(lintCheckBodySize, "the request body is %d bytes, which is over %d bytes", len(trk.Request.Body), maxBodySize)
+			}
+
+			if trk.Response != nil && len(trk.Response.Body) > maxBodySize {
+				report(lintCheckBodySize, "the response body is %d bytes, which is over %d bytes", len(trk.Response.Body), maxBodySize)
+			}
+		}
+
+		for _, secret := range trackSecrets(trk) {
+			report(lintCheckSecret, "%s", secret)
+		}
+	}
+
+	return problems
+}
+
+// redactedValue matches the values that were redacted.
+var redactedValue = regexp.MustCompile(`(?i)^[\s*xX#.-]*$|redacted|removed|masked|hidden|filtered`)
+
+// trackSecret is a credential found on a track, by the name of the field that holds it or by
+// the detector of its value.
+type trackSecret struct {
+	field    string
+	detector string
+}
+
+func (s trackSecret) String() string {
+	if s.detector == "" {
+		return s.field + " is not redacted"
+	}
+
+	return s.field + " holds a secret (" + s.detector + ")"
+}
+
+// secretFinder collects the credentials found on a track.
+type secretFinder struct {
+	detectors []secrets.Detector
+	secrets   []trackSecret
+}
+
+// named records the field that holds a credential by its name.
+func (f *secretFinder) named(field string) {
+	f.secrets = append(f.secrets, trackSecret{field: field})
+}
+
+// detect records the secrets found in the value of the field by the detectors.
+func (f *secretFinder) detect(field, value string) {
+	for _, detector := range secrets.Detect(f.detectors, value) {
+		secret := trackSecret{field: field, detector: detector}
+		if !slices.Contains(f.secrets, secret) {
+			f.secrets = append(f.secrets, secret)
+		}
+	}
+}
+
+// trackSecrets returns the credentials that the track holds in its URL, its headers and its
+// JSON, form or text bodies: in the fields named after credentials, and in the values that
+// the secret detectors detect, such as JWTs, AWS keys, bearer tokens and private keys.
+func trackSecrets(trk *track.Track) []trackSecret {
+	f := &secretFinder{detectors: secrets.DefaultDetectors()}
+
+	if u := trk.Request.URL; u != nil {
+		f.detect("request URL path", u.Path)
+		valuesSecrets(f, "request URL parameter", u.Query())
+	}
+
+	headerSecrets(f, "request header", trk.Request.Header)
+	bodySecrets(f, "request body", trk.Request.Header, trk.Request.Body)
+
+	if trk.Response != nil {
+		headerSecrets(f, "response header", trk.Response.Header)
+		bodySecrets(f, "response body", trk.Response.Header, trk.Response.Body)
+	}
+
+	return f.secrets
+}
+
+func headerSecrets(f *secretFinder, field string, header http.Header) {
+	for _, key := range sortedKeys(header) {
+		if secrets.IsSensitiveHeader(key) && hasUnredactedValue(header[key]) {
+			f.named(field + " " + key)
+			continue
+		}
+
+		for _, value := range header[key] {
+			f.detect(field+" "+key, value)
+		}
+	}
+}
+
+func valuesSecrets(f *secretFinder, field string, values url.Values) {
+	for _, key := range sortedKeys(values) {
+		if secrets.IsSensitiveName(key) && hasUnredactedValue(values[key]) {
+			f.named(field + " " + key)
+			continue
+		}
+
+		for _, value := range values[key] {
+			f.detect(field+" "+key, value)
+		}
+	}
+}
+
+func bodySecrets(f *secretFinder, field string, header http.Header, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+
+	if bodyKind(header, body) == "json" {
+		var value any
+		if decodeJSON(body, &value) == nil {
+			jsonSecrets(f, field+" $", value)
+			return
+		}
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			valuesSecrets(f, field+" parameter", values)
+			return
+		}
+	}
+
+	f.detect(field, string(body))
+}
+
+// jsonSecrets records the paths of the string values of the JSON value that hold credentials.
+func jsonSecrets(f *secretFinder, path string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			if s, ok := v[key].(string); ok && secrets.IsSensitiveName(key) && !redactedValue.MatchString(s) {
+				f.named(path + "." + key)
+				continue
+			}
+
+			jsonSecrets(f, path+"."+key, v[key])
+		}
+
+	case []any:
+		for i := range v {
+			jsonSecrets(f, path+"["+strconv.Itoa(i)+"]", v[i])
+		}
+
+	case string:
+		f.detect(path, v)
+	}
+}
+
+func hasUnredactedValue(values []string) bool {
+	for _, value := range values {
+		if !redactedValue.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -3,19 +3,117 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 
 	"github.com/seborama/govcr/v17/cassette"
 	"github.com/seborama/govcr/v17/encryption"
+	"github.com/seborama/govcr/v17/fileio"
 )
 
 func main() {
 	decryptCmd := flag.NewFlagSet("decrypt", flag.ExitOnError)
 
 	cassetteFile := decryptCmd.String("cassette-file", "", "location of the cassette file to decrypt")
-	keyFile := decryptCmd.String("key-file", "", "location of the encryption key file")
+	keyFile := decryptCmd.String("key-file", "", "location of the encryption key file, or '-' to read the key from the standard input")
+	keyEnv := decryptCmd.String("key-env", "", "name of the environment variable that holds the encryption key in base64 format")
+	passphraseFile := decryptCmd.String("passphrase-file", "", "location of the encryption passphrase file, or '-' to read the passphrase from the standard input")
+	passphraseEnv := decryptCmd.String("passphrase-env", "", "name of the environment variable that holds the encryption passphrase")
+	outputFile := decryptCmd.String("output", "", "location of the file to write the decrypted cassette to, instead of the standard output")
+
+	rotateCmd := flag.NewFlagSet("rotate", flag.ExitOnError)
+
+	rotateDir := rotateCmd.String("dir", "", "location of the directory of the cassettes to re-encrypt")
+	rotateKeyFile := rotateCmd.String("key-file", "", "location of the new encryption key file, or '-' to read the key from the standard input")
+	rotateKeyEnv := rotateCmd.String("key-env", "", "name of the environment variable that holds the new encryption key in base64 format")
+	rotateKeyID := rotateCmd.String("key-id", "", "ID of the new encryption key, recorded in the cassette header")
+	rotateCipher := rotateCmd.String("cipher", "aesgcm", "cipher of the new encryption key: aesgcm or chacha20poly1305")
+
+	var rotateOldKeys stringsFlag
+
+	rotateCmd.Var(&rotateOldKeys, "old-key", "previous encryption key file in the format '[id=]path' (repeatable)")
+
+	rotateSignerFlags := addSignerFlags(rotateCmd)
+
+	encryptCmd := flag.NewFlagSet("encrypt", flag.ExitOnError)
+
+	encryptCassetteFile := encryptCmd.String("cassette-file", "", "location of the plain cassette file to encrypt, or a glob pattern")
+	encryptKeyFile := encryptCmd.String("key-file", "", "location of the encryption key file, or '-' to read the key from the standard input")
+	encryptKeyEnv := encryptCmd.String("key-env", "", "name of the environment variable that holds the encryption key in base64 format")
+	encryptCipher := encryptCmd.String("cipher", "aesgcm", "cipher: aesgcm or chacha20poly1305")
+	encryptSignerFlags := addSignerFlags(encryptCmd)
+
+	reencryptCmd := flag.NewFlagSet("reencrypt", flag.ExitOnError)
+
+	reencryptCassetteFile := reencryptCmd.String("cassette-file", "", "location of the encrypted cassette file to re-encrypt, or a glob pattern")
+	reencryptFromKey := reencryptCmd.String("from-key", "", "location of the current encryption key file, or '-' to read the key from the standard input")
+	reencryptToKey := reencryptCmd.String("to-key", "", "location of the new encryption key file, or '-' to read the key from the standard input")
+	reencryptCipher := reencryptCmd.String("cipher", "", "new cipher: aesgcm or chacha20poly1305 (default: the current cipher of each cassette)")
+	reencryptSignerFlags := addSignerFlags(reencryptCmd)
+
+	convertCmd := flag.NewFlagSet("convert", flag.ExitOnError)
+
+	convertCassetteFile := convertCmd.String("cassette-file", "", "location of the encrypted cassette file to convert, or a glob pattern")
+	convertKeyFile := convertCmd.String("key-file", "", "location of the encryption key file, or '-' to read the key from the standard input")
+	convertKeyEnv := convertCmd.String("key-env", "", "name of the environment variable that holds the encryption key in base64 format")
+	convertCipher := convertCmd.String("cipher", "", "new cipher: aesgcm or chacha20poly1305")
+	convertSignerFlags := addSignerFlags(convertCmd)
+
+	lsCmd := flag.NewFlagSet("ls", flag.ExitOnError)
+	lsCrypterFlags := addCrypterFlags(lsCmd)
+
+	showCmd := flag.NewFlagSet("show", flag.ExitOnError)
+	showCrypterFlags := addCrypterFlags(showCmd)
+
+	grepCmd := flag.NewFlagSet("grep", flag.ExitOnError)
+	grepCrypterFlags := addCrypterFlags(grepCmd)
+
+	diffCmd := flag.NewFlagSet("diff", flag.ExitOnError)
+	diffCrypterFlags := addCrypterFlags(diffCmd)
+
+	var diffIgnoreHeaders stringsFlag
+
+	diffCmd.Var(&diffIgnoreHeaders, "ignore-header", "name of a header to ignore (repeatable)")
+	diffIgnoreVolatileHeaders := diffCmd.Bool("ignore-volatile-headers", false, "ignore the headers that commonly change from a recording to the next, such as Date")
+
+	mergeCmd := flag.NewFlagSet("merge", flag.ExitOnError)
+	mergeCrypterFlags := addWriterCrypterFlags(mergeCmd)
+	mergeOutput := mergeCmd.String("output", "", "location of the new cassette, encrypted like the first cassette to merge and compressed if it ends with '.gz'")
+
+	splitCmd := flag.NewFlagSet("split", flag.ExitOnError)
+	splitCrypterFlags := addWriterCrypterFlags(splitCmd)
+	splitBy := splitCmd.String("by", "host", "how to group the tracks: host or path-prefix")
+	splitDepth := splitCmd.Int("depth", 1, "number of path segments of the path prefix")
+
+	lintCmd := flag.NewFlagSet("lint", flag.ExitOnError)
+	lintCrypterFlags := addCrypterFlags(lintCmd)
+	lintFormat := lintCmd.String("format", "text", "output format: text or json")
+	lintMaxBodySize := lintCmd.Int("max-body-size", 1<<20, "size in bytes over which a body is reported, or 0 to accept any size")
+
+	var lintDisabledChecks stringsFlag
+
+	lintCmd.Var(&lintDisabledChecks, "disable", "name of a check to disable (repeatable): "+strings.Join(lintChecks, ", "))
+
+	editCmd := flag.NewFlagSet("edit", flag.ExitOnError)
+	editCrypterFlags := addWriterCrypterFlags(editCmd)
+
+	signCmd := flag.NewFlagSet("sign", flag.ExitOnError)
+
+	signCassetteFile := signCmd.String("cassette-file", "", "location of the cassette file to sign (a directory cassette ends with '/')")
+	signKeyFile := signCmd.String("key-file", "", "location of the HMAC-SHA256 key file, or '-' to read the key from the standard input")
+	signKeyEnv := signCmd.String("key-env", "", "name of the environment variable that holds the HMAC-SHA256 key in base64 format")
+	signPrivateKeyFile := signCmd.String("private-key-file", "", "location of the Ed25519 private key file in PEM format")
+
+	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
+
+	verifyCassetteFile := verifyCmd.String("cassette-file", "", "location of the cassette file to verify (a directory cassette ends with '/')")
+	verifyKeyFile := verifyCmd.String("key-file", "", "location of the HMAC-SHA256 key file, or '-' to read the key from the standard input")
+	verifyKeyEnv := verifyCmd.String("key-env", "", "name of the environment variable that holds the HMAC-SHA256 key in base64 format")
+	verifyPublicKeyFile := verifyCmd.String("public-key-file", "", "location of the Ed25519 public key file in PEM format")
 
 	if len(os.Args) < 2 {
 		help()
@@ -29,7 +127,210 @@ func main() {
 			os.Exit(100)
 		}
 
-		if err := decryptCommand(*cassetteFile, *keyFile); err != nil {
+		if err := decryptCommand(*cassetteFile, *keyFile, *keyEnv, *passphraseFile, *passphraseEnv, *outputFile); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "rotate":
+		if err := rotateCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if err := rotateCommand(*rotateDir, *rotateKeyFile, *rotateKeyEnv, *rotateKeyID, *rotateCipher, rotateOldKeys, rotateSignerFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "encrypt":
+		if err := encryptCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if err := encryptCommand(*encryptCassetteFile, *encryptKeyFile, *encryptKeyEnv, *encryptCipher, encryptSignerFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "reencrypt":
+		if err := reencryptCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if err := reencryptCommand(*reencryptCassetteFile, *reencryptFromKey, *reencryptToKey, *reencryptCipher, reencryptSignerFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "convert":
+		if err := convertCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if err := convertCommand(*convertCassetteFile, *convertKeyFile, *convertKeyEnv, *convertCipher, convertSignerFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "ls":
+		if err := lsCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if lsCmd.NArg() != 1 {
+			fmt.Println("usage: govcr ls [flags] <cassette>")
+			os.Exit(100)
+		}
+
+		if err := lsCommand(os.Stdout, lsCmd.Arg(0), lsCrypterFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "show":
+		if err := showCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if showCmd.NArg() != 2 {
+			fmt.Println("usage: govcr show [flags] <cassette> <track number | track UUID>")
+			os.Exit(100)
+		}
+
+		if err := showCommand(os.Stdout, showCmd.Arg(0), showCmd.Arg(1), showCrypterFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "grep":
+		if err := grepCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if grepCmd.NArg() < 2 {
+			fmt.Println("usage: govcr grep [flags] <regular expression> <cassette>...")
+			os.Exit(100)
+		}
+
+		found, err := grepCommand(os.Stdout, grepCmd.Arg(0), grepCmd.Args()[1:], grepCrypterFlags)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if !found {
+			os.Exit(1)
+		}
+
+	case "diff":
+		if err := diffCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if diffCmd.NArg() != 2 {
+			fmt.Println("usage: govcr diff [flags] <cassette a> <cassette b>")
+			os.Exit(100)
+		}
+
+		differ, err := diffCommand(os.Stdout, diffCmd.Arg(0), diffCmd.Arg(1), diffIgnoreHeaders, *diffIgnoreVolatileHeaders, diffCrypterFlags)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if differ {
+			os.Exit(1)
+		}
+
+	case "merge":
+		if err := mergeCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if err := mergeCommand(*mergeOutput, mergeCmd.Args(), mergeCrypterFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "split":
+		if err := splitCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if splitCmd.NArg() != 1 {
+			fmt.Println("usage: govcr split [flags] <cassette>")
+			os.Exit(100)
+		}
+
+		if err := splitCommand(splitCmd.Arg(0), *splitBy, *splitDepth, splitCrypterFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "lint":
+		if err := lintCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		failed, err := lintCommand(os.Stdout, lintCmd.Args(), lintOptions{
+			format:      *lintFormat,
+			maxBodySize: *lintMaxBodySize,
+			disabled:    lintDisabledChecks,
+		}, lintCrypterFlags)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if failed {
+			os.Exit(1)
+		}
+
+	case "edit":
+		if err := editCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if editCmd.NArg() != 1 {
+			fmt.Println("usage: govcr edit [flags] <cassette>")
+			os.Exit(100)
+		}
+
+		if err := editCommand(editCmd.Arg(0), runEditor, editCrypterFlags); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "sign":
+		if err := signCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if err := signCommand(*signCassetteFile, *signKeyFile, *signKeyEnv, *signPrivateKeyFile); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+	case "verify":
+		if err := verifyCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(100)
+		}
+
+		if err := verifyCommand(*verifyCassetteFile, *verifyKeyFile, *verifyKeyEnv, *verifyPublicKeyFile); err != nil {
 			fmt.Println(err)
 			os.Exit(100)
 		}
@@ -42,40 +343,224 @@ func main() {
 
 func help() {
 	fmt.Println(`please specify a sub-command:
-   decrypt: decrypts an encrypted cassette to the standard output.`)
+   decrypt:   decrypts an encrypted cassette to the standard output or to a file.
+   encrypt:   encrypts plain cassettes.
+   reencrypt: re-encrypts encrypted cassettes with a new key.
+   convert:   re-encrypts encrypted cassettes with a new cipher.
+   rotate:    re-encrypts the cassettes under a directory with a new key.
+   ls:        lists the tracks of a cassette.
+   show:      shows a track of a cassette, with its bodies decoded.
+   grep:      searches the URLs, headers and bodies of the tracks of cassettes.
+   diff:      reports the interactions that differ between two cassettes.
+   merge:     merges cassettes into a new cassette, without duplicate interactions.
+   split:     splits a cassette into one cassette per host or path prefix.
+   lint:      reports the problems of cassettes, such as credentials that are not redacted.
+   edit:      edits a cassette with $EDITOR, and saves it encrypted and compressed like it was.
+   sign:      signs a cassette, which approves its current content.
+   verify:    verifies the signature of a cassette.`)
 }
 
-func decryptCommand(cassetteFile, keyFile string) error {
+func decryptCommand(cassetteFile, keyFile, keyEnv, passphraseFile, passphraseEnv, outputFile string) error {
 	if cassetteFile == "" {
 		return errors.New("please specify a cassette file with the 'cassette-file' argument")
 	}
 
-	if keyFile == "" {
-		return errors.New("please specify a key file with the 'key-file' argument")
+	var (
+		data string
+		err  error
+	)
+
+	if passphraseFile != "" || passphraseEnv != "" {
+		if keyFile != "" || keyEnv != "" {
+			return errors.New("please specify either a key or a passphrase, not both")
+		}
+
+		var passphrase encryption.KeyProvider
+
+		passphrase, err = makePassphraseProvider(passphraseFile, passphraseEnv)
+		if err != nil {
+			return err
+		}
+
+		data, err = decryptPassphraseCassette(cassetteFile, passphrase)
+	} else {
+		var keyProvider encryption.KeyProvider
+
+		keyProvider, err = makeKeyProvider(keyFile, keyEnv)
+		if err != nil {
+			return err
+		}
+
+		data, err = decryptCassette(cassetteFile, keyProvider)
 	}
 
-	data, err := decryptCassette(cassetteFile, keyFile)
 	if err != nil {
 		return err
 	}
 
+	if outputFile != "" {
+		return errors.WithStack(os.WriteFile(outputFile, []byte(data), 0o600))
+	}
+
 	fmt.Println(data)
 	return nil
 }
 
-// TODO: offer ability to supply the key via an environment variable in base64 format.
-func decryptCassette(cassetteFile, keyFile string) (string, error) {
-	key, err := os.ReadFile(keyFile)
+func makeKeyProvider(keyFile, keyEnv string) (encryption.KeyProvider, error) {
+	switch {
+	case keyFile != "" && keyEnv != "":
+		return nil, errors.New("please specify only one of the 'key-file' and 'key-env' arguments")
+
+	case keyFile == "-":
+		return stdinKeyProvider(os.Stdin), nil
+
+	case keyFile != "":
+		return encryption.NewFileKeyProvider(keyFile), nil
+
+	case keyEnv != "":
+		return encryption.NewEnvKeyProvider(keyEnv), nil
+	}
+
+	return nil, errors.New("please specify a key file with the 'key-file' argument or a key environment variable with the 'key-env' argument")
+}
+
+func makePassphraseProvider(passphraseFile, passphraseEnv string) (encryption.KeyProvider, error) {
+	switch {
+	case passphraseFile != "" && passphraseEnv != "":
+		return nil, errors.New("please specify only one of the 'passphrase-file' and 'passphrase-env' arguments")
+
+	case passphraseFile == "-":
+		return stdinKeyProvider(os.Stdin), nil
+
+	case passphraseFile != "":
+		return encryption.NewFileKeyProvider(passphraseFile), nil
+
+	case passphraseEnv != "":
+		return encryption.NewEnvPassphraseProvider(passphraseEnv), nil
+	}
+
+	return nil, errors.New("please specify a passphrase file with the 'passphrase-file' argument or a passphrase environment variable with the 'passphrase-env' argument")
+}
+
+// stdinKeyProvider returns a KeyProvider that reads the key, as is, from r.
+// The key is read once, such that it can be supplied more than once.
+func stdinKeyProvider(r io.Reader) encryption.KeyProvider {
+	return encryption.KeyProviderFunc(sync.OnceValues(func() ([]byte, error) {
+		key, err := io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read key from the standard input")
+		}
+
+		if len(key) == 0 {
+			return nil, errors.New("no key was supplied on the standard input")
+		}
+
+		return key, nil
+	}))
+}
+
+// payloadCipher returns the constructor of the Crypter of the cipher kind.
+func payloadCipher(kind string) (func(key []byte) (*encryption.Crypter, error), error) {
+	switch kind {
+	case "aesgcm":
+		return encryption.NewAESGCMWithRandomNonceGenerator, nil
+	case "chacha20poly1305":
+		return encryption.NewChaCha20Poly1305WithRandomNonceGenerator, nil
+	}
+
+	return nil, errors.Errorf("unknown cipher '%s': expected aesgcm or chacha20poly1305", kind)
+}
+
+// decryptCassette decrypts the cassette with the key and the cipher recorded in the
+// cassette header.
+func decryptCassette(cassetteFile string, keyProvider encryption.KeyProvider) (string, error) {
+	return dumpCassette(cassetteFile, keyProvider, nil)
+}
+
+// decryptPassphraseCassette decrypts the cassette with the passphrase and the payload cipher
+// recorded in the cassette header.
+func decryptPassphraseCassette(cassetteFile string, passphrase encryption.KeyProvider) (string, error) {
+	return dumpCassette(cassetteFile, nil, passphrase)
+}
+
+// dumpCassette returns the decrypted contents of the cassette. The panic of a cassette that
+// cannot be loaded, for instance with the wrong key, is returned as an error.
+func dumpCassette(cassetteFile string, keyProvider, passphrase encryption.KeyProvider) (_ string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("%v", r)
+		}
+	}()
+
+	kind, err := cassette.CipherKind(&fileio.OSFile{}, cassetteFile)
+	if err != nil {
+		return "", err
+	}
+
+	if kind == "" {
+		return string(cassette.DumpCassette(cassetteFile)), nil
+	}
+
+	crypter, err := makeCrypter(kind, keyProvider, passphrase)
 	if err != nil {
-		return "", errors.Wrap(err, "key file")
+		return "", err
 	}
 
-	crypter, err := encryption.NewAESGCMWithRandomNonceGenerator(key)
+	// the logical name that the cassette is bound to is recorded in its header.
+	opts, err := cassette.EncryptionOptions(&fileio.OSFile{}, cassetteFile)
 	if err != nil {
-		return "", errors.Wrap(err, "cryptographer")
+		return "", err
 	}
 
-	data := cassette.DumpCassette(cassetteFile, cassette.WithCrypter(crypter))
+	data := cassette.DumpCassette(cassetteFile, append(opts, cassette.WithCrypter(crypter))...)
 
 	return string(data), nil
 }
+
+// makeCrypter creates the crypter of the cipher kind recorded in a cassette header, with the
+// key or the passphrase, as the cipher kind requires.
+func makeCrypter(kind string, keyProvider, passphrase encryption.KeyProvider) (cassette.Crypter, error) {
+	if payloadKind, found := strings.CutPrefix(kind, "passphrase+"); found {
+		if passphrase == nil {
+			return nil, errors.Errorf("cassette is encrypted with a passphrase ('%s'): please specify the 'passphrase-file' or 'passphrase-env' argument", kind)
+		}
+
+		newCrypter, err := payloadCipher(payloadKind)
+		if err != nil {
+			return nil, errors.Wrap(err, "cassette header")
+		}
+
+		// the KDF used for encryption is recorded in the cassette header.
+		crypter, err := encryption.NewPassphraseCrypter(passphrase, encryption.KDF{}, newCrypter)
+		if err != nil {
+			return nil, errors.Wrap(err, "cryptographer")
+		}
+
+		return crypter, nil
+	}
+
+	if strings.Contains(kind, "+") {
+		return nil, errors.Errorf("cassette is encrypted with an envelope ('%s'): envelope encryption is not supported by the govcr CLI, please decrypt the cassette with its envelope crypter", kind)
+	}
+
+	if keyProvider == nil {
+		return nil, errors.Errorf("cassette is not encrypted with a passphrase ('%s'): please specify the 'key-file' or 'key-env' argument", kind)
+	}
+
+	newCrypter, err := payloadCipher(kind)
+	if err != nil {
+		return nil, errors.Wrap(err, "cassette header")
+	}
+
+	key, err := keyProvider.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	crypter, err := newCrypter(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "cryptographer")
+	}
+
+	return crypter, nil
+}
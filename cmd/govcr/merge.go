@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette"
+	"github.com/seborama/govcr/v17/cassette/track"
+)
+
+// mergeCommand merges the tracks of the input cassettes into the output cassette, without the
+// interactions duplicated across the input cassettes. The output cassette is encrypted like the first input cassette and
+// compressed according to its name.
+func mergeCommand(output string, inputs []string, flags *crypterFlags) error {
+	if output == "" {
+		return errors.New("please specify the output cassette with the 'output' argument")
+	}
+
+	if len(inputs) == 0 {
+		return errors.New("please specify the cassettes to merge")
+	}
+
+	opts, err := flags.cassetteOptions(inputs[0])
+	if err != nil {
+		return errors.Wrap(err, inputs[0])
+	}
+
+	// an interaction repeated within a cassette, such as a polling request, is legitimate: it is
+	// kept as many times as it occurs in the input cassette that repeats it the most.
+	var (
+		tracks []track.Track
+		merged = map[string]int{}
+	)
+
+	for _, input := range inputs {
+		k7, err := flags.openCassette(input)
+		if err != nil {
+			return err
+		}
+
+		occurrences := map[string]int{}
+
+		for i := range k7.Tracks {
+			key, err := interactionKey(&k7.Tracks[i])
+			if err != nil {
+				return errors.Wrap(err, input)
+			}
+
+			occurrences[key]++
+
+			if occurrences[key] <= merged[key] {
+				continue
+			}
+
+			merged[key] = occurrences[key]
+			tracks = append(tracks, k7.Tracks[i])
+		}
+	}
+
+	if err = writeCassette(output, tracks, opts); err != nil {
+		return err
+	}
+
+	fmt.Printf("merged: %d tracks into %s\n", len(tracks), output)
+
+	return nil
+}
+
+// interactionKey identifies an interaction: two tracks with the same key are identical but for
+// their UUID.
+func interactionKey(trk *track.Track) (string, error) {
+	t := *trk
+	t.UUID = ""
+
+	data, err := json.Marshal(t)
+
+	return string(data), errors.WithStack(err)
+}
+
+// splitCommand splits the cassette into one cassette per group of tracks, by host or by path
+// prefix of depth path segments. The cassettes are named after the cassette and their group, and
+// they are encrypted and compressed like the cassette.
+func splitCommand(cassetteFile, by string, depth int, flags *crypterFlags) error {
+	var groupOf func(trk *track.Track) string
+
+	switch by {
+	case "host":
+		groupOf = func(trk *track.Track) string {
+			if trk.Request.URL == nil {
+				return ""
+			}
+
+			return trk.Request.URL.Host
+		}
+
+	case "path-prefix":
+		if depth < 1 {
+			return errors.New("the 'depth' argument must be 1 or more")
+		}
+
+		groupOf = func(trk *track.Track) string {
+			if trk.Request.URL == nil {
+				return ""
+			}
+
+			segments := strings.Split(strings.Trim(trk.Request.URL.Path, "/"), "/")
+			if len(segments) > depth {
+				segments = segments[:depth]
+			}
+
+			return strings.Join(segments, "/")
+		}
+
+	default:
+		return errors.Errorf("unknown split '%s': expected host or path-prefix", by)
+	}
+
+	opts, err := flags.cassetteOptions(cassetteFile)
+	if err != nil {
+		return errors.Wrap(err, cassetteFile)
+	}
+
+	k7, err := flags.openCassette(cassetteFile)
+	if err != nil {
+		return err
+	}
+
+	var groups []string
+
+	tracks := map[string][]track.Track{}
+
+	for i := range k7.Tracks {
+		group := groupName(groupOf(&k7.Tracks[i]))
+		if _, ok := tracks[group]; !ok {
+			groups = append(groups, group)
+		}
+
+		tracks[group] = append(tracks[group], k7.Tracks[i])
+	}
+
+	for _, group := range groups {
+		name := splitCassetteName(cassetteFile, group)
+
+		if err = writeCassette(name, tracks[group], opts); err != nil {
+			return err
+		}
+
+		fmt.Printf("split: %d tracks into %s\n", len(tracks[group]), name)
+	}
+
+	return nil
+}
+
+var unsafeNameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// groupName returns the group as a safe file name component.
+func groupName(group string) string {
+	name := strings.Trim(unsafeNameCharacters.ReplaceAllString(group, "_"), "_.")
+	if name == "" {
+		return "root"
+	}
+
+	return name
+}
+
+// splitCassetteName returns the name of the cassette of a group: the group is inserted before
+// the extension of the cassette, such that the cassette format is preserved.
+func splitCassetteName(cassetteFile, group string) string {
+	for _, ext := range []string{".jsonl.gz", ".json.gz", ".jsonl", ".json", ".gz/", "/", ".gz"} {
+		if base, found := strings.CutSuffix(cassetteFile, ext); found {
+			return base + "." + group + ext
+		}
+	}
+
+	return cassetteFile + "." + group
+}
+
+// writeCassette writes a new cassette with the tracks.
+func writeCassette(name string, tracks []track.Track, opts []cassette.Option) error {
+	if _, err := os.Stat(strings.TrimSuffix(name, "/")); err == nil {
+		return errors.Errorf("cassette '%s' already exists", name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		return errors.WithStack(err)
+	}
+
+	k7 := cassette.NewCassette(name, opts...)
+
+	return errors.Wrap(k7.ReplaceTracks(tracks), name)
+}
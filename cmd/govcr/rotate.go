@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette"
+	"github.com/seborama/govcr/v17/encryption"
+	"github.com/seborama/govcr/v17/fileio"
+)
+
+// stringsFlag is a repeatable flag, such as the previous keys of the rotate command.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func rotateCommand(dir, keyFile, keyEnv, keyID, cipherKind string, oldKeys []string, signFlags *signerFlags) error {
+	if dir == "" {
+		return errors.New("please specify a cassette directory with the 'dir' argument")
+	}
+
+	keyProvider, err := makeKeyProvider(keyFile, keyEnv)
+	if err != nil {
+		return err
+	}
+
+	keyring, err := makeKeyring(keyProvider, keyID, cipherKind, oldKeys)
+	if err != nil {
+		return err
+	}
+
+	signer, err := signFlags.signer()
+	if err != nil {
+		return err
+	}
+
+	rotated, err := rotateCassettes(dir, keyring, signer)
+	for _, name := range rotated {
+		fmt.Println("rotated:", name)
+	}
+
+	return err
+}
+
+// makeKeyring creates a Keyring with the new primary key and the previous keys.
+// Since the cipher of previous keys is not known, crypters are created for each cipher
+// that supports the key size.
+func makeKeyring(keyProvider encryption.KeyProvider, keyID, cipherKind string, oldKeys []string) (*encryption.Keyring, error) {
+	if keyID == "" {
+		return nil, errors.New("please specify the ID of the new key with the 'key-id' argument")
+	}
+
+	key, err := keyProvider.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	newCrypter, err := payloadCipher(cipherKind)
+	if err != nil {
+		return nil, err
+	}
+
+	primary, err := newCrypter(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "cryptographer")
+	}
+
+	var previous []encryption.KeyedCrypter
+
+	for _, oldKey := range oldKeys {
+		id, path, found := strings.Cut(oldKey, "=")
+		if !found {
+			id, path = "", oldKey
+		}
+
+		key, err := encryption.NewFileKeyProvider(path).Key()
+		if err != nil {
+			return nil, err
+		}
+
+		crypters := previousCrypters(key)
+		if len(crypters) == 0 {
+			return nil, errors.Errorf("old key '%s': unsupported key size", oldKey)
+		}
+
+		for _, crypter := range crypters {
+			previous = append(previous, encryption.KeyedCrypter{KeyID: id, Crypter: crypter})
+		}
+	}
+
+	return encryption.NewKeyring(encryption.KeyedCrypter{KeyID: keyID, Crypter: primary}, previous...)
+}
+
+func previousCrypters(key []byte) []*encryption.Crypter {
+	var crypters []*encryption.Crypter
+
+	if crypter, err := encryption.NewAESGCMWithRandomNonceGenerator(key); err == nil {
+		crypters = append(crypters, crypter)
+	}
+
+	if crypter, err := encryption.NewChaCha20Poly1305WithRandomNonceGenerator(key); err == nil {
+		crypters = append(crypters, crypter)
+	}
+
+	return crypters
+}
+
+// rotateCassettes re-encrypts with the primary key of the keyring all the encrypted cassettes
+// found under dir, including the track files of directory cassettes. Signed files are signed
+// again with the signer, which is required when there are any.
+// It returns the names of the files that were re-encrypted.
+func rotateCassettes(dir string, keyring *encryption.Keyring, signer cassette.Signer) ([]string, error) {
+	var rotated []string
+
+	store := &fileio.OSFile{}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		ok, err := cassette.ReEncryptFile(store, path, keyring, signer)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			rotated = append(rotated, path)
+		}
+
+		return nil
+	})
+
+	return rotated, errors.WithStack(err)
+}
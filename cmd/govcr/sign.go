@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette"
+	"github.com/seborama/govcr/v17/encryption"
+	"github.com/seborama/govcr/v17/fileio"
+)
+
+// signCommand signs a cassette, which approves its current content, for instance after a
+// hand edit.
+func signCommand(cassetteFile, keyFile, keyEnv, privateKeyFile string) error {
+	if cassetteFile == "" {
+		return errors.New("please specify a cassette file with the 'cassette-file' argument")
+	}
+
+	signer, err := makeSigner(keyFile, keyEnv, "", privateKeyFile)
+	if err != nil {
+		return err
+	}
+
+	if err = cassette.SignCassette(&fileio.OSFile{}, cassetteFile, signer); err != nil {
+		return err
+	}
+
+	fmt.Println("signed:", cassetteFile)
+
+	return nil
+}
+
+// verifyCommand verifies the signature of a cassette.
+func verifyCommand(cassetteFile, keyFile, keyEnv, publicKeyFile string) error {
+	if cassetteFile == "" {
+		return errors.New("please specify a cassette file with the 'cassette-file' argument")
+	}
+
+	signer, err := makeSigner(keyFile, keyEnv, publicKeyFile, "")
+	if err != nil {
+		return err
+	}
+
+	if err = cassette.VerifyCassette(&fileio.OSFile{}, cassetteFile, signer); err != nil {
+		return err
+	}
+
+	fmt.Println("verified:", cassetteFile)
+
+	return nil
+}
+
+// makeSigner creates an HMAC-SHA256 signer with the key of a file or an environment variable,
+// or an Ed25519 signer with a PEM key file.
+func makeSigner(keyFile, keyEnv, publicKeyFile, privateKeyFile string) (cassette.Signer, error) {
+	if publicKeyFile == "" && privateKeyFile == "" {
+		keyProvider, err := makeKeyProvider(keyFile, keyEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := keyProvider.Key()
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := encryption.NewHMACSigner(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "signer")
+		}
+
+		return signer, nil
+	}
+
+	if keyFile != "" || keyEnv != "" {
+		return nil, errors.New("please specify either an HMAC key or an Ed25519 key, not both")
+	}
+
+	var publicKey, privateKey encryption.KeyProvider
+
+	if publicKeyFile != "" {
+		publicKey = encryption.NewFileKeyProvider(publicKeyFile)
+	}
+
+	if privateKeyFile != "" {
+		privateKey = encryption.NewFileKeyProvider(privateKeyFile)
+	}
+
+	signer, err := encryption.NewEd25519SignerFromPEM(publicKey, privateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "signer")
+	}
+
+	return signer, nil
+}
+
+// signerFlags holds the flags that supply the signing key of signed cassettes to the commands
+// that re-write cassettes: signed cassettes are verified and signed again.
+type signerFlags struct {
+	keyFile        string
+	keyEnv         string
+	privateKeyFile string
+}
+
+func addSignerFlags(fs *flag.FlagSet) *signerFlags {
+	f := &signerFlags{}
+
+	fs.StringVar(&f.keyFile, "sign-key-file", "", "location of the HMAC-SHA256 key file of signed cassettes, which are signed again when they are re-written")
+	fs.StringVar(&f.keyEnv, "sign-key-env", "", "name of the environment variable that holds the HMAC-SHA256 key of signed cassettes in base64 format")
+	fs.StringVar(&f.privateKeyFile, "sign-private-key-file", "", "location of the Ed25519 private key file in PEM format of signed cassettes")
+
+	return f
+}
+
+// signer returns the signer of the flags, or nil when no signing key is supplied.
+func (f *signerFlags) signer() (cassette.Signer, error) {
+	if f == nil || (f.keyFile == "" && f.keyEnv == "" && f.privateKeyFile == "") {
+		return nil, nil
+	}
+
+	return makeSigner(f.keyFile, f.keyEnv, "", f.privateKeyFile)
+}
+
+// signerOptions returns the option to verify and sign again the cassette, if it is signed.
+// A signed cassette cannot be re-written without its signing key, since its signature would
+// no longer match.
+func (f *signerFlags) signerOptions(name string) ([]cassette.Option, error) {
+	signed, err := cassette.IsSigned(&fileio.OSFile{}, name)
+	if err != nil || !signed {
+		return nil, err
+	}
+
+	signer, err := f.signer()
+	if err != nil {
+		return nil, err
+	}
+
+	if signer == nil {
+		return nil, errors.New("the cassette is signed: please specify its signing key with the 'sign-key-file', 'sign-key-env' or 'sign-private-key-file' argument")
+	}
+
+	return []cassette.Option{cassette.WithSigner(signer)}, nil
+}
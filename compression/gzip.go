@@ -39,3 +39,24 @@ func Decompress(data []byte) ([]byte, error) {
 
 	return data, nil
 }
+
+// IsCompressed returns true if data starts with the gzip magic number.
+func IsCompressed(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// NewWriter returns a writer that compresses the data written to it and writes it to w.
+// The writer must be closed to flush the compressed data. w is not closed.
+func NewWriter(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+// NewReader returns a reader that decompresses the data read from r.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return gr, nil
+}
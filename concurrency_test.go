@@ -77,6 +77,7 @@ func TestConcurrencySafety(t *testing.T) {
 		TracksLoaded:   0,
 		TracksRecorded: int32(threadMax),
 		TracksPlayed:   0,
+		Mode:           govcr.ModeNormal,
 	}
 	require.Equal(t, expectedStats, *vcr.Stats())
 
@@ -111,6 +112,7 @@ func TestConcurrencySafety(t *testing.T) {
 		TracksLoaded:   int32(threadMax),
 		TracksRecorded: 0,
 		TracksPlayed:   int32(threadMax),
+		Mode:           govcr.ModeNormal,
 	}
 	require.Equal(t, expectedStats, *vcr.Stats())
 }
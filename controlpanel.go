@@ -1,9 +1,11 @@
 package govcr
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/seborama/govcr/v17/cassette/track"
+	"github.com/seborama/govcr/v17/encryption"
 	"github.com/seborama/govcr/v17/stats"
 )
 
@@ -18,13 +20,64 @@ func (controlPanel *ControlPanel) Stats() *stats.Stats {
 	return controlPanel.vcrTransport().stats()
 }
 
+// Flush persists the tracks that have been recorded but not saved to the cassette yet.
+// This is only needed when the cassette was loaded with deferred persistence.
+func (controlPanel *ControlPanel) Flush() error {
+	return controlPanel.vcrTransport().Flush()
+}
+
+// Eject flushes the cassette and stops its background persistence, if any.
+// Tracks recorded after the cassette is ejected are saved immediately.
+// Eject can safely be called more than once. A typical use is:
+//
+//	t.Cleanup(func() { require.NoError(t, vcr.Eject()) })
+func (controlPanel *ControlPanel) Eject() error {
+	return controlPanel.vcrTransport().Eject()
+}
+
+// UnusedTrack describes a track on the cassette that was neither replayed nor recorded
+// during the VCR session.
+type UnusedTrack struct {
+	// TrackNumber is the number of the track on the cassette ('0' is the first track).
+	TrackNumber int32
+
+	// UUID is the UUID of the track.
+	UUID string
+
+	// Request is a summary of the track request, i.e. its method and URL.
+	Request string
+}
+
+func (ut UnusedTrack) String() string {
+	return fmt.Sprintf("#%d (UUID: %s) %s", ut.TrackNumber, ut.UUID, ut.Request)
+}
+
+// UnusedTracks returns the tracks on the cassette that have neither been replayed nor
+// recorded so far during the VCR session.
+// See also WithFailOnUnusedTracks.
+func (controlPanel *ControlPanel) UnusedTracks() []UnusedTrack {
+	return controlPanel.vcrTransport().UnusedTracks()
+}
+
 // SetRequestMatchers sets a new set of RequestMatcher's to the VCR.
 func (controlPanel *ControlPanel) SetRequestMatchers(requestMatcher ...RequestMatcher) {
-	controlPanel.vcrTransport().SetRequestMatchers(requestMatcher...)
+	controlPanel.vcrTransport().SetRequestMatchers(RequestMatchers(requestMatcher).Named()...)
 }
 
 // AddRequestMatchers sets a new set of RequestMatcher's to the VCR.
 func (controlPanel *ControlPanel) AddRequestMatchers(requestMatcher ...RequestMatcher) {
+	controlPanel.vcrTransport().AddRequestMatchers(RequestMatchers(requestMatcher).Named()...)
+}
+
+// SetRequestMatchersNamed sets a new set of NamedRequestMatcher's to the VCR.
+// The names report which RequestMatcher rejected a track when no track matches a request.
+func (controlPanel *ControlPanel) SetRequestMatchersNamed(requestMatcher ...NamedRequestMatcher) {
+	controlPanel.vcrTransport().SetRequestMatchers(requestMatcher...)
+}
+
+// AddRequestMatchersNamed adds a set of NamedRequestMatcher's to the VCR.
+// The names report which RequestMatcher rejected a track when no track matches a request.
+func (controlPanel *ControlPanel) AddRequestMatchersNamed(requestMatcher ...NamedRequestMatcher) {
 	controlPanel.vcrTransport().AddRequestMatchers(requestMatcher...)
 }
 
@@ -48,12 +101,18 @@ func (controlPanel *ControlPanel) SetLiveOnlyMode() {
 	controlPanel.vcrTransport().SetLiveOnlyMode()
 }
 
+// SetRecordMode sets the VCR recording policy for the cassette.
+// See RecordMode for details.
+func (controlPanel *ControlPanel) SetRecordMode(recordMode RecordMode) {
+	controlPanel.vcrTransport().SetRecordMode(recordMode)
+}
+
 // SetCipher sets the cassette Cipher.
 // This can be used to set a cipher when none is present (which already happens automatically
 // when loading a cassette) or change the cipher when one is already present.
 // The cassette is automatically saved with the new selected cipher.
-func (controlPanel *ControlPanel) SetCipher(crypter CrypterProvider, keyFile string) error {
-	return controlPanel.vcrTransport().SetCipher(crypter, keyFile)
+func (controlPanel *ControlPanel) SetCipher(crypter CrypterProvider, keyProvider encryption.KeyProvider) error {
+	return controlPanel.vcrTransport().SetCipher(crypter, keyProvider)
 }
 
 // AddRecordingMutators adds a set of recording Track Mutator's to the VCR.
@@ -2,6 +2,8 @@ package encryption
 
 import (
 	"crypto/cipher"
+
+	cryptoerr "github.com/seborama/govcr/v17/encryption/errors"
 )
 
 // Crypter contains the AEAD cipher to use for encryption and decryption.
@@ -43,12 +45,44 @@ func (c Crypter) Encrypt(plaintext []byte) ([]byte, []byte, error) {
 	return ciphertext, nonce, nil
 }
 
+// EncryptWithAAD performs the encryption of the provided plaintext and authenticates the
+// associated data returned by aad, such as the cassette header. aad is passed the nonce,
+// which is generated from c.nonceGenerator, and no parameters.
+// It returns the ciphertext, the nonce and no parameters.
+func (c Crypter) EncryptWithAAD(plaintext []byte, aad func(nonce, params []byte) ([]byte, error)) ([]byte, []byte, []byte, error) {
+	nonce, err := c.nonceGenerator.Generate()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	additionalData, err := aad(nonce, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ciphertext := c.aead.Seal(nil, nonce, plaintext, additionalData)
+
+	return ciphertext, nonce, nil, nil
+}
+
 // Decrypt performs the decryption of the provided ciphertext with the key
 // associated with this Crypter and the supplied nonce. This must be the same
 // nonce that was used to encrypt the ciphertext.
 // The nonce is not sensitive.
 func (c Crypter) Decrypt(ciphertext, nonce []byte) ([]byte, error) {
-	text, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	return c.DecryptWithAAD(ciphertext, nonce, nil, nil)
+}
+
+// DecryptWithAAD performs the decryption of the provided ciphertext and authenticates the
+// associated data. The parameters are not used by Crypter.
+func (c Crypter) DecryptWithAAD(ciphertext, nonce, _, aad []byte) ([]byte, error) {
+	// the AEAD panics when passed a nonce of the wrong size, which may happen
+	// when a Keyring tries a key of another cipher.
+	if len(nonce) != c.aead.NonceSize() {
+		return nil, cryptoerr.NewErrCrypto("invalid nonce size for cipher '" + c.kind + "'")
+	}
+
+	text, err := c.aead.Open(nil, nonce, ciphertext, aad)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,49 @@
+package encryption_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seborama/govcr/v17/encryption"
+)
+
+// headerAAD returns a constant associated data, as a stand-in for the cassette header.
+func headerAAD(_, _ []byte) ([]byte, error) {
+	return []byte("header"), nil
+}
+
+func TestCrypter_AAD(t *testing.T) {
+	key := []byte("this is a test key______________")
+
+	for _, newCrypter := range []func([]byte) (*encryption.Crypter, error){
+		encryption.NewAESGCMWithRandomNonceGenerator,
+		encryption.NewChaCha20Poly1305WithRandomNonceGenerator,
+	} {
+		crypter, err := newCrypter(key)
+		require.NoError(t, err)
+
+		t.Run(crypter.Kind(), func(t *testing.T) {
+			var gotNonce []byte
+
+			ciphertext, nonce, params, err := crypter.EncryptWithAAD([]byte("My little secret!"), func(nonce, params []byte) ([]byte, error) {
+				gotNonce = nonce
+				return headerAAD(nonce, params)
+			})
+			require.NoError(t, err)
+			assert.Equal(t, nonce, gotNonce)
+			assert.Nil(t, params)
+
+			plaintext, err := crypter.DecryptWithAAD(ciphertext, nonce, nil, []byte("header"))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("My little secret!"), plaintext)
+
+			_, err = crypter.DecryptWithAAD(ciphertext, nonce, nil, []byte("other header"))
+			require.Error(t, err)
+
+			_, err = crypter.Decrypt(ciphertext, nonce)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
+	cryptoerr "github.com/seborama/govcr/v17/encryption/errors"
+)
+
+// dataKeySize is the size of the random data keys of EnvelopeCrypter.
+// It suits both AES-256-GCM and ChaCha20Poly1305.
+const dataKeySize = 32
+
+// KeyWrapper wraps (i.e. encrypts) and unwraps (i.e. decrypts) the data keys of an
+// EnvelopeCrypter with an asymmetric key pair.
+type KeyWrapper interface {
+	// Kind returns the name of the key wrapping algorithm.
+	Kind() string
+
+	// WrapKey wraps the data key with the public key.
+	WrapKey(dataKey []byte) ([]byte, error)
+
+	// UnwrapKey unwraps the data key with the private key.
+	UnwrapKey(wrappedKey []byte) ([]byte, error)
+}
+
+// EnvelopeCrypter encrypts each cassette with a random data key and a symmetric payload
+// cipher such as AES-GCM or ChaCha20Poly1305. The data key is wrapped with the public key of
+// a KeyWrapper and it is stored, wrapped, in the cassette header.
+// This permits to encrypt cassettes with the public key only, while only the holder of the
+// private key can decrypt them.
+type EnvelopeCrypter struct {
+	keyWrapper    KeyWrapper
+	payloadCipher func(key []byte) (*Crypter, error)
+	kind          string
+}
+
+// NewEnvelopeCrypter creates a new EnvelopeCrypter with the supplied KeyWrapper and payload
+// cipher, for instance NewAESGCMWithRandomNonceGenerator.
+func NewEnvelopeCrypter(keyWrapper KeyWrapper, payloadCipher func(key []byte) (*Crypter, error)) (*EnvelopeCrypter, error) {
+	if keyWrapper == nil || payloadCipher == nil {
+		return nil, cryptoerr.NewErrCrypto("a key wrapper and a payload cipher are required")
+	}
+
+	// the data key is random: this probe key only serves to validate the payload cipher.
+	probe, err := payloadCipher(make([]byte, dataKeySize))
+	if err != nil {
+		return nil, errors.Wrap(err, "payload cipher")
+	}
+
+	return &EnvelopeCrypter{
+		keyWrapper:    keyWrapper,
+		payloadCipher: payloadCipher,
+		kind:          keyWrapper.Kind() + "+" + probe.Kind(),
+	}, nil
+}
+
+// Kind returns the kind of the envelope, made of the key wrapping algorithm and the payload
+// cipher. For instance: "rsaoaep+aesgcm".
+func (ec *EnvelopeCrypter) Kind() string {
+	return ec.kind
+}
+
+// Encrypt is not supported by EnvelopeCrypter because the wrapped data key must be stored
+// alongside the ciphertext. Use EncryptWithAAD instead.
+func (ec *EnvelopeCrypter) Encrypt(_ []byte) ([]byte, []byte, error) {
+	return nil, nil, cryptoerr.NewErrCrypto("envelope encryption requires EncryptWithAAD")
+}
+
+// Decrypt is not supported by EnvelopeCrypter because the wrapped data key is needed.
+// Use DecryptWithAAD instead.
+func (ec *EnvelopeCrypter) Decrypt(_, _ []byte) ([]byte, error) {
+	return nil, cryptoerr.NewErrCrypto("envelope decryption requires DecryptWithAAD")
+}
+
+// EncryptWithAAD performs the encryption of the provided plaintext with a new random data
+// key and authenticates the associated data returned by aad, which is passed the nonce and
+// the wrapped data key as parameters.
+// It returns the ciphertext, the nonce and the wrapped data key.
+func (ec *EnvelopeCrypter) EncryptWithAAD(plaintext []byte, aad func(nonce, params []byte) ([]byte, error)) ([]byte, []byte, []byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, nil, errors.WithStack(err)
+	}
+
+	wrappedKey, err := ec.keyWrapper.WrapKey(dataKey)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to wrap data key")
+	}
+
+	crypter, err := ec.payloadCipher(dataKey)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "payload cipher")
+	}
+
+	ciphertext, nonce, _, err := crypter.EncryptWithAAD(plaintext, func(nonce, _ []byte) ([]byte, error) {
+		return aad(nonce, wrappedKey)
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return ciphertext, nonce, wrappedKey, nil
+}
+
+// DecryptWithAAD performs the decryption of the provided ciphertext with the data key
+// obtained by unwrapping wrappedKey and authenticates the associated data.
+func (ec *EnvelopeCrypter) DecryptWithAAD(ciphertext, nonce, wrappedKey, aad []byte) ([]byte, error) {
+	dataKey, err := ec.keyWrapper.UnwrapKey(wrappedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unwrap data key")
+	}
+
+	crypter, err := ec.payloadCipher(dataKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "payload cipher")
+	}
+
+	return crypter.DecryptWithAAD(ciphertext, nonce, nil, aad)
+}
+
+// RSAOAEPKeyWrapper wraps data keys with RSA-OAEP and SHA-256.
+type RSAOAEPKeyWrapper struct {
+	publicKey  *rsa.PublicKey
+	privateKey *rsa.PrivateKey
+}
+
+// rsaOAEPLabel binds the wrapped keys to their use by govcr.
+var rsaOAEPLabel = []byte("govcr data key") //nolint:gochecknoglobals // constant label
+
+// NewRSAOAEPKeyWrapper creates a new RSAOAEPKeyWrapper.
+// Either key may be nil: a public key only permits to encrypt cassettes, a private key
+// permits to encrypt and decrypt cassettes.
+// The key must be 2048 bits or more.
+func NewRSAOAEPKeyWrapper(publicKey *rsa.PublicKey, privateKey *rsa.PrivateKey) (*RSAOAEPKeyWrapper, error) {
+	if publicKey == nil && privateKey != nil {
+		publicKey = &privateKey.PublicKey
+	}
+
+	if publicKey == nil {
+		return nil, cryptoerr.NewErrCrypto("a public key or a private key is required")
+	}
+
+	if publicKey.N.BitLen() < 2048 {
+		return nil, cryptoerr.NewErrCrypto("RSA key size must be 2048 bits or more")
+	}
+
+	return &RSAOAEPKeyWrapper{
+		publicKey:  publicKey,
+		privateKey: privateKey,
+	}, nil
+}
+
+// Kind returns the name of the key wrapping algorithm.
+func (kw *RSAOAEPKeyWrapper) Kind() string {
+	return "rsaoaep"
+}
+
+// WrapKey wraps the data key with the public key.
+func (kw *RSAOAEPKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, kw.publicKey, dataKey, rsaOAEPLabel)
+	return wrappedKey, errors.WithStack(err)
+}
+
+// UnwrapKey unwraps the data key with the private key.
+func (kw *RSAOAEPKeyWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	if kw.privateKey == nil {
+		return nil, cryptoerr.NewErrCrypto("a private key is required to decrypt the cassette")
+	}
+
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, kw.privateKey, wrappedKey, rsaOAEPLabel)
+	return dataKey, errors.WithStack(err)
+}
+
+// X25519KeyWrapper wraps data keys with an ephemeral X25519 key agreement: the wrapping key
+// is derived from the shared secret with HKDF-SHA256 and the data key is sealed with
+// ChaCha20Poly1305. The wrapped key is made of the ephemeral public key and the sealed
+// data key.
+type X25519KeyWrapper struct {
+	publicKey  *ecdh.PublicKey
+	privateKey *ecdh.PrivateKey
+}
+
+// NewX25519KeyWrapper creates a new X25519KeyWrapper.
+// Either key may be nil: a public key only permits to encrypt cassettes, a private key
+// permits to encrypt and decrypt cassettes.
+func NewX25519KeyWrapper(publicKey *ecdh.PublicKey, privateKey *ecdh.PrivateKey) (*X25519KeyWrapper, error) {
+	if publicKey == nil && privateKey != nil {
+		publicKey = privateKey.PublicKey()
+	}
+
+	if publicKey == nil {
+		return nil, cryptoerr.NewErrCrypto("a public key or a private key is required")
+	}
+
+	if publicKey.Curve() != ecdh.X25519() {
+		return nil, cryptoerr.NewErrCrypto("the key is not an X25519 key")
+	}
+
+	return &X25519KeyWrapper{
+		publicKey:  publicKey,
+		privateKey: privateKey,
+	}, nil
+}
+
+// Kind returns the name of the key wrapping algorithm.
+func (kw *X25519KeyWrapper) Kind() string {
+	return "x25519"
+}
+
+// WrapKey wraps the data key with the public key.
+func (kw *X25519KeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	ephemeralKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sharedSecret, err := ephemeralKey.ECDH(kw.publicKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ephemeralPublicKey := ephemeralKey.PublicKey().Bytes()
+
+	aead, err := kw.wrappingCipher(sharedSecret, ephemeralPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// the wrapping key is used only once, hence the zero nonce.
+	nonce := make([]byte, aead.NonceSize())
+
+	return aead.Seal(ephemeralPublicKey, nonce, dataKey, nil), nil
+}
+
+// UnwrapKey unwraps the data key with the private key.
+func (kw *X25519KeyWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	if kw.privateKey == nil {
+		return nil, cryptoerr.NewErrCrypto("a private key is required to decrypt the cassette")
+	}
+
+	keySize := len(kw.publicKey.Bytes())
+	if len(wrappedKey) < keySize {
+		return nil, cryptoerr.NewErrCrypto("wrapped key is too short")
+	}
+
+	ephemeralPublicKey, sealedKey := wrappedKey[:keySize], wrappedKey[keySize:]
+
+	peerKey, err := ecdh.X25519().NewPublicKey(ephemeralPublicKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sharedSecret, err := kw.privateKey.ECDH(peerKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	aead, err := kw.wrappingCipher(sharedSecret, ephemeralPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := aead.Open(nil, make([]byte, aead.NonceSize()), sealedKey, nil)
+	return dataKey, errors.WithStack(err)
+}
+
+// wrappingCipher returns the cipher that seals the data key. Its key is derived from the
+// shared secret and bound to the ephemeral and recipient public keys.
+func (kw *X25519KeyWrapper) wrappingCipher(sharedSecret, ephemeralPublicKey []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte(nil), ephemeralPublicKey...), kw.publicKey.Bytes()...)
+
+	wrappingKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, salt, []byte("govcr x25519 key wrap")), wrappingKey); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	aead, err := chacha20poly1305.New(wrappingKey)
+	return aead, errors.WithStack(err)
+}
+
+// NewKeyWrapperFromPEM creates a KeyWrapper from PEM-encoded keys: RSA keys create an
+// RSAOAEPKeyWrapper and X25519 keys create an X25519KeyWrapper.
+// Either KeyProvider may be nil: a public key only permits to encrypt cassettes, a private
+// key permits to encrypt and decrypt cassettes.
+// Supported PEM blocks are "PUBLIC KEY" (PKIX), "RSA PUBLIC KEY" (PKCS #1), "PRIVATE KEY"
+// (PKCS #8) and "RSA PRIVATE KEY" (PKCS #1).
+func NewKeyWrapperFromPEM(publicKey, privateKey KeyProvider) (KeyWrapper, error) {
+	var pubKey, privKey any
+
+	if publicKey != nil {
+		var err error
+
+		pubKey, err = parsePEMKey(publicKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "public key")
+		}
+	}
+
+	if privateKey != nil {
+		var err error
+
+		privKey, err = parsePEMKey(privateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "private key")
+		}
+	}
+
+	rsaPubKey, isRSAPub := pubKey.(*rsa.PublicKey)
+	rsaPrivKey, isRSAPriv := privKey.(*rsa.PrivateKey)
+
+	if (isRSAPub || pubKey == nil) && (isRSAPriv || privKey == nil) && (isRSAPub || isRSAPriv) {
+		kw, err := NewRSAOAEPKeyWrapper(rsaPubKey, rsaPrivKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return kw, nil
+	}
+
+	ecdhPubKey, isECDHPub := pubKey.(*ecdh.PublicKey)
+	ecdhPrivKey, isECDHPriv := privKey.(*ecdh.PrivateKey)
+
+	if (isECDHPub || pubKey == nil) && (isECDHPriv || privKey == nil) && (isECDHPub || isECDHPriv) {
+		kw, err := NewX25519KeyWrapper(ecdhPubKey, ecdhPrivKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return kw, nil
+	}
+
+	return nil, cryptoerr.NewErrCrypto(fmt.Sprintf("unsupported or mismatched key types: public key '%T', private key '%T'", pubKey, privKey))
+}
+
+func parsePEMKey(keyProvider KeyProvider) (any, error) {
+	data, err := keyProvider.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, cryptoerr.NewErrCrypto("no PEM data found")
+	}
+
+	var key any
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, cryptoerr.NewErrCrypto("unsupported PEM block type '" + block.Type + "'")
+	}
+
+	return key, errors.WithStack(err)
+}
@@ -0,0 +1,154 @@
+package encryption_test
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seborama/govcr/v17/encryption"
+)
+
+func TestEnvelopeCrypter(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	rsaWrapper, err := encryption.NewRSAOAEPKeyWrapper(nil, rsaKey)
+	require.NoError(t, err)
+
+	rsaPublicWrapper, err := encryption.NewRSAOAEPKeyWrapper(&rsaKey.PublicKey, nil)
+	require.NoError(t, err)
+
+	x25519Wrapper, err := encryption.NewX25519KeyWrapper(nil, x25519Key)
+	require.NoError(t, err)
+
+	x25519PublicWrapper, err := encryption.NewX25519KeyWrapper(x25519Key.PublicKey(), nil)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name          string
+		publicWrapper encryption.KeyWrapper
+		wrapper       encryption.KeyWrapper
+		payloadCipher func(key []byte) (*encryption.Crypter, error)
+		wantKind      string
+	}{
+		{
+			name:          "RSA-OAEP with AES-GCM",
+			publicWrapper: rsaPublicWrapper,
+			wrapper:       rsaWrapper,
+			payloadCipher: encryption.NewAESGCMWithRandomNonceGenerator,
+			wantKind:      "rsaoaep+aesgcm",
+		},
+		{
+			name:          "X25519 with ChaCha20Poly1305",
+			publicWrapper: x25519PublicWrapper,
+			wrapper:       x25519Wrapper,
+			payloadCipher: encryption.NewChaCha20Poly1305WithRandomNonceGenerator,
+			wantKind:      "x25519+chacha20poly1305",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			encrypter, err := encryption.NewEnvelopeCrypter(tc.publicWrapper, tc.payloadCipher)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantKind, encrypter.Kind())
+
+			ciphertext, nonce, wrappedKey, err := encrypter.EncryptWithAAD([]byte("hello"), headerAAD)
+			require.NoError(t, err)
+
+			// the public key cannot decrypt
+			_, err = encrypter.DecryptWithAAD(ciphertext, nonce, wrappedKey, []byte("header"))
+			require.Error(t, err)
+
+			decrypter, err := encryption.NewEnvelopeCrypter(tc.wrapper, tc.payloadCipher)
+			require.NoError(t, err)
+
+			plaintext, err := decrypter.DecryptWithAAD(ciphertext, nonce, wrappedKey, []byte("header"))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("hello"), plaintext)
+
+			_, err = decrypter.DecryptWithAAD(ciphertext, nonce, wrappedKey, []byte("other header"))
+			require.Error(t, err)
+
+			// each encryption uses a new data key
+			_, _, wrappedKey2, err := encrypter.EncryptWithAAD([]byte("hello"), headerAAD)
+			require.NoError(t, err)
+			assert.NotEqual(t, wrappedKey, wrappedKey2)
+
+			// a tampered wrapped key is rejected
+			wrappedKey[len(wrappedKey)-1] ^= 1
+			_, err = decrypter.DecryptWithAAD(ciphertext, nonce, wrappedKey, []byte("header"))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNewRSAOAEPKeyWrapper_RejectsSmallKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024) //nolint:gosec // testing weak key rejection
+	require.NoError(t, err)
+
+	_, err = encryption.NewRSAOAEPKeyWrapper(nil, rsaKey)
+	require.Error(t, err)
+
+	_, err = encryption.NewRSAOAEPKeyWrapper(nil, nil)
+	require.Error(t, err)
+}
+
+func TestNewKeyWrapperFromPEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	rsaPrivatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	rsaPublicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+
+	rsaPublicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPublicDER})
+
+	x25519PrivateDER, err := x509.MarshalPKCS8PrivateKey(x25519Key)
+	require.NoError(t, err)
+
+	x25519PrivatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: x25519PrivateDER})
+
+	x25519PublicDER, err := x509.MarshalPKIXPublicKey(x25519Key.PublicKey())
+	require.NoError(t, err)
+
+	x25519PublicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x25519PublicDER})
+
+	kw, err := encryption.NewKeyWrapperFromPEM(encryption.NewStaticKeyProvider(rsaPublicPEM), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "rsaoaep", kw.Kind())
+
+	kw, err = encryption.NewKeyWrapperFromPEM(encryption.NewStaticKeyProvider(rsaPublicPEM), encryption.NewStaticKeyProvider(rsaPrivatePEM))
+	require.NoError(t, err)
+	assert.Equal(t, "rsaoaep", kw.Kind())
+
+	kw, err = encryption.NewKeyWrapperFromPEM(nil, encryption.NewStaticKeyProvider(x25519PrivatePEM))
+	require.NoError(t, err)
+	assert.Equal(t, "x25519", kw.Kind())
+
+	kw, err = encryption.NewKeyWrapperFromPEM(encryption.NewStaticKeyProvider(x25519PublicPEM), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "x25519", kw.Kind())
+
+	_, err = encryption.NewKeyWrapperFromPEM(encryption.NewStaticKeyProvider(rsaPublicPEM), encryption.NewStaticKeyProvider(x25519PrivatePEM))
+	require.Error(t, err)
+
+	_, err = encryption.NewKeyWrapperFromPEM(nil, nil)
+	require.Error(t, err)
+
+	_, err = encryption.NewKeyWrapperFromPEM(encryption.NewStaticKeyProvider([]byte("not PEM")), nil)
+	require.Error(t, err)
+}
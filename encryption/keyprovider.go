@@ -0,0 +1,153 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	cryptoerr "github.com/seborama/govcr/v17/encryption/errors"
+)
+
+// KeyProvider supplies the key of a cassette cryptographer.
+// The key is sensitive, never share it openly.
+type KeyProvider interface {
+	Key() ([]byte, error)
+}
+
+// KeyProviderFunc is an adapter to use an ordinary function as a KeyProvider.
+type KeyProviderFunc func() ([]byte, error)
+
+// Key returns f().
+func (f KeyProviderFunc) Key() ([]byte, error) {
+	return f()
+}
+
+// NewFileKeyProvider creates a KeyProvider that reads the key from a file.
+func NewFileKeyProvider(path string) KeyProvider {
+	return KeyProviderFunc(func() ([]byte, error) {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "key file")
+		}
+
+		return key, nil
+	})
+}
+
+// NewEnvKeyProvider creates a KeyProvider that reads the key, in base64 format, from an
+// environment variable.
+func NewEnvKeyProvider(name string) KeyProvider {
+	return KeyProviderFunc(func() ([]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return nil, cryptoerr.NewErrCrypto("key environment variable '" + name + "' is not set")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.Wrapf(err, "key environment variable '%s' is not valid base64", name)
+		}
+
+		return key, nil
+	})
+}
+
+// NewEnvPassphraseProvider creates a KeyProvider that reads a passphrase, as plain text, from
+// an environment variable. See NewPassphraseCrypter.
+func NewEnvPassphraseProvider(name string) KeyProvider {
+	return KeyProviderFunc(func() ([]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return nil, cryptoerr.NewErrCrypto("passphrase environment variable '" + name + "' is not set")
+		}
+
+		return []byte(value), nil
+	})
+}
+
+// NewStaticKeyProvider creates a KeyProvider that supplies the key held in memory.
+func NewStaticKeyProvider(key []byte) KeyProvider {
+	key = append([]byte(nil), key...)
+
+	return KeyProviderFunc(func() ([]byte, error) {
+		return append([]byte(nil), key...), nil
+	})
+}
+
+// KeyDecrypter decrypts a data key that was encrypted by a key management service (KMS),
+// such as AWS KMS or GCP Cloud KMS. This is a hook for the KMS client of your choice.
+// See LocalKMS for a local stand-in.
+type KeyDecrypter interface {
+	DecryptKey(ctx context.Context, encryptedKey []byte) ([]byte, error)
+}
+
+// NewKMSKeyProvider creates a KeyProvider that supplies the data key obtained by decrypting
+// the encrypted data key with a key management service.
+// The encrypted data key is not sensitive and can be supplied by any KeyProvider, for
+// instance from a file that is committed alongside the cassettes.
+func NewKMSKeyProvider(kms KeyDecrypter, encryptedKey KeyProvider) KeyProvider {
+	return KeyProviderFunc(func() ([]byte, error) {
+		if kms == nil || encryptedKey == nil {
+			return nil, cryptoerr.NewErrCrypto("a KMS and an encrypted key provider are required")
+		}
+
+		eKey, err := encryptedKey.Key()
+		if err != nil {
+			return nil, errors.Wrap(err, "encrypted key")
+		}
+
+		key, err := kms.DecryptKey(context.Background(), eKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "KMS failed to decrypt key")
+		}
+
+		return key, nil
+	})
+}
+
+// LocalKMS is a local stand-in for a key management service. It encrypts and decrypts data
+// keys with a master key held in memory, which is useful for tests.
+type LocalKMS struct {
+	crypter *Crypter
+}
+
+// NewLocalKMS creates a new LocalKMS with the supplied master key.
+// The master key should be 16 bytes (AES-128) or 32 bytes (AES-256) long.
+func NewLocalKMS(masterKey []byte) (*LocalKMS, error) {
+	crypter, err := NewAESGCMWithRandomNonceGenerator(masterKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &LocalKMS{
+		crypter: crypter,
+	}, nil
+}
+
+// EncryptKey encrypts a data key with the master key.
+func (kms *LocalKMS) EncryptKey(_ context.Context, key []byte) ([]byte, error) {
+	ciphertext, nonce, err := kms.crypter.Encrypt(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return append(nonce, ciphertext...), nil
+}
+
+// DecryptKey decrypts a data key that was encrypted with EncryptKey.
+func (kms *LocalKMS) DecryptKey(_ context.Context, encryptedKey []byte) ([]byte, error) {
+	nonceSize := kms.crypter.aead.NonceSize()
+	if len(encryptedKey) < nonceSize {
+		return nil, cryptoerr.NewErrCrypto("encrypted key is too short")
+	}
+
+	key, err := kms.crypter.Decrypt(encryptedKey[nonceSize:], encryptedKey[:nonceSize])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return key, nil
+}
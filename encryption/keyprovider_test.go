@@ -0,0 +1,77 @@
+package encryption_test
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seborama/govcr/v17/encryption"
+)
+
+func TestFileKeyProvider(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "test.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("this is a test key______________"), 0o600))
+
+	key, err := encryption.NewFileKeyProvider(keyFile).Key()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("this is a test key______________"), key)
+
+	_, err = encryption.NewFileKeyProvider(filepath.Join(t.TempDir(), "missing.key")).Key()
+	require.Error(t, err)
+}
+
+func TestEnvKeyProvider(t *testing.T) {
+	t.Setenv("GOVCR_TEST_KEY", base64.StdEncoding.EncodeToString([]byte("this is a test key______________")))
+	t.Setenv("GOVCR_TEST_BAD_KEY", "not base64!")
+
+	key, err := encryption.NewEnvKeyProvider("GOVCR_TEST_KEY").Key()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("this is a test key______________"), key)
+
+	_, err = encryption.NewEnvKeyProvider("GOVCR_TEST_BAD_KEY").Key()
+	require.Error(t, err)
+
+	_, err = encryption.NewEnvKeyProvider("GOVCR_TEST_MISSING_KEY").Key()
+	require.Error(t, err)
+}
+
+func TestStaticKeyProvider(t *testing.T) {
+	input := []byte("this is a test key______________")
+	kp := encryption.NewStaticKeyProvider(input)
+
+	key, err := kp.Key()
+	require.NoError(t, err)
+	assert.Equal(t, input, key)
+
+	// the key provider is not affected by changes to the key supplied or returned
+	input[0] = 'X'
+	key[1] = 'X'
+
+	key, err = kp.Key()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("this is a test key______________"), key)
+}
+
+func TestKMSKeyProvider(t *testing.T) {
+	kms, err := encryption.NewLocalKMS([]byte("this is the master key__________"))
+	require.NoError(t, err)
+
+	dataKey := []byte("this is the data key____________")
+
+	encryptedKey, err := kms.EncryptKey(context.Background(), dataKey)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encryptedKey), string(dataKey))
+
+	key, err := encryption.NewKMSKeyProvider(kms, encryption.NewStaticKeyProvider(encryptedKey)).Key()
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, key)
+
+	encryptedKey[len(encryptedKey)-1] ^= 0xff
+	_, err = encryption.NewKMSKeyProvider(kms, encryption.NewStaticKeyProvider(encryptedKey)).Key()
+	require.Error(t, err)
+}
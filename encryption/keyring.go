@@ -0,0 +1,120 @@
+package encryption
+
+import (
+	"github.com/pkg/errors"
+
+	cryptoerr "github.com/seborama/govcr/v17/encryption/errors"
+)
+
+// KeyedCrypter associates a Crypter with the ID of its key.
+type KeyedCrypter struct {
+	KeyID   string
+	Crypter *Crypter
+}
+
+// Keyring holds a primary Crypter, which is used for encryption, and previous Crypters,
+// which are only used for decryption. This permits to rotate cassette keys progressively:
+// the cassette header records the ID of the key, the matching key is used for decryption
+// and the cassette is re-encrypted with the primary key when it is next saved.
+type Keyring struct {
+	crypters []KeyedCrypter
+}
+
+// NewKeyring creates a new Keyring with the primary Crypter for encryption and the previous
+// Crypters for the decryption of cassettes that have not been re-encrypted yet.
+// A previous Crypter may have an empty key ID, for cassettes that were encrypted without
+// a key ID.
+// The same key ID may be used with Crypters of different cipher kinds.
+func NewKeyring(primary KeyedCrypter, previous ...KeyedCrypter) (*Keyring, error) {
+	if primary.KeyID == "" {
+		return nil, cryptoerr.NewErrCrypto("the primary key ID must not be empty")
+	}
+
+	crypters := append([]KeyedCrypter{primary}, previous...)
+
+	seen := map[[2]string]struct{}{}
+
+	for _, kc := range crypters {
+		if kc.Crypter == nil {
+			return nil, cryptoerr.NewErrCrypto("key '" + kc.KeyID + "' has no crypter")
+		}
+
+		id := [2]string{kc.Crypter.Kind(), kc.KeyID}
+		if _, ok := seen[id]; ok {
+			return nil, cryptoerr.NewErrCrypto("duplicate key '" + kc.KeyID + "' for cipher '" + kc.Crypter.Kind() + "'")
+		}
+
+		seen[id] = struct{}{}
+	}
+
+	return &Keyring{
+		crypters: crypters,
+	}, nil
+}
+
+// Kind returns the cipher kind of the primary Crypter.
+func (kr *Keyring) Kind() string {
+	return kr.crypters[0].Crypter.Kind()
+}
+
+// KeyID returns the key ID of the primary Crypter.
+func (kr *Keyring) KeyID() string {
+	return kr.crypters[0].KeyID
+}
+
+// Encrypt performs the encryption of the provided plaintext with the primary Crypter.
+func (kr *Keyring) Encrypt(plaintext []byte) ([]byte, []byte, error) {
+	return kr.crypters[0].Crypter.Encrypt(plaintext)
+}
+
+// EncryptWithAAD performs the encryption of the provided plaintext with the primary Crypter
+// and authenticates the associated data returned by aad.
+func (kr *Keyring) EncryptWithAAD(plaintext []byte, aad func(nonce, params []byte) ([]byte, error)) ([]byte, []byte, []byte, error) {
+	return kr.crypters[0].Crypter.EncryptWithAAD(plaintext, aad)
+}
+
+// Decrypt performs the decryption of the provided ciphertext with the first Crypter of the
+// keyring that succeeds.
+// Prefer DecryptWithKey when the cipher kind and key ID are known.
+func (kr *Keyring) Decrypt(ciphertext, nonce []byte) ([]byte, error) {
+	return kr.DecryptWithAAD(ciphertext, nonce, nil, nil)
+}
+
+// DecryptWithAAD performs the decryption of the provided ciphertext and authenticates the
+// associated data with the first Crypter of the keyring that succeeds.
+// Prefer DecryptWithKey when the cipher kind and key ID are known.
+func (kr *Keyring) DecryptWithAAD(ciphertext, nonce, params, aad []byte) ([]byte, error) {
+	for _, kc := range kr.crypters {
+		if plaintext, err := kc.Crypter.DecryptWithAAD(ciphertext, nonce, params, aad); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	return nil, cryptoerr.NewErrCrypto("no key in the keyring could decrypt the data")
+}
+
+// DecryptWithKey performs the decryption of the provided ciphertext and authenticates the
+// associated data with the Crypter of the specified cipher kind and key ID.
+// When keyID is empty, each Crypter of the specified cipher kind is tried in turn.
+func (kr *Keyring) DecryptWithKey(kind, keyID string, ciphertext, nonce, aad []byte) ([]byte, error) {
+	var lastErr error
+
+	for _, kc := range kr.crypters {
+		if kc.Crypter.Kind() != kind || (keyID != "" && kc.KeyID != keyID) {
+			continue
+		}
+
+		plaintext, err := kc.Crypter.DecryptWithAAD(ciphertext, nonce, nil, aad)
+		if err == nil {
+			return plaintext, nil
+		}
+
+		lastErr = err
+	}
+
+	if lastErr != nil {
+		return nil, errors.Wrapf(lastErr, "failed to decrypt with key '%s' for cipher '%s'", keyID, kind)
+	}
+
+	return nil, cryptoerr.NewErrCrypto("key '" + keyID + "' for cipher '" + kind + "' is not in the keyring")
+}
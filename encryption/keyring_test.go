@@ -0,0 +1,74 @@
+package encryption_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seborama/govcr/v17/encryption"
+)
+
+func TestKeyring(t *testing.T) {
+	oldCrypter, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("this is an old test key_________"))
+	require.NoError(t, err)
+
+	newCrypter, err := encryption.NewChaCha20Poly1305WithRandomNonceGenerator([]byte("this is a new test key__________"))
+	require.NoError(t, err)
+
+	keyring, err := encryption.NewKeyring(
+		encryption.KeyedCrypter{KeyID: "new", Crypter: newCrypter},
+		encryption.KeyedCrypter{KeyID: "old", Crypter: oldCrypter},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "chacha20poly1305", keyring.Kind())
+	assert.Equal(t, "new", keyring.KeyID())
+
+	// encryption uses the primary key
+	ciphertext, nonce, err := keyring.Encrypt([]byte("hello"))
+	require.NoError(t, err)
+
+	plaintext, err := newCrypter.Decrypt(ciphertext, nonce)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), plaintext)
+
+	// decryption uses the matching key
+	ciphertext, nonce, err = oldCrypter.Encrypt([]byte("world"))
+	require.NoError(t, err)
+
+	plaintext, err = keyring.DecryptWithKey("aesgcm", "old", ciphertext, nonce, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("world"), plaintext)
+
+	plaintext, err = keyring.DecryptWithKey("aesgcm", "", ciphertext, nonce, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("world"), plaintext)
+
+	plaintext, err = keyring.Decrypt(ciphertext, nonce)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("world"), plaintext)
+
+	_, err = keyring.DecryptWithKey("aesgcm", "unknown", ciphertext, nonce, nil)
+	require.Error(t, err)
+
+	_, err = keyring.DecryptWithKey("chacha20poly1305", "new", ciphertext, nonce, nil)
+	require.Error(t, err)
+}
+
+func TestNewKeyring_Errors(t *testing.T) {
+	crypter, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("this is a test key______________"))
+	require.NoError(t, err)
+
+	_, err = encryption.NewKeyring(encryption.KeyedCrypter{Crypter: crypter})
+	require.Error(t, err)
+
+	_, err = encryption.NewKeyring(encryption.KeyedCrypter{KeyID: "k1"})
+	require.Error(t, err)
+
+	_, err = encryption.NewKeyring(
+		encryption.KeyedCrypter{KeyID: "k1", Crypter: crypter},
+		encryption.KeyedCrypter{KeyID: "k1", Crypter: crypter},
+	)
+	require.Error(t, err)
+}
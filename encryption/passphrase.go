@@ -0,0 +1,318 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+
+	cryptoerr "github.com/seborama/govcr/v17/encryption/errors"
+)
+
+// Key derivation functions supported by PassphraseCrypter.
+const (
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+)
+
+const (
+	passphraseKeySize  = 32
+	passphraseSaltSize = 16
+)
+
+// MaxKDFMemory is the maximum memory, in bytes, that the KDF parameters may require.
+// The parameters are read from the cassette header, before it is authenticated: the limit
+// prevents a tampered header from exhausting the memory.
+const MaxKDFMemory = 256 << 20
+
+// KDF holds the name and the cost parameters of a key derivation function.
+// See ScryptKDF and Argon2idKDF.
+type KDF struct {
+	name   string
+	params [3]uint32
+}
+
+// ScryptKDF returns a scrypt KDF with the specified CPU/memory cost (a power of 2),
+// block size and parallelisation parameters.
+func ScryptKDF(n, r, p uint32) KDF {
+	return KDF{name: KDFScrypt, params: [3]uint32{n, r, p}}
+}
+
+// DefaultScryptKDF returns a scrypt KDF with the parameters recommended for interactive use.
+func DefaultScryptKDF() KDF {
+	return ScryptKDF(1<<15, 8, 1)
+}
+
+// Argon2idKDF returns an Argon2id KDF with the specified number of passes, memory size in KiB
+// and degree of parallelism.
+func Argon2idKDF(time, memoryKiB uint32, threads uint8) KDF {
+	return KDF{name: KDFArgon2id, params: [3]uint32{time, memoryKiB, uint32(threads)}}
+}
+
+// DefaultArgon2idKDF returns an Argon2id KDF with the parameters recommended by RFC 9106.
+func DefaultArgon2idKDF() KDF {
+	return Argon2idKDF(1, 64*1024, 4)
+}
+
+// Name returns the name of the KDF.
+func (kdf KDF) Name() string {
+	return kdf.name
+}
+
+// validate protects against parameters that are invalid or that would exhaust resources,
+// for instance when read from a tampered cassette header.
+func (kdf KDF) validate() error {
+	switch kdf.name {
+	case KDFScrypt:
+		n, r, p := kdf.params[0], kdf.params[1], kdf.params[2]
+		if n < 2 || n&(n-1) != 0 || n > 1<<20 || r < 1 || r > 32 || p < 1 || p > 16 {
+			return cryptoerr.NewErrCrypto("invalid scrypt parameters")
+		}
+
+		// scrypt requires 128 * N * r bytes.
+		if 128*uint64(n)*uint64(r) > MaxKDFMemory {
+			return cryptoerr.NewErrCrypto("scrypt parameters require more memory than permitted")
+		}
+
+	case KDFArgon2id:
+		t, m, p := kdf.params[0], kdf.params[1], kdf.params[2]
+		if t < 1 || t > 16 || m < 8*p || p < 1 || p > 255 {
+			return cryptoerr.NewErrCrypto("invalid argon2id parameters")
+		}
+
+		if uint64(m)*1024 > MaxKDFMemory {
+			return cryptoerr.NewErrCrypto("argon2id parameters require more memory than permitted")
+		}
+
+	default:
+		return cryptoerr.NewErrCrypto("unknown KDF '" + kdf.name + "'")
+	}
+
+	return nil
+}
+
+func (kdf KDF) deriveKey(passphrase, salt []byte) ([]byte, error) {
+	if err := kdf.validate(); err != nil {
+		return nil, err
+	}
+
+	switch kdf.name {
+	case KDFScrypt:
+		key, err := scrypt.Key(passphrase, salt, int(kdf.params[0]), int(kdf.params[1]), int(kdf.params[2]), passphraseKeySize)
+		return key, errors.WithStack(err)
+
+	default: // KDFArgon2id
+		return argon2.IDKey(passphrase, salt, kdf.params[0], kdf.params[1], uint8(kdf.params[2]), passphraseKeySize), nil
+	}
+}
+
+// PassphraseCrypter encrypts cassettes with a key derived from a passphrase by a KDF.
+// The salt and the KDF parameters are recorded in the cassette header so the key can be
+// derived again for decryption, even after the KDF parameters are changed.
+type PassphraseCrypter struct {
+	passphrase    []byte
+	kdf           KDF
+	payloadCipher func(key []byte) (*Crypter, error)
+	kind          string
+
+	// mu protects the crypters, which cache the (costly) derived keys by header parameters.
+	mu       sync.Mutex
+	params   []byte
+	crypters map[string]*Crypter
+}
+
+// NewPassphraseCrypter creates a new PassphraseCrypter with the passphrase supplied by the
+// KeyProvider (e.g. NewEnvPassphraseProvider), the KDF and the payload cipher, for instance
+// NewAESGCMWithRandomNonceGenerator.
+// A zero KDF selects DefaultArgon2idKDF.
+// Trailing line breaks are removed from the passphrase, as is common for passphrase files.
+func NewPassphraseCrypter(passphrase KeyProvider, kdf KDF, payloadCipher func(key []byte) (*Crypter, error)) (*PassphraseCrypter, error) {
+	if passphrase == nil || payloadCipher == nil {
+		return nil, cryptoerr.NewErrCrypto("a passphrase provider and a payload cipher are required")
+	}
+
+	pass, err := passphrase.Key()
+	if err != nil {
+		return nil, errors.Wrap(err, "passphrase")
+	}
+
+	pass = bytes.TrimRight(pass, "\r\n")
+	if len(pass) == 0 {
+		return nil, cryptoerr.NewErrCrypto("the passphrase must not be empty")
+	}
+
+	if kdf == (KDF{}) {
+		kdf = DefaultArgon2idKDF()
+	}
+
+	if err = kdf.validate(); err != nil {
+		return nil, err
+	}
+
+	// the key is derived: this probe key only serves to validate the payload cipher.
+	probe, err := payloadCipher(make([]byte, passphraseKeySize))
+	if err != nil {
+		return nil, errors.Wrap(err, "payload cipher")
+	}
+
+	return &PassphraseCrypter{
+		passphrase:    pass,
+		kdf:           kdf,
+		payloadCipher: payloadCipher,
+		kind:          "passphrase+" + probe.Kind(),
+		crypters:      map[string]*Crypter{},
+	}, nil
+}
+
+// Kind returns the kind of the crypter, made of "passphrase" and the payload cipher.
+// For instance: "passphrase+aesgcm".
+func (pc *PassphraseCrypter) Kind() string {
+	return pc.kind
+}
+
+// Encrypt is not supported by PassphraseCrypter because the KDF parameters must be stored
+// alongside the ciphertext. Use EncryptWithAAD instead.
+func (pc *PassphraseCrypter) Encrypt(_ []byte) ([]byte, []byte, error) {
+	return nil, nil, cryptoerr.NewErrCrypto("passphrase encryption requires EncryptWithAAD")
+}
+
+// Decrypt is not supported by PassphraseCrypter because the KDF parameters are needed.
+// Use DecryptWithAAD instead.
+func (pc *PassphraseCrypter) Decrypt(_, _ []byte) ([]byte, error) {
+	return nil, cryptoerr.NewErrCrypto("passphrase decryption requires DecryptWithAAD")
+}
+
+// EncryptWithAAD performs the encryption of the provided plaintext and authenticates the
+// associated data returned by aad, which is passed the nonce and the KDF parameters.
+// It returns the ciphertext, the nonce and the KDF parameters, which include the salt.
+// The salt is random and it is generated once per PassphraseCrypter, so the key is
+// derived only once.
+func (pc *PassphraseCrypter) EncryptWithAAD(plaintext []byte, aad func(nonce, params []byte) ([]byte, error)) ([]byte, []byte, []byte, error) {
+	params, err := pc.currentParams()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	crypter, err := pc.crypter(params)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ciphertext, nonce, _, err := crypter.EncryptWithAAD(plaintext, func(nonce, _ []byte) ([]byte, error) {
+		return aad(nonce, params)
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return ciphertext, nonce, params, nil
+}
+
+// DecryptWithAAD performs the decryption of the provided ciphertext with the key derived
+// with the KDF parameters and authenticates the associated data.
+func (pc *PassphraseCrypter) DecryptWithAAD(ciphertext, nonce, params, aad []byte) ([]byte, error) {
+	crypter, err := pc.crypter(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return crypter.DecryptWithAAD(ciphertext, nonce, nil, aad)
+}
+
+// currentParams returns the KDF parameters used for encryption.
+func (pc *PassphraseCrypter) currentParams() ([]byte, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.params == nil {
+		salt := make([]byte, passphraseSaltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		pc.params = marshalKDFParams(pc.kdf, salt)
+	}
+
+	return pc.params, nil
+}
+
+// crypter returns the payload Crypter with the key derived with the KDF parameters.
+func (pc *PassphraseCrypter) crypter(params []byte) (*Crypter, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if crypter, ok := pc.crypters[string(params)]; ok {
+		return crypter, nil
+	}
+
+	kdf, salt, err := unmarshalKDFParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := kdf.deriveKey(pc.passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	crypter, err := pc.payloadCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "payload cipher")
+	}
+
+	pc.crypters[string(params)] = crypter
+
+	return crypter, nil
+}
+
+// marshalKDFParams encodes the KDF parameters:
+// - KDF name length (1 byte)
+// - KDF name
+// - KDF cost parameters (3 x 4 bytes, big endian)
+// - salt length (1 byte)
+// - salt.
+func marshalKDFParams(kdf KDF, salt []byte) []byte {
+	params := []byte{byte(len(kdf.name))}
+	params = append(params, kdf.name...)
+
+	for _, p := range kdf.params {
+		params = binary.BigEndian.AppendUint32(params, p)
+	}
+
+	params = append(params, byte(len(salt)))
+
+	return append(params, salt...)
+}
+
+func unmarshalKDFParams(params []byte) (KDF, []byte, error) {
+	errInvalid := cryptoerr.NewErrCrypto("invalid KDF parameters")
+
+	if len(params) < 1 || len(params) < 1+int(params[0])+12+1 {
+		return KDF{}, nil, errInvalid
+	}
+
+	var kdf KDF
+
+	nameLen := int(params[0])
+	kdf.name = string(params[1 : 1+nameLen])
+	pos := 1 + nameLen
+
+	for i := range kdf.params {
+		kdf.params[i] = binary.BigEndian.Uint32(params[pos:])
+		pos += 4
+	}
+
+	saltLen := int(params[pos])
+	pos++
+
+	if len(params) != pos+saltLen {
+		return KDF{}, nil, errInvalid
+	}
+
+	return kdf, params[pos:], nil
+}
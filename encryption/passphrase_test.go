@@ -0,0 +1,91 @@
+package encryption_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seborama/govcr/v17/encryption"
+)
+
+func TestPassphraseCrypter(t *testing.T) {
+	passphrase := encryption.NewStaticKeyProvider([]byte("correct horse battery staple\n"))
+
+	tt := []struct {
+		name          string
+		kdf           encryption.KDF
+		payloadCipher func(key []byte) (*encryption.Crypter, error)
+		wantKind      string
+	}{
+		{
+			name:          "scrypt with AES-GCM",
+			kdf:           encryption.ScryptKDF(1<<10, 8, 1),
+			payloadCipher: encryption.NewAESGCMWithRandomNonceGenerator,
+			wantKind:      "passphrase+aesgcm",
+		},
+		{
+			name:          "argon2id with ChaCha20Poly1305",
+			kdf:           encryption.Argon2idKDF(1, 1024, 1),
+			payloadCipher: encryption.NewChaCha20Poly1305WithRandomNonceGenerator,
+			wantKind:      "passphrase+chacha20poly1305",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			crypter, err := encryption.NewPassphraseCrypter(passphrase, tc.kdf, tc.payloadCipher)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantKind, crypter.Kind())
+
+			ciphertext, nonce, params, err := crypter.EncryptWithAAD([]byte("hello"), headerAAD)
+			require.NoError(t, err)
+
+			// the KDF parameters are taken from the params, not from the crypter
+			decrypter, err := encryption.NewPassphraseCrypter(
+				encryption.NewStaticKeyProvider([]byte("correct horse battery staple")),
+				encryption.ScryptKDF(1<<11, 8, 2),
+				tc.payloadCipher,
+			)
+			require.NoError(t, err)
+
+			plaintext, err := decrypter.DecryptWithAAD(ciphertext, nonce, params, []byte("header"))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("hello"), plaintext)
+
+			wrongPassphrase, err := encryption.NewPassphraseCrypter(encryption.NewStaticKeyProvider([]byte("wrong")), tc.kdf, tc.payloadCipher)
+			require.NoError(t, err)
+
+			_, err = wrongPassphrase.DecryptWithAAD(ciphertext, nonce, params, []byte("header"))
+			require.Error(t, err)
+
+			_, err = decrypter.DecryptWithAAD(ciphertext, nonce, params[:len(params)-1], []byte("header"))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNewPassphraseCrypter_Errors(t *testing.T) {
+	_, err := encryption.NewPassphraseCrypter(encryption.NewStaticKeyProvider([]byte("\n")), encryption.KDF{}, encryption.NewAESGCMWithRandomNonceGenerator)
+	require.Error(t, err)
+
+	_, err = encryption.NewPassphraseCrypter(nil, encryption.KDF{}, encryption.NewAESGCMWithRandomNonceGenerator)
+	require.Error(t, err)
+
+	_, err = encryption.NewPassphraseCrypter(encryption.NewStaticKeyProvider([]byte("secret")), encryption.ScryptKDF(1000, 8, 1), encryption.NewAESGCMWithRandomNonceGenerator)
+	require.Error(t, err)
+
+	_, err = encryption.NewPassphraseCrypter(encryption.NewStaticKeyProvider([]byte("secret")), encryption.Argon2idKDF(1, 1<<30, 1), encryption.NewAESGCMWithRandomNonceGenerator)
+	require.Error(t, err)
+
+	// 128 * 2^20 * 8 bytes = 1 GiB
+	_, err = encryption.NewPassphraseCrypter(encryption.NewStaticKeyProvider([]byte("secret")), encryption.ScryptKDF(1<<20, 8, 1), encryption.NewAESGCMWithRandomNonceGenerator)
+	require.Error(t, err)
+
+	// 512 MiB
+	_, err = encryption.NewPassphraseCrypter(encryption.NewStaticKeyProvider([]byte("secret")), encryption.Argon2idKDF(1, 512*1024, 1), encryption.NewAESGCMWithRandomNonceGenerator)
+	require.Error(t, err)
+
+	_, err = encryption.NewPassphraseCrypter(encryption.NewStaticKeyProvider([]byte("secret")), encryption.Argon2idKDF(1, encryption.MaxKDFMemory/1024, 1), encryption.NewAESGCMWithRandomNonceGenerator)
+	require.NoError(t, err)
+}
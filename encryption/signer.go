@@ -0,0 +1,150 @@
+package encryption
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	cryptoerr "github.com/seborama/govcr/v17/encryption/errors"
+)
+
+// hmacMinKeySize is the minimum size of the key of HMACSigner.
+const hmacMinKeySize = 32
+
+// HMACSigner signs cassettes with HMAC-SHA256 and a secret key.
+// The same key signs and verifies cassettes.
+type HMACSigner struct {
+	key []byte
+}
+
+// NewHMACSigner creates a new HMACSigner.
+// The key must be 32 bytes or more.
+func NewHMACSigner(key []byte) (*HMACSigner, error) {
+	if len(key) < hmacMinKeySize {
+		return nil, cryptoerr.NewErrCrypto(fmt.Sprintf("HMAC key size must be %d bytes or more", hmacMinKeySize))
+	}
+
+	return &HMACSigner{
+		key: key,
+	}, nil
+}
+
+// Kind returns the name of the signature algorithm.
+func (s *HMACSigner) Kind() string {
+	return "hmac-sha256"
+}
+
+// Sign returns the signature of the data.
+func (s *HMACSigner) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = mac.Write(data)
+
+	return mac.Sum(nil), nil
+}
+
+// Verify returns an error if the signature does not match the data.
+func (s *HMACSigner) Verify(data, signature []byte) error {
+	wantSignature, err := s.Sign(data)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(signature, wantSignature) {
+		return cryptoerr.NewErrCrypto("signature mismatch")
+	}
+
+	return nil
+}
+
+// Ed25519Signer signs cassettes with an Ed25519 private key and verifies them with the
+// matching public key. This permits to verify cassettes, for instance in CI, without the
+// ability to sign them.
+type Ed25519Signer struct {
+	publicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates a new Ed25519Signer.
+// Either key may be nil: a public key only permits to verify cassettes, a private key
+// permits to sign and verify cassettes.
+func NewEd25519Signer(publicKey ed25519.PublicKey, privateKey ed25519.PrivateKey) (*Ed25519Signer, error) {
+	if privateKey != nil && len(privateKey) != ed25519.PrivateKeySize {
+		return nil, cryptoerr.NewErrCrypto("invalid Ed25519 private key size")
+	}
+
+	if publicKey == nil && privateKey != nil {
+		publicKey, _ = privateKey.Public().(ed25519.PublicKey)
+	}
+
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, cryptoerr.NewErrCrypto("a valid public key or private key is required")
+	}
+
+	return &Ed25519Signer{
+		publicKey:  publicKey,
+		privateKey: privateKey,
+	}, nil
+}
+
+// NewEd25519SignerFromPEM creates an Ed25519Signer from PEM-encoded keys: "PUBLIC KEY"
+// (PKIX) and "PRIVATE KEY" (PKCS #8) blocks.
+// Either KeyProvider may be nil: a public key only permits to verify cassettes, a private
+// key permits to sign and verify cassettes.
+func NewEd25519SignerFromPEM(publicKey, privateKey KeyProvider) (*Ed25519Signer, error) {
+	var (
+		pubKey  ed25519.PublicKey
+		privKey ed25519.PrivateKey
+	)
+
+	if publicKey != nil {
+		key, err := parsePEMKey(publicKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "public key")
+		}
+
+		var ok bool
+		if pubKey, ok = key.(ed25519.PublicKey); !ok {
+			return nil, cryptoerr.NewErrCrypto(fmt.Sprintf("unsupported public key type '%T'", key))
+		}
+	}
+
+	if privateKey != nil {
+		key, err := parsePEMKey(privateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "private key")
+		}
+
+		var ok bool
+		if privKey, ok = key.(ed25519.PrivateKey); !ok {
+			return nil, cryptoerr.NewErrCrypto(fmt.Sprintf("unsupported private key type '%T'", key))
+		}
+	}
+
+	return NewEd25519Signer(pubKey, privKey)
+}
+
+// Kind returns the name of the signature algorithm.
+func (s *Ed25519Signer) Kind() string {
+	return "ed25519"
+}
+
+// Sign returns the signature of the data.
+func (s *Ed25519Signer) Sign(data []byte) ([]byte, error) {
+	if s.privateKey == nil {
+		return nil, cryptoerr.NewErrCrypto("a private key is required to sign the cassette")
+	}
+
+	return ed25519.Sign(s.privateKey, data), nil
+}
+
+// Verify returns an error if the signature does not match the data.
+func (s *Ed25519Signer) Verify(data, signature []byte) error {
+	if !ed25519.Verify(s.publicKey, data, signature) {
+		return cryptoerr.NewErrCrypto("signature mismatch")
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package encryption_test
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seborama/govcr/v17/encryption"
+)
+
+func TestHMACSigner(t *testing.T) {
+	_, err := encryption.NewHMACSigner([]byte("too short"))
+	require.Error(t, err)
+
+	s, err := encryption.NewHMACSigner([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+	assert.Equal(t, "hmac-sha256", s.Kind())
+
+	signature, err := s.Sign([]byte("my cassette"))
+	require.NoError(t, err)
+	require.NoError(t, s.Verify([]byte("my cassette"), signature))
+	require.Error(t, s.Verify([]byte("my edited cassette"), signature))
+
+	other, err := encryption.NewHMACSigner([]byte("98765432109876543210987654321098"))
+	require.NoError(t, err)
+	require.Error(t, other.Verify([]byte("my cassette"), signature))
+}
+
+func TestEd25519Signer(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	s, err := encryption.NewEd25519Signer(nil, privateKey)
+	require.NoError(t, err)
+	assert.Equal(t, "ed25519", s.Kind())
+
+	signature, err := s.Sign([]byte("my cassette"))
+	require.NoError(t, err)
+
+	// the public key only permits to verify cassettes.
+	verifier, err := encryption.NewEd25519Signer(publicKey, nil)
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify([]byte("my cassette"), signature))
+	require.Error(t, verifier.Verify([]byte("my edited cassette"), signature))
+
+	_, err = verifier.Sign([]byte("my cassette"))
+	require.Error(t, err)
+
+	_, err = encryption.NewEd25519Signer(nil, nil)
+	require.Error(t, err)
+}
+
+func TestNewEd25519SignerFromPEM(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	s, err := encryption.NewEd25519SignerFromPEM(nil, encryption.NewStaticKeyProvider(privatePEM))
+	require.NoError(t, err)
+
+	signature, err := s.Sign([]byte("my cassette"))
+	require.NoError(t, err)
+
+	verifier, err := encryption.NewEd25519SignerFromPEM(encryption.NewStaticKeyProvider(publicPEM), nil)
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify([]byte("my cassette"), signature))
+
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	x25519PublicDER, err := x509.MarshalPKIXPublicKey(x25519Key.PublicKey())
+	require.NoError(t, err)
+	x25519PublicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x25519PublicDER})
+
+	_, err = encryption.NewEd25519SignerFromPEM(encryption.NewStaticKeyProvider(x25519PublicPEM), nil)
+	require.ErrorContains(t, err, "unsupported public key type")
+}
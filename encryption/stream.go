@@ -0,0 +1,121 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+
+	cryptoerr "github.com/seborama/govcr/v17/encryption/errors"
+)
+
+// The crypters of this package support the streaming of cassettes, which are then encrypted
+// in chunks (see cassette.WithStreaming). They supply the AEAD cipher that seals the chunks
+// and the parameters to record in the cassette header, if any.
+
+// EncryptionStreamCipher returns the AEAD cipher of the Crypter and no parameters.
+func (c Crypter) EncryptionStreamCipher() (cipher.AEAD, []byte, error) {
+	return c.aead, nil, nil
+}
+
+// DecryptionStreamCipher returns the AEAD cipher of the Crypter.
+// The parameters are not used by Crypter.
+func (c Crypter) DecryptionStreamCipher(kind, _ string, _ []byte) (cipher.AEAD, error) {
+	if kind != c.kind {
+		return nil, cryptoerr.NewErrCrypto("cassette crypter is '" + c.kind + "' but cassette data indicates '" + kind + "'")
+	}
+
+	return c.aead, nil
+}
+
+// EncryptionStreamCipher returns the AEAD cipher of the primary Crypter.
+func (kr *Keyring) EncryptionStreamCipher() (cipher.AEAD, []byte, error) {
+	return kr.crypters[0].Crypter.EncryptionStreamCipher()
+}
+
+// DecryptionStreamCipher returns the AEAD cipher of the Crypter of the specified cipher kind
+// and key ID.
+// When keyID is empty, the first Crypter of the specified cipher kind is returned.
+func (kr *Keyring) DecryptionStreamCipher(kind, keyID string, params []byte) (cipher.AEAD, error) {
+	for _, kc := range kr.crypters {
+		if kc.Crypter.Kind() != kind || (keyID != "" && kc.KeyID != keyID) {
+			continue
+		}
+
+		return kc.Crypter.DecryptionStreamCipher(kind, keyID, params)
+	}
+
+	return nil, cryptoerr.NewErrCrypto("key '" + keyID + "' for cipher '" + kind + "' is not in the keyring")
+}
+
+// EncryptionStreamCipher returns the AEAD cipher of a new random data key and the wrapped
+// data key as parameters.
+func (ec *EnvelopeCrypter) EncryptionStreamCipher() (cipher.AEAD, []byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	wrappedKey, err := ec.keyWrapper.WrapKey(dataKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to wrap data key")
+	}
+
+	crypter, err := ec.payloadCipher(dataKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "payload cipher")
+	}
+
+	return crypter.aead, wrappedKey, nil
+}
+
+// DecryptionStreamCipher returns the AEAD cipher of the data key obtained by unwrapping
+// wrappedKey.
+func (ec *EnvelopeCrypter) DecryptionStreamCipher(kind, _ string, wrappedKey []byte) (cipher.AEAD, error) {
+	if kind != ec.kind {
+		return nil, cryptoerr.NewErrCrypto("cassette crypter is '" + ec.kind + "' but cassette data indicates '" + kind + "'")
+	}
+
+	dataKey, err := ec.keyWrapper.UnwrapKey(wrappedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unwrap data key")
+	}
+
+	crypter, err := ec.payloadCipher(dataKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "payload cipher")
+	}
+
+	return crypter.aead, nil
+}
+
+// EncryptionStreamCipher returns the AEAD cipher of the key derived from the passphrase and
+// the KDF parameters, which include the salt.
+func (pc *PassphraseCrypter) EncryptionStreamCipher() (cipher.AEAD, []byte, error) {
+	params, err := pc.currentParams()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	crypter, err := pc.crypter(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return crypter.aead, params, nil
+}
+
+// DecryptionStreamCipher returns the AEAD cipher of the key derived with the KDF parameters.
+func (pc *PassphraseCrypter) DecryptionStreamCipher(kind, _ string, params []byte) (cipher.AEAD, error) {
+	if kind != pc.kind {
+		return nil, cryptoerr.NewErrCrypto("cassette crypter is '" + pc.kind + "' but cassette data indicates '" + kind + "'")
+	}
+
+	crypter, err := pc.crypter(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return crypter.aead, nil
+}
@@ -0,0 +1,68 @@
+package encryption_test
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seborama/govcr/v17/cassette"
+	"github.com/seborama/govcr/v17/encryption"
+)
+
+func TestStreamCrypters(t *testing.T) {
+	aesCrypter, err := encryption.NewAESGCMWithRandomNonceGenerator([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	keyring, err := encryption.NewKeyring(encryption.KeyedCrypter{KeyID: "key-1", Crypter: aesCrypter})
+	require.NoError(t, err)
+
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	x25519Wrapper, err := encryption.NewX25519KeyWrapper(nil, x25519Key)
+	require.NoError(t, err)
+
+	envelope, err := encryption.NewEnvelopeCrypter(x25519Wrapper, encryption.NewChaCha20Poly1305WithRandomNonceGenerator)
+	require.NoError(t, err)
+
+	passphrase, err := encryption.NewPassphraseCrypter(
+		encryption.NewStaticKeyProvider([]byte("correct horse battery staple")),
+		encryption.ScryptKDF(1<<10, 8, 1),
+		encryption.NewAESGCMWithRandomNonceGenerator,
+	)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name    string
+		crypter cassette.StreamCrypter
+		keyID   string
+	}{
+		{name: "Crypter", crypter: aesCrypter},
+		{name: "Keyring", crypter: keyring, keyID: "key-1"},
+		{name: "EnvelopeCrypter", crypter: envelope},
+		{name: "PassphraseCrypter", crypter: passphrase},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			aead, params, err := tc.crypter.EncryptionStreamCipher()
+			require.NoError(t, err)
+
+			nonce := make([]byte, aead.NonceSize())
+			ciphertext := aead.Seal(nil, nonce, []byte("hello"), []byte("header"))
+
+			decryptionAEAD, err := tc.crypter.DecryptionStreamCipher(tc.crypter.Kind(), tc.keyID, params)
+			require.NoError(t, err)
+
+			plaintext, err := decryptionAEAD.Open(nil, nonce, ciphertext, []byte("header"))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("hello"), plaintext)
+
+			_, err = tc.crypter.DecryptionStreamCipher("unknown", tc.keyID, params)
+			require.Error(t, err)
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package errors
 
+import (
+	"fmt"
+	"strings"
+)
+
 // ErrGoVCR is an error that indicates a govcr failure.
 type ErrGoVCR struct {
 	message string
@@ -15,3 +20,132 @@ func NewErrGoVCR(message string) *ErrGoVCR {
 func (e ErrGoVCR) Error() string {
 	return e.message
 }
+
+// ErrUnusedTracks is an error that indicates that some tracks on the cassette were neither
+// replayed nor recorded during the VCR session.
+type ErrUnusedTracks struct {
+	// CassetteName is the name of the cassette.
+	CassetteName string
+
+	// Tracks holds a summary of each unused track.
+	Tracks []string
+}
+
+func (e ErrUnusedTracks) Error() string {
+	var sb strings.Builder
+
+	_, _ = fmt.Fprintf(&sb, "cassette '%s': %d track(s) were not used:", e.CassetteName, len(e.Tracks))
+
+	for _, trk := range e.Tracks {
+		_, _ = fmt.Fprintf(&sb, "\n  - %s", trk)
+	}
+
+	return sb.String()
+}
+
+// ErrNoTrackMatch is an error that indicates that no track on the cassette matched the
+// HTTP request and that govcr was not permitted to execute it live.
+// It describes the track that came closest to matching the request.
+type ErrNoTrackMatch struct {
+	// Reason explains why govcr did not execute the request live.
+	Reason string
+
+	// ClosestTrackNumber is the number of the closest track on the cassette ('0' is the
+	// first track) or -1 when the cassette has no tracks.
+	ClosestTrackNumber int32
+
+	// ClosestTrackUUID is the UUID of the closest track on the cassette.
+	ClosestTrackUUID string
+
+	// ClosestTrackReplayed is true when the closest track had already been replayed
+	// and hence could not be replayed again.
+	ClosestTrackReplayed bool
+
+	// RejectedBy is the name of the first RequestMatcher that rejected the closest track.
+	RejectedBy string
+
+	// Diffs lists the differences between the request and the closest track's request.
+	Diffs []FieldDiff
+}
+
+// FieldDiff describes the difference of a field between the HTTP request and a track request.
+type FieldDiff struct {
+	Field   string
+	Request string
+	Track   string
+}
+
+func (e ErrNoTrackMatch) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString(e.Reason)
+
+	if e.ClosestTrackNumber < 0 {
+		sb.WriteString(": the cassette has no tracks")
+		return sb.String()
+	}
+
+	_, _ = fmt.Fprintf(&sb, ": closest track #%d (UUID: %s)", e.ClosestTrackNumber, e.ClosestTrackUUID)
+
+	if e.RejectedBy != "" {
+		_, _ = fmt.Fprintf(&sb, " was rejected by request matcher '%s'", e.RejectedBy)
+	} else if e.ClosestTrackReplayed {
+		sb.WriteString(" matches but has already been replayed")
+	}
+
+	for _, d := range e.Diffs {
+		_, _ = fmt.Fprintf(&sb, "\n  %s:\n    request: %s\n    track:   %s", d.Field, d.Request, d.Track)
+	}
+
+	return sb.String()
+}
+
+// ErrTamperedCassette is an error that indicates that a cassette file does not agree with its
+// signature: it was altered or corrupted since it was signed, or it was never signed.
+type ErrTamperedCassette struct {
+	// FileName is the name of the cassette file that failed signature verification.
+	FileName string
+
+	// Reason explains why the signature verification failed.
+	Reason string
+}
+
+func (e ErrTamperedCassette) Error() string {
+	return fmt.Sprintf("cassette file '%s' failed signature verification: %s - if the change is intended, the cassette must be signed again", e.FileName, e.Reason)
+}
+
+// ErrSecretDetected is an error that indicates that a new track holds secrets and that govcr
+// refused to record it.
+type ErrSecretDetected struct {
+	// TrackUUID is the UUID of the track.
+	TrackUUID string
+
+	// Request is a summary of the track request, i.e. its method and URL, with the secrets
+	// redacted.
+	Request string
+
+	// Secrets lists the secrets found on the track.
+	Secrets []SecretFinding
+}
+
+// SecretFinding describes a secret found in a field of a track.
+type SecretFinding struct {
+	// Field is the field of the track that holds the secret, such as
+	// "request header Authorization" or "response body".
+	Field string
+
+	// Detector is the name of the detector that found the secret.
+	Detector string
+}
+
+func (e ErrSecretDetected) Error() string {
+	var sb strings.Builder
+
+	_, _ = fmt.Fprintf(&sb, "govcr refused to record track (UUID: %s) %s because it holds secrets:", e.TrackUUID, e.Request)
+
+	for _, s := range e.Secrets {
+		_, _ = fmt.Fprintf(&sb, "\n  - %s: %s", s.Field, s.Detector)
+	}
+
+	return sb.String()
+}
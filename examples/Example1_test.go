@@ -30,6 +30,7 @@ func TestExample1(t *testing.T) {
 			TracksLoaded:   0,
 			TracksRecorded: 1,
 			TracksPlayed:   0,
+			Mode:           govcr.ModeNormal,
 		},
 		vcr.Stats(),
 	)
@@ -49,6 +50,7 @@ func TestExample1(t *testing.T) {
 			TracksLoaded:   1,
 			TracksRecorded: 0,
 			TracksPlayed:   1,
+			Mode:           govcr.ModeNormal,
 		},
 		vcr.Stats(),
 	)
@@ -21,7 +21,7 @@ func TestExample4(t *testing.T) {
 		govcr.NewCassetteLoader(exampleCassetteName4).
 			WithCipher(
 				encryption.NewChaCha20Poly1305WithRandomNonceGenerator,
-				"test-fixtures/TestExample4.unsafe.key"),
+				encryption.NewFileKeyProvider("test-fixtures/TestExample4.unsafe.key")),
 		govcr.WithRequestMatchers(govcr.NewMethodURLRequestMatchers()...), // use a "relaxed" request matcher
 	)
 
@@ -34,6 +34,7 @@ func TestExample4(t *testing.T) {
 			TracksLoaded:   0,
 			TracksRecorded: 1,
 			TracksPlayed:   0,
+			Mode:           govcr.ModeNormal,
 		},
 		vcr.Stats(),
 	)
@@ -44,7 +45,7 @@ func TestExample4(t *testing.T) {
 		govcr.NewCassetteLoader(exampleCassetteName4).
 			WithCipher(
 				encryption.NewChaCha20Poly1305WithRandomNonceGenerator,
-				"test-fixtures/TestExample4.unsafe.key"),
+				encryption.NewFileKeyProvider("test-fixtures/TestExample4.unsafe.key")),
 	)
 
 	vcr.HTTPClient().Get("http://example.com/foo")
@@ -55,6 +56,7 @@ func TestExample4(t *testing.T) {
 			TracksLoaded:   1,
 			TracksRecorded: 0,
 			TracksPlayed:   1,
+			Mode:           govcr.ModeNormal,
 		},
 		vcr.Stats(),
 	)
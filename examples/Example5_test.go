@@ -38,6 +38,7 @@ func TestExample5(t *testing.T) {
 			TracksLoaded:   0,
 			TracksRecorded: 1,
 			TracksPlayed:   0,
+			Mode:           govcr.ModeNormal,
 		},
 		vcr.Stats(),
 	)
@@ -57,6 +58,7 @@ func TestExample5(t *testing.T) {
 			TracksLoaded:   1,
 			TracksRecorded: 0,
 			TracksPlayed:   1,
+			Mode:           govcr.ModeNormal,
 		},
 		vcr.Stats(),
 	)
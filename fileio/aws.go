@@ -75,11 +75,81 @@ func (f *S3Storage) WriteFile(name string, data []byte, _ os.FileMode) error {
 	return errors.WithStack(err)
 }
 
+// OpenFile opens the named object for reading.
+func (f *S3Storage) OpenFile(name string) (io.ReadCloser, error) {
+	bucket, key, err := f.bucketAndKey(name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result, err := f.s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return result.Body, nil
+}
+
+// WriteFileStream writes the named object with the data that write writes to w.
+// The data is uploaded in parts as it is written, such that it is not held in memory whole.
+// The upload is aborted when write fails, which leaves the object untouched.
+func (f *S3Storage) WriteFileStream(name string, _ os.FileMode, write func(w io.Writer) error) error {
+	bucket, key, err := f.bucketAndKey(name)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	writeErr := make(chan error, 1)
+
+	go func() {
+		err := write(pw)
+		_ = pw.CloseWithError(err)
+		writeErr <- err
+	}()
+
+	const partSize int64 = 10 * 1024 * 1024
+	uploader := manager.NewUploader(f.s3Client, func(u *manager.Uploader) {
+		u.PartSize = partSize
+	})
+	_, err = uploader.Upload(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   pr,
+	})
+
+	// unblock write, should the upload have failed before all the data was read.
+	_ = pr.CloseWithError(errors.New("upload ended"))
+
+	if wErr := <-writeErr; wErr != nil && err == nil {
+		err = wErr
+	}
+
+	return errors.WithStack(err)
+}
+
 func (f *S3Storage) NotExist(name string) (bool, error) {
 	exists, err := f.exists(context.Background(), name)
 	return !exists, err
 }
 
+func (f *S3Storage) Remove(name string) error {
+	bucket, key, err := f.bucketAndKey(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	return errors.WithStack(err)
+}
+
 func (f *S3Storage) bucketAndKey(name string) (string, string, error) {
 	const firstThree = 3 // we only need the beginning of the path to find what we want
 
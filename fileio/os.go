@@ -1,7 +1,9 @@
 package fileio
 
 import (
+	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 )
@@ -29,3 +31,68 @@ func (*OSFile) NotExist(name string) (bool, error) {
 	}
 	return false, errors.WithStack(err)
 }
+
+// AppendFile appends data to the named file, creating it if necessary.
+func (*OSFile) AppendFile(name string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, perm) //nolint:gosec // the cassette name is supplied by the user of govcr
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(f.Close())
+}
+
+// Remove removes the named file. It is not an error if the file does not exist.
+func (*OSFile) Remove(name string) error {
+	err := os.Remove(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return errors.WithStack(err)
+}
+
+// OpenFile opens the named file for reading.
+func (*OSFile) OpenFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name) //nolint:gosec // the cassette name is supplied by the user of govcr
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return f, nil
+}
+
+// WriteFileStream writes the named file with the data that write writes to w.
+// The data is written to a temporary file in the same directory, which replaces the named
+// file once complete, such that the named file is left untouched when write fails.
+func (*OSFile) WriteFileStream(name string, perm os.FileMode, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = write(f)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -3,7 +3,7 @@ package govcr
 import (
 	"fmt"
 	"net/http"
-	"os"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -34,22 +34,46 @@ func NewCassetteLoader(cassetteName string) *CassetteLoader {
 }
 
 // WithCipher creates a cassette cryptographer with the specified cipher function
-// and key file.
+// and key provider (see encryption.NewFileKeyProvider, encryption.NewEnvKeyProvider, etc).
 // Using more than one WithCipher* on the same cassette is ambiguous.
-func (cb *CassetteLoader) WithCipher(crypter CrypterProvider, keyFile string) *CassetteLoader {
-	f := func(key []byte, _ encryption.NonceGenerator) (*encryption.Crypter, error) {
-		// a "CrypterProvider" is a CrypterNonceProvider with a pre-defined / default nonceGenerator
-		return crypter(key)
+func (cb *CassetteLoader) WithCipher(crypter CrypterProvider, keyProvider encryption.KeyProvider) *CassetteLoader {
+	return cb.WithCipherCustomNonce(toCrypterNonceProvider(crypter), keyProvider, nil)
+}
+
+// WithCipherCustomNonce creates a cassette cryptographer with the specified key provider and
+// customer nonce generator.
+// Using more than one WithCipher* on the same cassette is ambiguous.
+func (cb *CassetteLoader) WithCipherCustomNonce(crypterNonce CrypterNonceProvider, keyProvider encryption.KeyProvider, nonceGenerator encryption.NonceGenerator) *CassetteLoader {
+	cr, err := makeCrypter(crypterNonce, keyProvider, nonceGenerator)
+	if err != nil {
+		panic(fmt.Sprintf("%+v", err))
 	}
 
-	return cb.WithCipherCustomNonce(f, keyFile, nil)
+	cb.opts = append(cb.opts, cassette.WithCrypter(cr))
+
+	return cb
 }
 
-// WithCipherCustomNonce creates a cassette cryptographer with the specified key file and
-// customer nonce generator.
+// WithKeyring sets the cassette cryptographer to a keyring of cipher keys.
+// The cassette is decrypted with the key recorded in its header and it is re-encrypted with
+// the primary key of the keyring when it is next saved.
+// Using WithKeyring together with WithCipher* on the same cassette is ambiguous.
+func (cb *CassetteLoader) WithKeyring(keyring *encryption.Keyring) *CassetteLoader {
+	if keyring == nil {
+		panic("keyring is nil")
+	}
+
+	cb.opts = append(cb.opts, cassette.WithCrypter(keyring))
+
+	return cb
+}
+
+// WithPassphraseCipher creates a cassette cryptographer with the specified cipher function
+// and a key derived from the passphrase with the KDF (see encryption.NewPassphraseCrypter).
+// A zero KDF selects encryption.DefaultArgon2idKDF.
 // Using more than one WithCipher* on the same cassette is ambiguous.
-func (cb *CassetteLoader) WithCipherCustomNonce(crypterNonce CrypterNonceProvider, keyFile string, nonceGenerator encryption.NonceGenerator) *CassetteLoader {
-	cr, err := makeCrypter(crypterNonce, keyFile, nonceGenerator)
+func (cb *CassetteLoader) WithPassphraseCipher(crypter CrypterProvider, passphrase encryption.KeyProvider, kdf encryption.KDF) *CassetteLoader {
+	cr, err := encryption.NewPassphraseCrypter(passphrase, kdf, crypter)
 	if err != nil {
 		panic(fmt.Sprintf("%+v", err))
 	}
@@ -59,6 +83,77 @@ func (cb *CassetteLoader) WithCipherCustomNonce(crypterNonce CrypterNonceProvide
 	return cb
 }
 
+// WithEnvelopeCipher sets the cassette cryptographer to an envelope crypter, which encrypts
+// the cassette with a random data key that is wrapped with a public key.
+// When the envelope crypter only holds the public key, the VCR can record a new cassette
+// but it cannot load an existing one.
+// Using WithEnvelopeCipher together with WithCipher* or WithKeyring on the same cassette is
+// ambiguous.
+func (cb *CassetteLoader) WithEnvelopeCipher(crypter *encryption.EnvelopeCrypter) *CassetteLoader {
+	if crypter == nil {
+		panic("envelope crypter is nil")
+	}
+
+	cb.opts = append(cb.opts, cassette.WithCrypter(crypter))
+
+	return cb
+}
+
+// WithFieldEncryption sets a cassette cryptographer that encrypts the selected fields of the
+// tracks rather than the whole cassette, which otherwise remains plain JSON such that its
+// changes can be reviewed. The crypter may be any cassette.Crypter, such as
+// encryption.Crypter or encryption.Keyring.
+// Using WithFieldEncryption together with WithCipher* on the same cassette is ambiguous.
+func (cb *CassetteLoader) WithFieldEncryption(crypter cassette.Crypter, fields cassette.FieldSelection) *CassetteLoader {
+	if crypter == nil {
+		panic("field crypter is nil")
+	}
+
+	cb.opts = append(cb.opts, cassette.WithFieldEncryption(crypter, fields))
+
+	return cb
+}
+
+// WithLogicalName binds the encrypted cassette to a logical name: the name is authenticated
+// with the cassette data, which then only decrypts under this name. This prevents encrypted
+// cassettes from being swapped, for instance by a careless copy.
+func (cb *CassetteLoader) WithLogicalName(name string) *CassetteLoader {
+	cb.opts = append(cb.opts, cassette.WithLogicalName(name))
+	return cb
+}
+
+// WithLogicalNameMigration accepts the encrypted cassettes that are not bound to a logical
+// name, such as the cassettes encrypted with a legacy header, in order to bind them to the
+// logical name (see WithLogicalName) when they are next saved. This is meant to migrate
+// cassettes once, since it permits to swap in an unbound cassette.
+func (cb *CassetteLoader) WithLogicalNameMigration() *CassetteLoader {
+	cb.opts = append(cb.opts, cassette.WithLogicalNameMigration())
+	return cb
+}
+
+// WithSigner signs the cassette files when they are saved and verifies their signature when
+// they are loaded, such that alterations of the cassette, such as hand edits, are detected.
+// Examples of signers are encryption.HMACSigner and encryption.Ed25519Signer.
+// The govcr CLI "sign" command approves intended alterations.
+func (cb *CassetteLoader) WithSigner(signer cassette.Signer) *CassetteLoader {
+	if signer == nil {
+		panic("signer is nil")
+	}
+
+	cb.opts = append(cb.opts, cassette.WithSigner(signer))
+
+	return cb
+}
+
+// WithStreaming saves the cassette as a stream such that large cassettes are saved with
+// bounded memory. An encrypted cassette is encrypted in chunks of chunkSize bytes, or of
+// cassette.DefaultStreamChunkSize bytes when chunkSize is zero.
+// A signed cassette cannot be streamed. See cassette.WithStreaming.
+func (cb *CassetteLoader) WithStreaming(chunkSize int) *CassetteLoader {
+	cb.opts = append(cb.opts, cassette.WithStreaming(chunkSize))
+	return cb
+}
+
 // WithStore creates a cassette in a specific storeage backedn.
 // Using more than one WithStore on the same cassette is ambiguous.
 func (cb *CassetteLoader) WithStore(store cassette.FileIO) *CassetteLoader {
@@ -66,6 +161,15 @@ func (cb *CassetteLoader) WithStore(store cassette.FileIO) *CassetteLoader {
 	return cb
 }
 
+// WithDeferredPersistence keeps newly recorded tracks in memory rather than saving the whole
+// cassette on every recording, which is costly for cassettes with many tracks.
+// The cassette is persisted by ControlPanel.Flush and ControlPanel.Eject and, if flushInterval
+// is greater than zero, periodically in the background.
+func (cb *CassetteLoader) WithDeferredPersistence(flushInterval time.Duration) *CassetteLoader {
+	cb.opts = append(cb.opts, cassette.WithDeferredPersistence(flushInterval))
+	return cb
+}
+
 func (cb *CassetteLoader) load() *cassette.Cassette {
 	if cb == nil {
 		panic("please select a cassette for the VCR")
@@ -74,13 +178,28 @@ func (cb *CassetteLoader) load() *cassette.Cassette {
 	return cassette.LoadCassette(cb.cassetteName, cb.opts...)
 }
 
-// TODO: offer ability to supply the key via an environment variable in base64 format.
-func makeCrypter(crypterNonce CrypterNonceProvider, keyFile string, nonceGenerator encryption.NonceGenerator) (*encryption.Crypter, error) {
+// toCrypterNonceProvider converts a CrypterProvider to a CrypterNonceProvider.
+func toCrypterNonceProvider(crypter CrypterProvider) CrypterNonceProvider {
+	if crypter == nil {
+		return nil
+	}
+
+	return func(key []byte, _ encryption.NonceGenerator) (*encryption.Crypter, error) {
+		// a "CrypterProvider" is a CrypterNonceProvider with a pre-defined / default nonceGenerator
+		return crypter(key)
+	}
+}
+
+func makeCrypter(crypterNonce CrypterNonceProvider, keyProvider encryption.KeyProvider, nonceGenerator encryption.NonceGenerator) (*encryption.Crypter, error) {
 	if crypterNonce == nil {
 		return nil, errors.New("a cipher must be supplied for encryption, `nil` is not permitted")
 	}
 
-	key, err := os.ReadFile(keyFile)
+	if keyProvider == nil {
+		return nil, errors.New("a key provider must be supplied for encryption, `nil` is not permitted")
+	}
+
+	key, err := keyProvider.Key()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -94,6 +213,7 @@ func makeCrypter(crypterNonce CrypterNonceProvider, keyFile string, nonceGenerat
 }
 
 // NewVCR creates a new VCR.
+// The VCR mode can be selected with the environment variables EnvMode and EnvRecord.
 func NewVCR(cassetteLoader *CassetteLoader, settings ...Setting) *ControlPanel {
 	var vcrSettings VCRSettings
 
@@ -103,6 +223,8 @@ func NewVCR(cassetteLoader *CassetteLoader, settings ...Setting) *ControlPanel {
 		option(&vcrSettings)
 	}
 
+	vcrSettings.applyModeEnv()
+
 	// use a default client if none provided
 	if vcrSettings.client == nil {
 		vcrSettings.client = http.DefaultClient
@@ -115,7 +237,7 @@ func NewVCR(cassetteLoader *CassetteLoader, settings ...Setting) *ControlPanel {
 
 	// use a default RequestMatcher if none provided
 	if vcrSettings.requestMatchers == nil {
-		vcrSettings.requestMatchers = NewStrictRequestMatchers()
+		vcrSettings.requestMatchers = NewStrictRequestMatchers().Named()
 	}
 
 	// create VCR's HTTP client
@@ -127,9 +249,13 @@ func NewVCR(cassetteLoader *CassetteLoader, settings ...Setting) *ControlPanel {
 				trackReplayingMutators: vcrSettings.trackReplayingMutators,
 				httpMode:               vcrSettings.httpMode,
 				readOnly:               vcrSettings.readOnly,
+				recordMode:             vcrSettings.recordMode,
+				secretScanner:          vcrSettings.secretScanner,
 			},
-			cassette:  vcrSettings.cassette,
-			transport: vcrSettings.client.Transport,
+			cassette:           vcrSettings.cassette,
+			transport:          vcrSettings.client.Transport,
+			failOnUnusedTracks: vcrSettings.failOnUnusedTracks,
+			pruneUnusedTracks:  vcrSettings.pruneUnusedTracks,
 		},
 
 		// copy the attributes of the original http.Client
@@ -115,6 +115,7 @@ func (ts *GoVCRWBTestSuite) TestRoundTrip_RequestMatcherDoesNotMutateState() {
 		TracksLoaded:   0,
 		TracksRecorded: 1,
 		TracksPlayed:   0,
+		Mode:           ModeLive,
 	}
 	ts.Require().Equal(expectedStats, vcr.Stats())
 
@@ -146,6 +147,7 @@ func (ts *GoVCRWBTestSuite) TestRoundTrip_RequestMatcherDoesNotMutateState() {
 		TracksLoaded:   1,
 		TracksRecorded: 1,
 		TracksPlayed:   0,
+		Mode:           ModeNormal,
 	}
 	ts.Require().Equal(expectedStats, vcr.Stats())
 
@@ -179,6 +181,7 @@ func (ts *GoVCRWBTestSuite) TestRoundTrip_RequestMatcherDoesNotMutateState() {
 		TracksLoaded:   2,
 		TracksRecorded: 0,
 		TracksPlayed:   1,
+		Mode:           ModeOffline,
 	}
 	ts.Require().Equal(expectedStats, vcr.Stats())
 
@@ -210,6 +213,7 @@ func (ts *GoVCRWBTestSuite) TestRoundTrip_WithRecordingAndReplayingMutations() {
 		TracksLoaded:   0,
 		TracksRecorded: 2,
 		TracksPlayed:   0,
+		Mode:           ModeNormal,
 	}
 	ts.Require().Equal(expectedStats, vcr.Stats())
 
@@ -237,6 +241,7 @@ func (ts *GoVCRWBTestSuite) TestRoundTrip_WithRecordingAndReplayingMutations() {
 		TracksLoaded:   2,
 		TracksRecorded: 0,
 		TracksPlayed:   2,
+		Mode:           ModeNormal,
 	}
 	ts.Equal(expectedStats, vcr.Stats())
 }
@@ -254,6 +259,7 @@ func (ts *GoVCRWBTestSuite) TestRoundTrip_SavesAndReplaysMutatedTracksToCassette
 		TracksLoaded:   0,
 		TracksRecorded: 2,
 		TracksPlayed:   0,
+		Mode:           ModeNormal,
 	}
 	ts.Require().Equal(expectedStats, vcr.Stats())
 
@@ -274,6 +280,7 @@ func (ts *GoVCRWBTestSuite) TestRoundTrip_SavesAndReplaysMutatedTracksToCassette
 		TracksLoaded:   2,
 		TracksRecorded: 0,
 		TracksPlayed:   2,
+		Mode:           ModeNormal,
 	}
 	ts.Equal(expectedStats, vcr.Stats())
 }
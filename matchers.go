@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"net/http"
 	"net/url"
+	"reflect"
+	"runtime"
 
 	"github.com/seborama/govcr/v17/cassette/track"
 )
@@ -33,6 +35,107 @@ func (rm RequestMatchers) Match(httpRequest, trackRequest *track.Request) bool {
 	return len(rm) != 0
 }
 
+// Evaluate runs all RequestMatcher's in RequestMatchers, even after one has rejected the
+// trackRequest. See NamedRequestMatchers.Evaluate.
+func (rm RequestMatchers) Evaluate(httpRequest, trackRequest *track.Request) (int, string) {
+	return rm.Named().Evaluate(httpRequest, trackRequest)
+}
+
+// Named returns the RequestMatcher's with their default name: the default matchers are named
+// after what they compare (e.g. "header" for DefaultHeaderMatcher), other matchers are named
+// after their function.
+func (rm RequestMatchers) Named() NamedRequestMatchers {
+	named := make(NamedRequestMatchers, 0, len(rm))
+
+	for _, matcher := range rm {
+		named = append(named, NewNamedRequestMatcher(requestMatcherName(matcher), matcher))
+	}
+
+	return named
+}
+
+// defaultRequestMatcherNames are the names of the default RequestMatcher's, by function.
+var defaultRequestMatcherNames = map[uintptr]string{
+	reflect.ValueOf(DefaultHeaderMatcher).Pointer():  "header",
+	reflect.ValueOf(DefaultMethodMatcher).Pointer():  "method",
+	reflect.ValueOf(DefaultURLMatcher).Pointer():     "url",
+	reflect.ValueOf(DefaultBodyMatcher).Pointer():    "body",
+	reflect.ValueOf(DefaultTrailerMatcher).Pointer(): "trailer",
+}
+
+// requestMatcherName returns the default name of the RequestMatcher.
+func requestMatcherName(matcher RequestMatcher) string {
+	pc := reflect.ValueOf(matcher).Pointer()
+
+	if name, ok := defaultRequestMatcherNames[pc]; ok {
+		return name
+	}
+
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		return fn.Name()
+	}
+
+	return "unnamed"
+}
+
+// NamedRequestMatcher is a RequestMatcher with a name.
+// The name is used to report which RequestMatcher rejected a track when no track on the
+// cassette matches a request.
+type NamedRequestMatcher struct {
+	Name    string
+	Matcher RequestMatcher
+}
+
+// NewNamedRequestMatcher creates a new NamedRequestMatcher.
+func NewNamedRequestMatcher(name string, matcher RequestMatcher) NamedRequestMatcher {
+	return NamedRequestMatcher{
+		Name:    name,
+		Matcher: matcher,
+	}
+}
+
+// NamedRequestMatchers is a collection of NamedRequestMatcher's.
+type NamedRequestMatchers []NamedRequestMatcher
+
+// Add a set of NamedRequestMatcher's to this NamedRequestMatchers collection.
+func (rm NamedRequestMatchers) Add(reqMatchers ...NamedRequestMatcher) NamedRequestMatchers {
+	return append(rm, reqMatchers...)
+}
+
+// Match returns true if all RequestMatcher's in NamedRequestMatchers return true, thereby
+// indicating that the trackRequest matches the httpRequest.
+// When no matchers are supplied, Match returns false.
+func (rm NamedRequestMatchers) Match(httpRequest, trackRequest *track.Request) bool {
+	for _, matcher := range rm {
+		if !matcher.Matcher(httpRequest, trackRequest) {
+			return false
+		}
+	}
+
+	return len(rm) != 0
+}
+
+// Evaluate runs all RequestMatcher's in NamedRequestMatchers, even after one has rejected the
+// trackRequest. It returns the number of RequestMatcher's that accepted the trackRequest and the
+// name of the first RequestMatcher that rejected it, if any.
+func (rm NamedRequestMatchers) Evaluate(httpRequest, trackRequest *track.Request) (int, string) {
+	accepted := 0
+	rejectedBy := ""
+
+	for _, matcher := range rm {
+		if matcher.Matcher(httpRequest, trackRequest) {
+			accepted++
+			continue
+		}
+
+		if rejectedBy == "" {
+			rejectedBy = matcher.Name
+		}
+	}
+
+	return accepted, rejectedBy
+}
+
 // NewStrictRequestMatchers creates a new default sets of RequestMatcher's.
 func NewStrictRequestMatchers() RequestMatchers {
 	return RequestMatchers{
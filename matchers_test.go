@@ -343,3 +343,38 @@ func Test_DefaultTrailerMatcher(t *testing.T) {
 		})
 	}
 }
+
+func Test_RequestMatchers_Evaluate(t *testing.T) {
+	httpReq := track.Request{Method: http.MethodGet, URL: &url.URL{Path: "/a1"}}
+	trackReq := track.Request{Method: http.MethodPost, URL: &url.URL{Path: "/a1"}}
+
+	accepted, rejectedBy := govcr.NewStrictRequestMatchers().Evaluate(&httpReq, &trackReq)
+	assert.Equal(t, 4, accepted)
+	assert.Equal(t, "method", rejectedBy)
+
+	accepted, rejectedBy = govcr.NewMethodURLRequestMatchers().Evaluate(&httpReq, &httpReq)
+	assert.Equal(t, 2, accepted)
+	assert.Empty(t, rejectedBy)
+}
+
+func Test_RequestMatchers_Named(t *testing.T) {
+	httpReq := track.Request{Method: http.MethodGet, URL: &url.URL{Path: "/a1"}}
+	trackReq := track.Request{Method: http.MethodGet, URL: &url.URL{Path: "/a2"}}
+
+	named := govcr.RequestMatchers{govcr.DefaultMethodMatcher, govcr.DefaultURLMatcher}.Named()
+	assert.Equal(t, "method", named[0].Name)
+	assert.Equal(t, "url", named[1].Name)
+
+	named = named.Add(govcr.NewNamedRequestMatcher("path prefix", func(httpRequest, trackRequest *track.Request) bool {
+		return httpRequest.URL.Path[:2] == trackRequest.URL.Path[:2]
+	}))
+
+	accepted, rejectedBy := named.Evaluate(&httpReq, &trackReq)
+	assert.Equal(t, 2, accepted)
+	assert.Equal(t, "url", rejectedBy)
+	assert.False(t, named.Match(&httpReq, &trackReq))
+
+	accepted, rejectedBy = govcr.NamedRequestMatchers{named[0], named[2]}.Evaluate(&httpReq, &trackReq)
+	assert.Equal(t, 2, accepted)
+	assert.Empty(t, rejectedBy)
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/seborama/govcr/v17/cassette"
 	"github.com/seborama/govcr/v17/cassette/track"
+	govcrerr "github.com/seborama/govcr/v17/errors"
 )
 
 // HTTPMode defines govcr's mode for HTTP requests.
@@ -22,10 +23,34 @@ const (
 	HTTPModeOffline
 )
 
+// RecordMode defines govcr's recording policy for the cassette, in the spirit of
+// Ruby's VCR record modes.
+// See specific modes for further details.
+type RecordMode int
+
+const (
+	// RecordModeNewEpisodes replays from cassette if a match exists or executes and records
+	// a live request. This is the default.
+	RecordModeNewEpisodes RecordMode = iota
+
+	// RecordModeOnce records new tracks only when the cassette did not exist at the time it
+	// was loaded. Otherwise, it behaves as RecordModeNone.
+	RecordModeOnce
+
+	// RecordModeAll never replays from cassette: all requests are executed live and recorded.
+	// A track that matches the request is replaced in place by the new recording, otherwise
+	// the new track is appended to the cassette.
+	RecordModeAll
+
+	// RecordModeNone replays from cassette if a match exists but never records. If no track
+	// matches, a transport error is returned.
+	RecordModeNone
+)
+
 // PrintedCircuitBoard is a structure that holds some facilities that are passed to
 // the VCR machine to influence its internal behaviour.
 type PrintedCircuitBoard struct {
-	requestMatchers RequestMatchers
+	requestMatchers NamedRequestMatchers
 
 	// These mutators are applied before saving a track to a cassette.
 	trackRecordingMutators track.Mutators
@@ -40,26 +65,101 @@ type PrintedCircuitBoard struct {
 
 	// Replay tracks from cassette, if present, or make live calls but do not records new tracks.
 	readOnly bool
+
+	// recordMode govcr's recording policy for the cassette - see RecordMode for details.
+	recordMode RecordMode
+
+	// secretScanner scans the new tracks for secrets, after the recording mutators.
+	secretScanner *secretScanner
+}
+
+// mode returns the name of the effective VCR mode.
+func (pcb *PrintedCircuitBoard) mode() string {
+	switch {
+	case pcb.httpMode == HTTPModeOffline:
+		return ModeOffline
+	case pcb.httpMode == HTTPModeLiveOnly:
+		return ModeLive
+	case pcb.readOnly:
+		return ModeReplay
+	}
+
+	switch pcb.recordMode {
+	case RecordModeAll:
+		return ModeRecord
+	case RecordModeOnce:
+		return ModeRecordOnce
+	case RecordModeNone:
+		return ModeRecordNone
+	case RecordModeNewEpisodes:
+	}
+
+	return ModeNormal
 }
 
 func (pcb *PrintedCircuitBoard) SeekTrack(k7 *cassette.Cassette, httpRequest *http.Request) (*track.Track, error) {
-	if pcb.httpMode == HTTPModeLiveOnly {
+	return pcb.seekTrack(k7, pcb.requestToMatch(httpRequest), httpRequest)
+}
+
+// seekTrack replays the first track on the cassette that has not been replayed yet and that
+// matches the request, which is the request to match of the HTTP request (see requestToMatch).
+func (pcb *PrintedCircuitBoard) seekTrack(k7 *cassette.Cassette, request *track.Request, httpRequest *http.Request) (*track.Track, error) {
+	if pcb.httpMode == HTTPModeLiveOnly || pcb.recordMode == RecordModeAll {
 		//nolint:nilnil // no track is not an error
 		return nil, nil
 	}
 
+	if trackNumber, found := pcb.seekTrackNumber(k7, request); found {
+		currentReq := track.ToRequest(httpRequest)
+		return pcb.replayTrack(k7, trackNumber, currentReq)
+	}
+
+	//nolint:nilnil // no track is not an error
+	return nil, nil
+}
+
+// requestToMatch returns the request that the tracks on the cassette are matched against.
+// It is redacted like the tracks that it recorded, such that it can match them. The request is
+// redacted once, rather than for each track that it is matched against.
+func (pcb *PrintedCircuitBoard) requestToMatch(httpRequest *http.Request) *track.Request {
 	request := track.ToRequest(httpRequest)
+	pcb.secretScanner.redactRequest(request)
+
+	return request
+}
 
+// seekTrackNumber returns the number of the first track on the cassette that has not been
+// replayed yet and that matches the request, which is the request to match of the HTTP request
+// (see requestToMatch).
+func (pcb *PrintedCircuitBoard) seekTrackNumber(k7 *cassette.Cassette, request *track.Request) (int32, bool) {
 	numberOfTracksInCassette := k7.NumberOfTracks()
 	for trackNumber := range numberOfTracksInCassette {
 		if pcb.trackMatches(k7, trackNumber, request) {
-			currentReq := track.ToRequest(httpRequest)
-			return pcb.replayTrack(k7, trackNumber, currentReq)
+			return trackNumber, true
 		}
 	}
 
-	//nolint:nilnil // no track is not an error
-	return nil, nil
+	return 0, false
+}
+
+// canRecord returns true when the VCR is permitted to record new tracks to the cassette.
+func (pcb *PrintedCircuitBoard) canRecord(k7 *cassette.Cassette) bool {
+	return !pcb.readOnly && pcb.canGoLive(k7)
+}
+
+// canGoLive returns true when the record mode permits the VCR to execute a live request after
+// no track was found on the cassette.
+func (pcb *PrintedCircuitBoard) canGoLive(k7 *cassette.Cassette) bool {
+	switch pcb.recordMode {
+	case RecordModeNone:
+		return false
+	case RecordModeOnce:
+		return k7.IsNew()
+	case RecordModeNewEpisodes, RecordModeAll:
+		return true
+	}
+
+	return true
 }
 
 func (pcb *PrintedCircuitBoard) trackMatches(k7 *cassette.Cassette, trackNumber int32, httpRequest *track.Request) bool {
@@ -72,6 +172,53 @@ func (pcb *PrintedCircuitBoard) trackMatches(k7 *cassette.Cassette, trackNumber
 	return !trk.IsReplayed() && pcb.requestMatchers.Match(httpRequestClone, trackReqClone)
 }
 
+// explainNoTrackMatch returns an error that describes the track on the cassette that came
+// closest to matching the request, and why it was not matched.
+// Tracks are ranked by the number of RequestMatcher's that accept them. Ties are resolved in
+// favour of tracks that have not been replayed yet, and then by the order of the tracks.
+// The request is the request to match of the HTTP request (see requestToMatch).
+func (pcb *PrintedCircuitBoard) explainNoTrackMatch(k7 *cassette.Cassette, request *track.Request, reason string) *govcrerr.ErrNoTrackMatch {
+	noTrackMatchErr := &govcrerr.ErrNoTrackMatch{
+		Reason:             reason,
+		ClosestTrackNumber: -1,
+	}
+
+	var closestTrackRequest track.Request
+
+	bestScore := -1
+
+	numberOfTracksInCassette := k7.NumberOfTracks()
+	for trackNumber := range numberOfTracksInCassette {
+		trk := k7.Track(trackNumber)
+
+		// protect the original objects against mutation by the matcher
+		accepted, rejectedBy := pcb.requestMatchers.Evaluate(request.Clone(), trk.Request.Clone())
+
+		score := 2 * accepted
+		if !trk.IsReplayed() {
+			score++
+		}
+
+		if score <= bestScore {
+			continue
+		}
+
+		bestScore = score
+		closestTrackRequest = trk.Request
+
+		noTrackMatchErr.ClosestTrackNumber = trackNumber
+		noTrackMatchErr.ClosestTrackUUID = trk.UUID
+		noTrackMatchErr.ClosestTrackReplayed = trk.IsReplayed()
+		noTrackMatchErr.RejectedBy = rejectedBy
+	}
+
+	if noTrackMatchErr.ClosestTrackNumber >= 0 {
+		noTrackMatchErr.Diffs = diffRequests(request, &closestTrackRequest, pcb.secretScanner.diffDetectors())
+	}
+
+	return noTrackMatchErr
+}
+
 func (pcb *PrintedCircuitBoard) replayTrack(k7 *cassette.Cassette, trackNumber int32, httpRequest *track.Request) (*track.Track, error) {
 	trk, err := k7.ReplayTrack(trackNumber)
 	if err != nil {
@@ -99,11 +246,21 @@ func (pcb *PrintedCircuitBoard) mutateTrackReplaying(t *track.Track) {
 
 // SetRequestMatchers sets a collection of RequestMatcher's.
 func (pcb *PrintedCircuitBoard) SetRequestMatchers(requestMatchers ...RequestMatcher) {
-	pcb.requestMatchers = requestMatchers
+	pcb.SetRequestMatchersNamed(RequestMatchers(requestMatchers).Named()...)
 }
 
 // AddRequestMatchers adds a collection of RequestMatcher's.
 func (pcb *PrintedCircuitBoard) AddRequestMatchers(requestMatchers ...RequestMatcher) {
+	pcb.AddRequestMatchersNamed(RequestMatchers(requestMatchers).Named()...)
+}
+
+// SetRequestMatchersNamed sets a collection of NamedRequestMatcher's.
+func (pcb *PrintedCircuitBoard) SetRequestMatchersNamed(requestMatchers ...NamedRequestMatcher) {
+	pcb.requestMatchers = requestMatchers
+}
+
+// AddRequestMatchersNamed adds a collection of NamedRequestMatcher's.
+func (pcb *PrintedCircuitBoard) AddRequestMatchersNamed(requestMatchers ...NamedRequestMatcher) {
 	pcb.requestMatchers = pcb.requestMatchers.Add(requestMatchers...)
 }
 
@@ -127,6 +284,11 @@ func (pcb *PrintedCircuitBoard) SetLiveOnlyMode() {
 	pcb.httpMode = HTTPModeLiveOnly
 }
 
+// SetRecordMode sets the VCR recording policy for the cassette.
+func (pcb *PrintedCircuitBoard) SetRecordMode(recordMode RecordMode) {
+	pcb.recordMode = recordMode
+}
+
 // AddRecordingMutators adds a collection of recording TrackMutator's.
 func (pcb *PrintedCircuitBoard) AddRecordingMutators(mutators ...track.Mutator) {
 	pcb.trackRecordingMutators = pcb.trackRecordingMutators.Add(mutators...)
@@ -7,6 +7,8 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"net/url"
+	"regexp"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -160,4 +162,48 @@ func TestPrintedCircuitBoard_trackMatches(t *testing.T) {
 	)
 }
 
+func TestPrintedCircuitBoard_SeekTrack_RedactsRequestOnce(t *testing.T) {
+	validations := 0
+
+	pcb := &PrintedCircuitBoard{
+		secretScanner: &secretScanner{
+			policy: SecretPolicyRedact,
+			detectors: []SecretDetector{
+				{
+					Name:    "counter",
+					Pattern: regexp.MustCompile(`s3cret`),
+					Validate: func(string) bool {
+						validations++
+						return true
+					},
+				},
+			},
+		},
+	}
+	pcb.SetRequestMatchers(DefaultMethodMatcher, DefaultURLMatcher)
+
+	k7 := &cassette.Cassette{
+		Tracks: []track.Track{
+			{Request: track.Request{Method: http.MethodGet, URL: &url.URL{Path: "/1"}}},
+			{Request: track.Request{Method: http.MethodGet, URL: &url.URL{Path: "/2"}}},
+			{Request: track.Request{Method: http.MethodGet, URL: &url.URL{Path: "/[REDACTED]"}}},
+		},
+	}
+
+	httpRequest, err := http.NewRequest(http.MethodGet, "/s3cret", http.NoBody)
+	require.NoError(t, err)
+
+	pcb.secretScanner.redactRequest(track.ToRequest(httpRequest))
+	validationsPerRedaction := validations
+	validations = 0
+
+	trk, err := pcb.SeekTrack(k7, httpRequest)
+	require.NoError(t, err)
+	require.NotNil(t, trk)
+	require.Equal(t, "/[REDACTED]", trk.Request.URL.Path)
+
+	// the request is redacted once, rather than for each track that it is matched against.
+	require.Equal(t, validationsPerRedaction, validations)
+}
+
 func strPtr(s string) *string { return &s }
@@ -0,0 +1,244 @@
+package govcr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/seborama/govcr/v17/cassette/track"
+	govcrerr "github.com/seborama/govcr/v17/errors"
+	"github.com/seborama/govcr/v17/secrets"
+)
+
+// maxBodyDiffLen is the maximum number of body bytes shown in a FieldDiff.
+const maxBodyDiffLen = 128
+
+// diffRequests returns the differences between the method, URL, headers and body of the
+// HTTP request and of the track request.
+// The values of the diffs are masked, since they end up in test output and CI logs: the
+// values of the sensitive headers, parameters and JSON properties, such as Authorization and
+// "password", and the secrets that the detectors detect, are replaced with SecretRedaction.
+func diffRequests(httpRequest, trackRequest *track.Request, detectors []secrets.Detector) []govcrerr.FieldDiff {
+	m := diffMasker{detectors: detectors}
+
+	var diffs []govcrerr.FieldDiff
+
+	if httpRequest.Method != trackRequest.Method {
+		diffs = append(diffs, govcrerr.FieldDiff{
+			Field:   "method",
+			Request: httpRequest.Method,
+			Track:   trackRequest.Method,
+		})
+	}
+
+	if httpURL, trackURL := urlString(httpRequest.URL), urlString(trackRequest.URL); httpURL != trackURL {
+		diffs = append(diffs, govcrerr.FieldDiff{
+			Field:   "url",
+			Request: m.url(httpRequest.URL),
+			Track:   m.url(trackRequest.URL),
+		})
+	}
+
+	diffs = append(diffs, m.diffHeaders(httpRequest.Header, trackRequest.Header)...)
+
+	if !bytes.Equal(httpRequest.Body, trackRequest.Body) {
+		diffs = append(diffs, govcrerr.FieldDiff{
+			Field:   "body",
+			Request: bodyString(httpRequest.Body, m.body(httpRequest.Body)),
+			Track:   bodyString(trackRequest.Body, m.body(trackRequest.Body)),
+		})
+	}
+
+	return diffs
+}
+
+func (m diffMasker) diffHeaders(httpHeader, trackHeader map[string][]string) []govcrerr.FieldDiff {
+	keys := make([]string, 0, len(httpHeader)+len(trackHeader))
+
+	for k := range httpHeader {
+		keys = append(keys, k)
+	}
+
+	for k := range trackHeader {
+		if _, ok := httpHeader[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	slices.Sort(keys)
+
+	var diffs []govcrerr.FieldDiff
+
+	for _, k := range keys {
+		httpValues, trackValues := headerValuesString(httpHeader, k), headerValuesString(trackHeader, k)
+		if httpValues != trackValues {
+			diffs = append(diffs, govcrerr.FieldDiff{
+				Field:   "header " + k,
+				Request: m.headerValuesString(httpHeader, k),
+				Track:   m.headerValuesString(trackHeader, k),
+			})
+		}
+	}
+
+	return diffs
+}
+
+func headerValuesString(header map[string][]string, key string) string {
+	values, ok := header[key]
+	if !ok {
+		return "<absent>"
+	}
+
+	// header values are compared irrespective of their order, as with DefaultHeaderMatcher
+	sortedValues := slices.Clone(values)
+	slices.Sort(sortedValues)
+
+	return fmt.Sprintf("%q", sortedValues)
+}
+
+func urlString(u *url.URL) string {
+	if u == nil {
+		return "<nil>"
+	}
+
+	return u.String()
+}
+
+// bodyString returns the length of the body and an excerpt of its masked text.
+func bodyString(body []byte, masked string) string {
+	if len(masked) <= maxBodyDiffLen {
+		return fmt.Sprintf("(%d bytes) %q", len(body), masked)
+	}
+
+	return fmt.Sprintf("(%d bytes) %q...", len(body), masked[:maxBodyDiffLen])
+}
+
+// diffMasker masks the credentials in the values of the diffs.
+type diffMasker struct {
+	detectors []secrets.Detector
+}
+
+// text returns the text with the secrets detected by the detectors redacted.
+func (m diffMasker) text(text string) string {
+	for _, detector := range m.detectors {
+		text = detector.Redact(text, SecretRedaction)
+	}
+
+	return text
+}
+
+// headerValuesString returns the values of the header, masked, or all redacted when the
+// header holds credentials.
+func (m diffMasker) headerValuesString(header map[string][]string, key string) string {
+	values, ok := header[key]
+	if !ok {
+		return headerValuesString(header, key)
+	}
+
+	masked := make([]string, len(values))
+
+	for i, value := range values {
+		if secrets.IsSensitiveHeader(key) {
+			masked[i] = SecretRedaction
+		} else {
+			masked[i] = m.text(value)
+		}
+	}
+
+	return headerValuesString(map[string][]string{key: masked}, key)
+}
+
+// url returns the URL with its password and the values of its sensitive parameters redacted,
+// and the secrets in the rest of it masked.
+func (m diffMasker) url(u *url.URL) string {
+	if u == nil {
+		return urlString(u)
+	}
+
+	masked := *u
+
+	if _, hasPassword := u.User.Password(); hasPassword {
+		masked.User = url.UserPassword(u.User.Username(), SecretRedaction)
+	}
+
+	masked.RawQuery = maskQuery(u.RawQuery)
+
+	return m.text(masked.String())
+}
+
+// body returns the text of the body with the values of the sensitive JSON properties or form
+// parameters redacted, and the secrets in the rest of it masked.
+func (m diffMasker) body(body []byte) string {
+	text := string(body)
+
+	if json.Valid(body) {
+		var value any
+
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+
+		if d.Decode(&value) == nil && maskJSON(value) {
+			var buf bytes.Buffer
+
+			e := json.NewEncoder(&buf)
+			e.SetEscapeHTML(false)
+
+			if e.Encode(value) == nil {
+				text = strings.TrimSuffix(buf.String(), "\n")
+			}
+		}
+	} else {
+		text = maskQuery(text)
+	}
+
+	return m.text(text)
+}
+
+// maskQuery returns the URL query or the form with the values of its sensitive parameters
+// redacted. The order of the parameters is preserved.
+func maskQuery(query string) string {
+	params := strings.Split(query, "&")
+
+	for i, param := range params {
+		key, _, found := strings.Cut(param, "=")
+		if !found {
+			continue
+		}
+
+		if unescaped, err := url.QueryUnescape(key); err == nil && secrets.IsSensitiveName(unescaped) {
+			params[i] = key + "=" + SecretRedaction
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+// maskJSON redacts the string values of the sensitive properties of the JSON value, and
+// returns true if any was.
+func maskJSON(value any) bool {
+	masked := false
+
+	switch v := value.(type) {
+	case map[string]any:
+		for key := range v {
+			if _, ok := v[key].(string); ok && secrets.IsSensitiveName(key) {
+				v[key] = SecretRedaction
+				masked = true
+
+				continue
+			}
+
+			masked = maskJSON(v[key]) || masked
+		}
+
+	case []any:
+		for i := range v {
+			masked = maskJSON(v[i]) || masked
+		}
+	}
+
+	return masked
+}
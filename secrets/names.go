@@ -0,0 +1,26 @@
+package secrets
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+)
+
+// sensitiveHeaders are the headers that hold credentials.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie"}
+
+// sensitiveName matches the names of headers, parameters and JSON properties that hold
+// credentials.
+var sensitiveName = regexp.MustCompile(`(?i)(api[-_]?key|access[-_]?key|secret|token|passw(or)?d|credentials?|signature|session[-_]?id)$`)
+
+// IsSensitiveName returns true if the name of a header, a parameter or a JSON property is
+// that of a credential, such as "api_key" or "password".
+func IsSensitiveName(name string) bool {
+	return sensitiveName.MatchString(name)
+}
+
+// IsSensitiveHeader returns true if the header holds credentials, such as the Authorization
+// and Cookie headers, or a header named after a credential, such as X-API-Key.
+func IsSensitiveHeader(name string) bool {
+	return slices.Contains(sensitiveHeaders, http.CanonicalHeaderKey(name)) || IsSensitiveName(name)
+}
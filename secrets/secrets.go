@@ -0,0 +1,123 @@
+// Package secrets detects secrets, such as JWTs, AWS keys, bearer tokens and private keys,
+// in the values of the tracks.
+// It is shared by the secret scanning of the VCR and the lint command of the govcr CLI.
+package secrets
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Detector detects a kind of secret with a regular expression.
+// When the expression has a capture group, only the text of the first group is the secret:
+// for instance, the token that follows "Bearer ".
+type Detector struct {
+	Name    string
+	Pattern *regexp.Regexp
+
+	// Validate, when set, only accepts the secrets that it returns true for, such as the
+	// secrets that look like tokens rather than words.
+	Validate func(secret string) bool
+}
+
+// NewDetector creates a new Detector.
+// It panics if the pattern is not a valid regular expression.
+func NewDetector(name, pattern string) Detector {
+	return Detector{
+		Name:    name,
+		Pattern: regexp.MustCompile(pattern),
+	}
+}
+
+// DefaultDetectors returns the built-in detectors of JWTs, AWS keys, bearer tokens and
+// private keys.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		NewDetector("private-key", `-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY-----[\s\S]*?(?:-----END (?:[A-Z0-9]+ )*PRIVATE KEY-----|$)`),
+		NewDetector("aws-access-key-id", `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		NewDetector("aws-secret-access-key", `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`),
+		NewDetector("jwt", `\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+		// a bearer token is a whole value, such as that of an Authorization header, or it looks
+		// like a token, unlike the words of "Bearer authorization required".
+		NewDetector("bearer-token", `(?i)^\s*bearer\s+([A-Za-z0-9._~+/-]{8,}=*)\s*$`),
+		{
+			Name:     "bearer-token",
+			Pattern:  regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{8,}=*)`),
+			Validate: isTokenLike,
+		},
+	}
+}
+
+// isTokenLike returns true if the value holds digits, punctuation or mixed case letters past
+// its first letter, as tokens do and words do not.
+func isTokenLike(value string) bool {
+	if strings.ContainsAny(value, "0123456789._~+/-=") {
+		return true
+	}
+
+	return len(value) > 1 && strings.ToLower(value[1:]) != value[1:] && strings.ToUpper(value) != value
+}
+
+// Match returns true if the value holds a secret detected by the detector.
+func (d Detector) Match(value string) bool {
+	if d.Validate == nil {
+		return d.Pattern.MatchString(value)
+	}
+
+	return len(d.secrets(value)) > 0
+}
+
+// Redact returns the value with the secrets detected by the detector replaced with the
+// replacement.
+func (d Detector) Redact(value, replacement string) string {
+	var redacted []byte
+
+	last := 0
+
+	for _, loc := range d.secrets(value) {
+		redacted = append(redacted, value[last:loc[0]]...)
+		redacted = append(redacted, replacement...)
+		last = loc[1]
+	}
+
+	return string(append(redacted, value[last:]...))
+}
+
+// secrets returns the locations of the secrets in the value: the matches of the pattern, or
+// the text of their first capture group, if the pattern has one, that Validate accepts.
+func (d Detector) secrets(value string) [][2]int {
+	var locs [][2]int
+
+	for _, loc := range d.Pattern.FindAllStringSubmatchIndex(value, -1) {
+		if d.Pattern.NumSubexp() > 0 {
+			loc = loc[2:]
+		}
+
+		if loc[0] < 0 {
+			continue
+		}
+
+		if d.Validate != nil && !d.Validate(value[loc[0]:loc[1]]) {
+			continue
+		}
+
+		locs = append(locs, [2]int{loc[0], loc[1]})
+	}
+
+	return locs
+}
+
+// Detect returns the names of the detectors that detect a secret in the value, in the order
+// of the detectors. Several detectors may share a name, which is returned once.
+func Detect(detectors []Detector, value string) []string {
+	var names []string
+
+	for _, detector := range detectors {
+		if detector.Match(value) && !slices.Contains(names, detector.Name) {
+			names = append(names, detector.Name)
+		}
+	}
+
+	return names
+}
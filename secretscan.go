@@ -0,0 +1,254 @@
+package govcr
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/seborama/govcr/v17/cassette/track"
+	govcrerr "github.com/seborama/govcr/v17/errors"
+	"github.com/seborama/govcr/v17/secrets"
+)
+
+// SecretPolicy defines what the VCR does with a new track that holds secrets.
+type SecretPolicy int
+
+const (
+	// SecretPolicyRefuse refuses to record a track that holds secrets: the request returns an
+	// error that reports the fields of the track that hold the secrets. This is the default.
+	SecretPolicyRefuse SecretPolicy = iota
+
+	// SecretPolicyRedact replaces the secrets with SecretRedaction before the track is recorded.
+	// Each redaction is logged with the track and the field that held the secret.
+	SecretPolicyRedact
+)
+
+// SecretRedaction replaces the secrets on tracks with SecretPolicyRedact.
+const SecretRedaction = "[REDACTED]"
+
+// SecretDetector detects a kind of secret with a regular expression.
+// When the expression has a capture group, only the text of the first group is the secret:
+// for instance, the token that follows "Bearer ".
+type SecretDetector = secrets.Detector
+
+// NewSecretDetector creates a new SecretDetector.
+// It panics if the pattern is not a valid regular expression.
+func NewSecretDetector(name, pattern string) SecretDetector {
+	return secrets.NewDetector(name, pattern)
+}
+
+// DefaultSecretDetectors returns the built-in detectors of JWTs, AWS keys, bearer tokens and
+// private keys.
+func DefaultSecretDetectors() []SecretDetector {
+	return secrets.DefaultDetectors()
+}
+
+// secretScanner scans the new tracks for secrets, after the recording mutators.
+type secretScanner struct {
+	policy    SecretPolicy
+	detectors []SecretDetector
+}
+
+// scan applies the policy to the track, when it holds secrets.
+func (s *secretScanner) scan(trk *track.Track) error {
+	if s == nil {
+		return nil
+	}
+
+	// the UUID identifies the track in the report, and then on the cassette.
+	if trk.UUID == "" {
+		trk.UUID = uuid.NewString()
+	}
+
+	if s.policy == SecretPolicyRedact {
+		for _, finding := range s.inspectTrack(trk, true) {
+			slog.Warn("govcr redacted a secret from a new track",
+				slog.String("track", trk.UUID),
+				slog.String("field", finding.Field),
+				slog.String("detector", finding.Detector))
+		}
+
+		return nil
+	}
+
+	findings := s.inspectTrack(trk, false)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	return errors.WithStack(&govcrerr.ErrSecretDetected{
+		TrackUUID: trk.UUID,
+		Request:   trk.Request.Method + " " + s.redact(urlString(trk.Request.URL)),
+		Secrets:   findings,
+	})
+}
+
+// redactRequest redacts the secrets from the request with SecretPolicyRedact, such that the
+// request can match the tracks that were redacted when they were recorded.
+func (s *secretScanner) redactRequest(req *track.Request) {
+	if s == nil || s.policy != SecretPolicyRedact {
+		return
+	}
+
+	i := &secretInspector{detectors: s.detectors, redact: true}
+	i.request(req)
+}
+
+// inspectTrack returns the secrets found in the request, the response and the error message of
+// the track. The secrets are redacted from the track when redact is true.
+func (s *secretScanner) inspectTrack(trk *track.Track, redact bool) []govcrerr.SecretFinding {
+	i := &secretInspector{detectors: s.detectors, redact: redact}
+
+	i.request(&trk.Request)
+
+	if trk.Response != nil {
+		i.header("response header", trk.Response.Header)
+		i.header("response trailer", trk.Response.Trailer)
+		i.body("response body", &trk.Response.Body, &trk.Response.ContentLength)
+	}
+
+	if trk.ErrMsg != nil {
+		i.value("error message", trk.ErrMsg)
+	}
+
+	return dedupeSecretFindings(i.findings)
+}
+
+// secretInspector inspects the fields of a track for secrets and redacts them, if required.
+type secretInspector struct {
+	detectors []SecretDetector
+	redact    bool
+	findings  []govcrerr.SecretFinding
+}
+
+// request inspects the URL, the headers, the forms and the body of the request.
+func (i *secretInspector) request(req *track.Request) {
+	if u := req.URL; u != nil {
+		for _, part := range []*string{&u.Path, &u.RawPath, &u.RawQuery, &u.Fragment} {
+			i.value("request URL", part)
+		}
+
+		i.userinfo("request URL", u)
+	}
+
+	i.header("request header", req.Header)
+	i.header("request trailer", req.Trailer)
+	i.values("request form", req.Form)
+	i.values("request post form", req.PostForm)
+	i.body("request body", &req.Body, &req.ContentLength)
+}
+
+func (i *secretInspector) value(field string, value *string) {
+	for _, detector := range i.detectors {
+		if !detector.Match(*value) {
+			continue
+		}
+
+		i.findings = append(i.findings, govcrerr.SecretFinding{Field: field, Detector: detector.Name})
+
+		if i.redact {
+			*value = detector.Redact(*value, SecretRedaction)
+		}
+	}
+}
+
+// userinfo inspects the username and the password of the URL.
+func (i *secretInspector) userinfo(field string, u *url.URL) {
+	if u.User == nil {
+		return
+	}
+
+	username := u.User.Username()
+	i.value(field, &username)
+
+	password, hasPassword := u.User.Password()
+	if hasPassword {
+		i.value(field, &password)
+	}
+
+	if !i.redact {
+		return
+	}
+
+	if hasPassword {
+		u.User = url.UserPassword(username, password)
+	} else {
+		u.User = url.User(username)
+	}
+}
+
+func (i *secretInspector) header(field string, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for j := range header[key] {
+			i.value(field+" "+key, &header[key][j])
+		}
+	}
+}
+
+func (i *secretInspector) values(field string, values url.Values) {
+	i.header(field, http.Header(values))
+}
+
+func (i *secretInspector) body(field string, body *[]byte, contentLength *int64) {
+	value := string(*body)
+	i.value(field, &value)
+
+	if value == string(*body) {
+		return
+	}
+
+	if *contentLength == int64(len(*body)) {
+		*contentLength = int64(len(value))
+	}
+
+	*body = []byte(value)
+}
+
+// redact returns the value with the secrets redacted.
+func (s *secretScanner) redact(value string) string {
+	for _, detector := range s.detectors {
+		value = detector.Redact(value, SecretRedaction)
+	}
+
+	return value
+}
+
+// diffDetectors returns the detectors of the secrets to mask in the diffs of ErrNoTrackMatch,
+// which are masked even when secret scanning is off.
+func (s *secretScanner) diffDetectors() []SecretDetector {
+	if s == nil {
+		return DefaultSecretDetectors()
+	}
+
+	return s.detectors
+}
+
+// dedupeSecretFindings removes the repeated findings, which come from secrets found in several
+// values of the same field, such as the parts of the URL.
+func dedupeSecretFindings(findings []govcrerr.SecretFinding) []govcrerr.SecretFinding {
+	seen := map[govcrerr.SecretFinding]struct{}{}
+
+	deduped := findings[:0]
+
+	for _, finding := range findings {
+		if _, ok := seen[finding]; ok {
+			continue
+		}
+
+		seen[finding] = struct{}{}
+		deduped = append(deduped, finding)
+	}
+
+	return deduped
+}
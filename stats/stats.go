@@ -15,4 +15,8 @@ type Stats struct {
 	// TracksPlayed is the number of tracks played back straight from the cassette.
 	// I.e. tracks that were already present on the cassette and were played back.
 	TracksPlayed int32
+
+	// Mode is the name of the effective VCR mode (e.g. "normal", "offline", etc).
+	// See govcr.Mode* for the list of modes.
+	Mode string
 }
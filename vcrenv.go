@@ -0,0 +1,104 @@
+package govcr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// EnvMode is the name of the environment variable that selects the VCR mode.
+	// Supported values are:
+	// - "record": all requests are executed live and recorded (see RecordModeAll).
+	// - "replay": tracks are replayed from cassette, other requests are executed live but
+	// not recorded (see WithReadOnlyMode).
+	// - "offline": tracks are replayed from cassette, other requests fail (see WithOfflineMode).
+	// - "live": all requests are executed live and not recorded (see WithLiveOnlyMode).
+	EnvMode = "GOVCR_MODE"
+
+	// EnvRecord is the name of the environment variable that holds a comma-separated list of
+	// glob patterns (see filepath.Match). The cassettes with a name (or base name) that
+	// matches any of the patterns are set to "record" mode, regardless of EnvMode.
+	EnvRecord = "GOVCR_RECORD"
+)
+
+// Names of the VCR modes, as reported by stats.Stats.
+const (
+	ModeNormal     = "normal"
+	ModeRecord     = "record"
+	ModeRecordOnce = "record-once"
+	ModeRecordNone = "record-none"
+	ModeReplay     = "replay"
+	ModeOffline    = "offline"
+	ModeLive       = "live"
+)
+
+// applyModeEnv applies the VCR mode selected by the environment variables, if any, unless a
+// mode was selected explicitly with a Setting and the environment does not take precedence
+// (see WithModeEnvOverSettings).
+// It panics when the environment variables hold invalid values, in the same way that
+// NewVCR panics when a cassette is invalid.
+func (vcrSettings *VCRSettings) applyModeEnv() {
+	if vcrSettings.modeSet && !vcrSettings.modeEnvOverSettings {
+		return
+	}
+
+	mode := os.Getenv(EnvMode)
+
+	if patterns := os.Getenv(EnvRecord); patterns != "" && matchesAnyGlob(vcrSettings.cassette.Name(), patterns) {
+		mode = ModeRecord
+	}
+
+	switch mode {
+	case "":
+		return
+
+	case ModeRecord:
+		vcrSettings.httpMode = HTTPModeNormal
+		vcrSettings.readOnly = false
+		vcrSettings.recordMode = RecordModeAll
+
+	case ModeReplay:
+		vcrSettings.httpMode = HTTPModeNormal
+		vcrSettings.readOnly = true
+		vcrSettings.recordMode = RecordModeNewEpisodes
+
+	case ModeOffline:
+		vcrSettings.httpMode = HTTPModeOffline
+		vcrSettings.readOnly = false
+		vcrSettings.recordMode = RecordModeNewEpisodes
+
+	case ModeLive:
+		vcrSettings.httpMode = HTTPModeLiveOnly
+		vcrSettings.readOnly = true
+		vcrSettings.recordMode = RecordModeNewEpisodes
+
+	default:
+		panic(fmt.Sprintf("invalid %s value '%s': expected one of %s, %s, %s or %s", EnvMode, mode, ModeRecord, ModeReplay, ModeOffline, ModeLive))
+	}
+}
+
+// matchesAnyGlob returns true if the name, or its base name, matches any of the
+// comma-separated glob patterns.
+func matchesAnyGlob(name, patterns string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		for _, n := range []string{name, filepath.Base(name)} {
+			matched, err := filepath.Match(pattern, n)
+			if err != nil {
+				panic(fmt.Sprintf("invalid %s pattern '%s': %v", EnvRecord, pattern, err))
+			}
+
+			if matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,114 @@
+package govcr_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seborama/govcr/v17"
+)
+
+func TestNewVCR_ModeEnv(t *testing.T) {
+	const cassetteName = "temp-fixtures/TestNewVCR_ModeEnv.cassette.json"
+
+	tt := []*struct {
+		name     string
+		mode     string
+		record   string
+		settings []govcr.Setting
+		wantMode string
+	}{
+		{
+			name:     "no environment",
+			wantMode: govcr.ModeNormal,
+		},
+		{
+			name:     "no environment with settings",
+			settings: []govcr.Setting{govcr.WithOfflineMode()},
+			wantMode: govcr.ModeOffline,
+		},
+		{
+			name:     "record",
+			mode:     "record",
+			wantMode: govcr.ModeRecord,
+		},
+		{
+			name:     "replay",
+			mode:     "replay",
+			wantMode: govcr.ModeReplay,
+		},
+		{
+			name:     "offline",
+			mode:     "offline",
+			wantMode: govcr.ModeOffline,
+		},
+		{
+			name:     "live",
+			mode:     "live",
+			wantMode: govcr.ModeLive,
+		},
+		{
+			name:     "settings win over environment by default",
+			mode:     "replay",
+			settings: []govcr.Setting{govcr.WithOfflineMode()},
+			wantMode: govcr.ModeOffline,
+		},
+		{
+			name:     "environment wins over settings when configured",
+			mode:     "replay",
+			settings: []govcr.Setting{govcr.WithOfflineMode(), govcr.WithModeEnvOverSettings()},
+			wantMode: govcr.ModeReplay,
+		},
+		{
+			name:     "record glob wins over settings when configured",
+			record:   "TestNewVCR_ModeEnv.*",
+			settings: []govcr.Setting{govcr.WithOfflineMode(), govcr.WithModeEnvOverSettings()},
+			wantMode: govcr.ModeRecord,
+		},
+		{
+			name:     "environment applies when no mode setting is present",
+			mode:     "replay",
+			settings: []govcr.Setting{govcr.WithRequestMatchers(govcr.DefaultMethodMatcher)},
+			wantMode: govcr.ModeReplay,
+		},
+		{
+			name:     "record glob matches cassette base name",
+			mode:     "offline",
+			record:   "other.json, TestNewVCR_ModeEnv.*",
+			wantMode: govcr.ModeRecord,
+		},
+		{
+			name:     "record glob matches cassette name",
+			record:   "temp-fixtures/*.json",
+			wantMode: govcr.ModeRecord,
+		},
+		{
+			name:     "record glob does not match cassette",
+			mode:     "offline",
+			record:   "other.json",
+			wantMode: govcr.ModeOffline,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(govcr.EnvMode, tc.mode)
+			t.Setenv(govcr.EnvRecord, tc.record)
+
+			vcr := govcr.NewVCR(govcr.NewCassetteLoader(cassetteName), tc.settings...)
+			assert.Equal(t, tc.wantMode, vcr.Stats().Mode)
+		})
+	}
+}
+
+func TestNewVCR_InvalidModeEnv(t *testing.T) {
+	t.Setenv(govcr.EnvMode, "bad")
+
+	assert.PanicsWithValue(
+		t,
+		"invalid GOVCR_MODE value 'bad': expected one of record, replay, offline or live",
+		func() {
+			_ = govcr.NewVCR(govcr.NewCassetteLoader("temp-fixtures/TestNewVCR_InvalidModeEnv.cassette.json"))
+		},
+	)
+}
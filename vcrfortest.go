@@ -0,0 +1,71 @@
+package govcr
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestCassetteDir is the directory where NewVCRForTest stores its cassettes.
+const TestCassetteDir = "testdata"
+
+var unsafeCassetteNameChars = regexp.MustCompile(`[^A-Za-z0-9._/-]+`) //nolint:gochecknoglobals // compiled once
+
+// TestCassetteName returns the name of the cassette of the supplied test.
+// The name derives from t.Name(), such that sub-tests have their cassettes in a sub-directory
+// named after their parent test: "testdata/TestParent/sub_test.cassette.json".
+func TestCassetteName(t testing.TB) string {
+	name := unsafeCassetteNameChars.ReplaceAllString(t.Name(), "_")
+	return filepath.Join(TestCassetteDir, filepath.FromSlash(name)+".cassette.json")
+}
+
+// NewVCRForTest creates a new VCR with the cassette of the supplied test (see TestCassetteName).
+//
+// The cassette is ejected when the test completes, its unused tracks are only pruned (see
+// WithPruneUnusedTracksOnEject) when the test succeeded. The test fails when:
+// - the cassette cannot be ejected.
+// - some tracks on the cassette were not used during the test (see WithFailOnUnusedTracks).
+// - some requests did not match any track and could not be placed live (e.g. in offline mode).
+func NewVCRForTest(t testing.TB, settings ...Setting) *ControlPanel {
+	t.Helper()
+
+	settings = append([]Setting{WithFailOnUnusedTracks()}, settings...)
+
+	vcr := NewVCR(NewCassetteLoader(TestCassetteName(t)), settings...)
+
+	t.Cleanup(func() {
+		t.Helper()
+
+		// a failed test may not have placed all of its requests: its tracks must be kept
+		if err := vcr.vcrTransport().eject(!t.Failed()); err != nil {
+			t.Errorf("govcr: %v", err)
+		}
+
+		if report := vcr.vcrTransport().refusedReport(); report != "" {
+			t.Errorf("govcr: cassette '%s': %s", TestCassetteName(t), report)
+		}
+	})
+
+	return vcr
+}
+
+// refusedReport returns a readable report of the requests that were refused a live call,
+// or an empty string when there is nothing to report.
+func (t *vcrTransport) refusedReport() string {
+	refused := t.refusedRequests()
+	if len(refused) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	_, _ = fmt.Fprintf(&sb, "%d request(s) did not match any track and could not be placed live:", len(refused))
+
+	for _, req := range refused {
+		_, _ = fmt.Fprintf(&sb, "\n  - %s", req)
+	}
+
+	return sb.String()
+}
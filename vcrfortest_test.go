@@ -0,0 +1,140 @@
+package govcr_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seborama/govcr/v17"
+)
+
+// fakeTB captures the interactions of NewVCRForTest with its testing.TB.
+type fakeTB struct {
+	testing.TB
+	name     string
+	cleanups []func()
+	errs     []string
+	failed   bool
+}
+
+func (f *fakeTB) Name() string { return f.name }
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Failed() bool { return f.failed || len(f.errs) > 0 }
+
+func (f *fakeTB) Cleanup(fn func()) { f.cleanups = append(f.cleanups, fn) }
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errs = append(f.errs, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) runCleanups() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func TestTestCassetteName(t *testing.T) {
+	assert.Equal(
+		t,
+		filepath.Join("testdata", "TestParent", "sub_test_1_.cassette.json"),
+		govcr.TestCassetteName(&fakeTB{name: "TestParent/sub test (1)"}),
+	)
+}
+
+func TestNewVCRForTest(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	const testName = "TestNewVCRForTest/fake"
+
+	cleanup := func() {
+		_ = os.RemoveAll(filepath.Join(govcr.TestCassetteDir, "TestNewVCRForTest"))
+		_ = os.Remove(govcr.TestCassetteDir) // only succeeds if empty
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	// STEP 1: record two tracks.
+	tb := &fakeTB{TB: t, name: testName}
+	vcr := govcr.NewVCRForTest(tb)
+	for _, path := range []string{"/a", "/b"} {
+		resp, err := vcr.HTTPClient().Get(testServer.URL + path)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+	tb.runCleanups()
+	assert.Empty(t, tb.errs)
+	assert.FileExists(t, govcr.TestCassetteName(tb))
+
+	// STEP 2: replay one track only, in offline mode, and request an unknown track.
+	tb = &fakeTB{TB: t, name: testName}
+	vcr = govcr.NewVCRForTest(tb, govcr.WithOfflineMode())
+	resp, err := vcr.HTTPClient().Get(testServer.URL + "/a")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	_, err = vcr.HTTPClient().Get(testServer.URL + "/c") //nolint:bodyclose // no response
+	require.Error(t, err)
+	tb.runCleanups()
+
+	require.Len(t, tb.errs, 2)
+	assert.Contains(t, tb.errs[0], "1 track(s) were not used:\n  - #1 (UUID: ")
+	assert.True(t, strings.HasSuffix(tb.errs[0], ") GET "+testServer.URL+"/b"))
+	assert.Contains(t, tb.errs[1], "1 request(s) did not match any track and could not be placed live:\n  - GET "+testServer.URL+"/c")
+}
+
+func TestNewVCRForTest_PruneUnusedTracksOnEject(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	const testName = "TestNewVCRForTest_PruneUnusedTracksOnEject"
+
+	cleanup := func() {
+		_ = os.Remove(govcr.TestCassetteName(&fakeTB{name: testName}))
+		_ = os.Remove(govcr.TestCassetteDir) // only succeeds if empty
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	get := func(vcr *govcr.ControlPanel, path string) {
+		resp, err := vcr.HTTPClient().Get(testServer.URL + path)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+
+	// STEP 1: record two tracks.
+	tb := &fakeTB{TB: t, name: testName}
+	vcr := govcr.NewVCRForTest(tb)
+	get(vcr, "/a")
+	get(vcr, "/b")
+	tb.runCleanups()
+	require.Empty(t, tb.errs)
+
+	// STEP 2: a failed test does not prune its cassette.
+	tb = &fakeTB{TB: t, name: testName, failed: true}
+	vcr = govcr.NewVCRForTest(tb, govcr.WithPruneUnusedTracksOnEject())
+	get(vcr, "/a")
+	tb.runCleanups()
+	assert.Len(t, tb.errs, 1)
+	assert.EqualValues(t, 2, vcr.NumberOfTracks())
+
+	// STEP 3: a successful test prunes its cassette.
+	tb = &fakeTB{TB: t, name: testName}
+	vcr = govcr.NewVCRForTest(tb, govcr.WithPruneUnusedTracksOnEject())
+	get(vcr, "/a")
+	tb.runCleanups()
+	assert.Empty(t, tb.errs)
+	assert.EqualValues(t, 1, vcr.NumberOfTracks())
+}
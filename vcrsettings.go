@@ -22,6 +22,14 @@ func WithClient(httpClient *http.Client) Setting {
 // set of RequestMatcher's applied when matching an HTTP/S request to an existing
 // track on a cassette.
 func WithRequestMatchers(reqMatchers ...RequestMatcher) Setting {
+	return WithRequestMatchersNamed(RequestMatchers(reqMatchers).Named()...)
+}
+
+// WithRequestMatchersNamed is an optional functional parameter to provide a VCR with a
+// set of NamedRequestMatcher's applied when matching an HTTP/S request to an existing
+// track on a cassette. The names report which RequestMatcher rejected a track when no track
+// matches a request.
+func WithRequestMatchersNamed(reqMatchers ...NamedRequestMatcher) Setting {
 	return func(vcrSettings *VCRSettings) {
 		vcrSettings.requestMatchers = vcrSettings.requestMatchers.Add(reqMatchers...)
 	}
@@ -52,6 +60,7 @@ func WithTrackReplayingMutators(trackReplayingMutators ...track.Mutator) Setting
 func WithLiveOnlyMode() Setting {
 	return func(vcrSettings *VCRSettings) {
 		vcrSettings.httpMode = HTTPModeLiveOnly
+		vcrSettings.modeSet = true
 	}
 }
 
@@ -60,6 +69,7 @@ func WithLiveOnlyMode() Setting {
 func WithReadOnlyMode() Setting {
 	return func(vcrSettings *VCRSettings) {
 		vcrSettings.readOnly = true
+		vcrSettings.modeSet = true
 	}
 }
 
@@ -69,6 +79,63 @@ func WithReadOnlyMode() Setting {
 func WithOfflineMode() Setting {
 	return func(vcrSettings *VCRSettings) {
 		vcrSettings.httpMode = HTTPModeOffline
+		vcrSettings.modeSet = true
+	}
+}
+
+// WithModeEnvOverSettings gives the environment variables EnvMode and EnvRecord precedence
+// over the mode settings (WithLiveOnlyMode, WithReadOnlyMode, WithOfflineMode and
+// WithRecordMode). By default, the mode settings take precedence and the environment
+// variables only apply to the VCRs that have no mode setting.
+func WithModeEnvOverSettings() Setting {
+	return func(vcrSettings *VCRSettings) {
+		vcrSettings.modeEnvOverSettings = true
+	}
+}
+
+// WithFailOnUnusedTracks makes ControlPanel.Eject return an error when some tracks on the
+// cassette were neither replayed nor recorded during the VCR session.
+// This reveals dead fixtures and requests that are no longer placed.
+// See ControlPanel.UnusedTracks.
+func WithFailOnUnusedTracks() Setting {
+	return func(vcrSettings *VCRSettings) {
+		vcrSettings.failOnUnusedTracks = true
+	}
+}
+
+// WithPruneUnusedTracksOnEject removes the tracks that were neither replayed nor recorded
+// during the VCR session from the cassette when ControlPanel.Eject is called.
+// The cassette keeps its compression and crypter.
+// This takes precedence over WithFailOnUnusedTracks. Tracks are only pruned when the VCR was
+// permitted to record (i.e. not in offline or read-only mode, and the record mode allowed
+// live requests) and no request was refused a live call: the unused tracks may otherwise
+// be those of the requests that were not placed. Tracks are not pruned in live only mode
+// since no track is replayed.
+func WithPruneUnusedTracksOnEject() Setting {
+	return func(vcrSettings *VCRSettings) {
+		vcrSettings.pruneUnusedTracks = true
+	}
+}
+
+// WithRecordMode sets the VCR recording policy for the cassette.
+// See RecordMode for details.
+func WithRecordMode(recordMode RecordMode) Setting {
+	return func(vcrSettings *VCRSettings) {
+		vcrSettings.recordMode = recordMode
+		vcrSettings.modeSet = true
+	}
+}
+
+// WithSecretScanning scans each new track for secrets after the recording mutators, with the
+// DefaultSecretDetectors and the custom detectors. A track that holds secrets is refused or
+// redacted according to the policy.
+// This is a safeguard for the credentials that recording mutators should have removed.
+func WithSecretScanning(policy SecretPolicy, detectors ...SecretDetector) Setting {
+	return func(vcrSettings *VCRSettings) {
+		vcrSettings.secretScanner = &secretScanner{
+			policy:    policy,
+			detectors: append(DefaultSecretDetectors(), detectors...),
+		}
 	}
 }
 
@@ -76,9 +143,16 @@ func WithOfflineMode() Setting {
 type VCRSettings struct {
 	client                 *http.Client
 	cassette               *cassette.Cassette
-	requestMatchers        RequestMatchers
+	requestMatchers        NamedRequestMatchers
 	trackRecordingMutators track.Mutators
 	trackReplayingMutators track.Mutators
 	httpMode               HTTPMode
 	readOnly               bool
+	recordMode             RecordMode
+	failOnUnusedTracks     bool
+	pruneUnusedTracks      bool
+	secretScanner          *secretScanner
+	// modeSet indicates that a mode was selected explicitly with a Setting.
+	modeSet             bool
+	modeEnvOverSettings bool
 }
@@ -26,3 +26,10 @@ func TestW(t *testing.T) {
 	WithReadOnlyMode()(vcrSettings)
 	assert.True(t, vcrSettings.readOnly)
 }
+
+func TestWithRecordMode(t *testing.T) {
+	vcrSettings := &VCRSettings{}
+
+	WithRecordMode(RecordModeAll)(vcrSettings)
+	assert.Equal(t, RecordModeAll, vcrSettings.recordMode)
+}
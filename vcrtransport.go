@@ -2,6 +2,7 @@ package govcr
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/pkg/errors"
 
@@ -20,6 +21,16 @@ type vcrTransport struct {
 	pcb       *PrintedCircuitBoard
 	cassette  *cassette.Cassette
 	transport http.RoundTripper
+
+	// refused holds a summary of the requests that did not match a track and that could not
+	// be placed live.
+	refused      []string
+	refusedMutex sync.Mutex
+
+	// failOnUnusedTracks makes Eject fail when some tracks on the cassette are unused.
+	failOnUnusedTracks bool
+	// pruneUnusedTracks makes Eject remove the unused tracks from the cassette.
+	pruneUnusedTracks bool
 }
 
 // RoundTrip is an implementation of http.RoundTripper.
@@ -31,8 +42,11 @@ func (t *vcrTransport) RoundTrip(httpRequest *http.Request) (*http.Response, err
 
 	httpRequestClone := track.CloneHTTPRequest(httpRequest)
 
+	// the request that the tracks are matched against is prepared once for all the searches.
+	request := t.pcb.requestToMatch(httpRequestClone)
+
 	// search for a matching track on cassette if liveOnly mode is not selected
-	trk, err := t.pcb.SeekTrack(t.cassette, httpRequestClone)
+	trk, err := t.pcb.seekTrack(t.cassette, request, httpRequestClone)
 	if err != nil {
 		return nil, errors.Wrap(err, "govcr failed to read matching track from cassette")
 	}
@@ -47,18 +61,52 @@ func (t *vcrTransport) RoundTrip(httpRequest *http.Request) (*http.Response, err
 	}
 
 	if t.pcb.httpMode == HTTPModeOffline {
-		return nil, errors.New("no track matched on cassette and offline mode is active")
+		t.refuse(httpRequestClone)
+
+		return nil, errors.WithStack(
+			t.pcb.explainNoTrackMatch(t.cassette, request, "no track matched on cassette and offline mode is active"),
+		)
+	}
+
+	if !t.pcb.canGoLive(t.cassette) {
+		t.refuse(httpRequestClone)
+
+		return nil, errors.WithStack(
+			t.pcb.explainNoTrackMatch(t.cassette, request, "no track matched on cassette and the record mode does not permit live requests"),
+		)
 	}
 
 	httpResponse, reqErr := t.transport.RoundTrip(httpRequest)
-	if !t.pcb.readOnly {
+	if t.pcb.canRecord(t.cassette) {
 		trkResponse := track.ToResponse(httpResponse)
 		trkRequest := track.ToRequest(httpRequestClone)
+
+		// in RecordModeAll, a matching track is re-recorded in place.
+		// This must be determined before the recording mutators alter the request.
+		trackNumber, replace := int32(0), false
+		if t.pcb.recordMode == RecordModeAll {
+			trackNumber, replace = t.pcb.seekTrackNumber(t.cassette, request)
+		}
+
 		newTrack := track.NewTrack(trkRequest, trkResponse, reqErr)
 
 		t.pcb.mutateTrackRecording(newTrack)
 
-		if err = cassette.AddTrackToCassette(t.cassette, newTrack); err != nil {
+		if err = t.pcb.secretScanner.scan(newTrack); err != nil {
+			if httpResponse != nil {
+				_ = httpResponse.Body.Close()
+			}
+
+			return nil, err
+		}
+
+		if replace {
+			err = cassette.ReplaceTrackOnCassette(t.cassette, trackNumber, newTrack)
+		} else {
+			err = cassette.AddTrackToCassette(t.cassette, newTrack)
+		}
+
+		if err != nil {
 			return nil, errors.Wrap(err, "govcr failed to add track to cassette")
 		}
 	}
@@ -66,19 +114,116 @@ func (t *vcrTransport) RoundTrip(httpRequest *http.Request) (*http.Response, err
 	return httpResponse, errors.WithStack(reqErr)
 }
 
+func (t *vcrTransport) refuse(httpRequest *http.Request) {
+	t.refusedMutex.Lock()
+	defer t.refusedMutex.Unlock()
+
+	t.refused = append(t.refused, httpRequest.Method+" "+httpRequest.URL.String())
+}
+
+// refusedRequests returns a summary of the requests that did not match a track and that
+// could not be placed live.
+func (t *vcrTransport) refusedRequests() []string {
+	t.refusedMutex.Lock()
+	defer t.refusedMutex.Unlock()
+
+	return append([]string(nil), t.refused...)
+}
+
+// UnusedTracks returns the tracks on the cassette that have neither been replayed nor recorded.
+func (t *vcrTransport) UnusedTracks() []UnusedTrack {
+	var unused []UnusedTrack
+
+	for i := range t.cassette.NumberOfTracks() {
+		trk := t.cassette.Track(i)
+		if trk.IsReplayed() {
+			continue
+		}
+
+		req := trk.Request.Method
+		if trk.Request.URL != nil {
+			req += " " + trk.Request.URL.String()
+		}
+
+		unused = append(unused, UnusedTrack{
+			TrackNumber: i,
+			UUID:        trk.UUID,
+			Request:     req,
+		})
+	}
+
+	return unused
+}
+
 // NumberOfTracks returns the number of tracks contained in the cassette.
 func (t *vcrTransport) NumberOfTracks() int32 {
 	return t.cassette.NumberOfTracks()
 }
 
+// Flush persists the tracks that have been recorded but not saved yet.
+func (t *vcrTransport) Flush() error {
+	return t.cassette.Flush()
+}
+
+// Eject flushes the cassette and stops its background persistence, if any.
+// With pruneUnusedTracks, it removes the unused tracks from the cassette, provided that
+// recording was permitted and no request was refused (see canPrune). Otherwise, with failOnUnusedTracks, it fails when some tracks on the cassette are unused.
+func (t *vcrTransport) Eject() error {
+	return t.eject(true)
+}
+
+// eject implements Eject. The unused tracks are only pruned when prune is true, which
+// permits to preserve the cassette after an unsuccessful test.
+// Unused tracks are disregarded in live only mode since no track is replayed.
+func (t *vcrTransport) eject(prune bool) error {
+	if err := t.cassette.Eject(); err != nil {
+		return err
+	}
+
+	if t.pcb.httpMode == HTTPModeLiveOnly {
+		return nil
+	}
+
+	unused := t.UnusedTracks()
+	if len(unused) == 0 {
+		return nil
+	}
+
+	if prune && t.pruneUnusedTracks && t.canPrune() {
+		_, err := t.cassette.PruneUnusedTracks()
+		return errors.Wrap(err, "govcr failed to prune unused tracks from cassette")
+	}
+
+	if !t.failOnUnusedTracks {
+		return nil
+	}
+
+	unusedErr := &govcrerr.ErrUnusedTracks{
+		CassetteName: t.cassette.Name(),
+	}
+
+	for _, trk := range unused {
+		unusedErr.Tracks = append(unusedErr.Tracks, trk.String())
+	}
+
+	return errors.WithStack(unusedErr)
+}
+
+// canPrune returns true when the session recorded the requests that did not match a track:
+// recording was permitted and no request was refused. Otherwise, the unused tracks may
+// be needed by the requests that were not placed and they are kept.
+func (t *vcrTransport) canPrune() bool {
+	return t.pcb.httpMode != HTTPModeOffline && t.pcb.canRecord(t.cassette) && len(t.refusedRequests()) == 0
+}
+
 // SetRequestMatchers sets a new collection of RequestMatcher's to the VCR.
-func (t *vcrTransport) SetRequestMatchers(reqMatchers ...RequestMatcher) {
-	t.pcb.SetRequestMatchers(reqMatchers...)
+func (t *vcrTransport) SetRequestMatchers(reqMatchers ...NamedRequestMatcher) {
+	t.pcb.SetRequestMatchersNamed(reqMatchers...)
 }
 
 // AddRequestMatchers sets a new collection of RequestMatcher's to the VCR.
-func (t *vcrTransport) AddRequestMatchers(reqMatchers ...RequestMatcher) {
-	t.pcb.AddRequestMatchers(reqMatchers...)
+func (t *vcrTransport) AddRequestMatchers(reqMatchers ...NamedRequestMatcher) {
+	t.pcb.AddRequestMatchersNamed(reqMatchers...)
 }
 
 // SetReadOnlyMode sets the VCR to read-only mode (true) or to normal read-write (false).
@@ -101,25 +246,25 @@ func (t *vcrTransport) SetLiveOnlyMode() {
 	t.pcb.SetLiveOnlyMode()
 }
 
+// SetRecordMode sets the VCR recording policy for the cassette.
+func (t *vcrTransport) SetRecordMode(recordMode RecordMode) {
+	t.pcb.SetRecordMode(recordMode)
+}
+
 // SetCipher sets the cassette Cipher.
 // This can be used to set a cipher when none is present (which already happens automatically
 // when loading a cassette) or change the cipher when one is already present.
 // The cassette is automatically saved with the new selected cipher.
-func (t *vcrTransport) SetCipher(crypter CrypterProvider, keyFile string) error {
-	f := func(key []byte, _ encryption.NonceGenerator) (*encryption.Crypter, error) {
-		// a "CrypterProvider" is a CrypterNonceProvider with a pre-defined / default nonceGenerator
-		return crypter(key)
-	}
-
-	return t.SetCipherCustomNonce(f, keyFile, nil)
+func (t *vcrTransport) SetCipher(crypter CrypterProvider, keyProvider encryption.KeyProvider) error {
+	return t.SetCipherCustomNonce(toCrypterNonceProvider(crypter), keyProvider, nil)
 }
 
 // SetCipherCustomNonce sets the cassette Cipher.
 // This can be used to set a cipher when none is present (which already happens automatically
 // when loading a cassette) or change the cipher when one is already present.
 // The cassette is automatically saved with the new selected cipher.
-func (t *vcrTransport) SetCipherCustomNonce(crypter CrypterNonceProvider, keyFile string, nonceGenerator encryption.NonceGenerator) error {
-	cr, err := makeCrypter(crypter, keyFile, nonceGenerator)
+func (t *vcrTransport) SetCipherCustomNonce(crypter CrypterNonceProvider, keyProvider encryption.KeyProvider, nonceGenerator encryption.NonceGenerator) error {
+	cr, err := makeCrypter(crypter, keyProvider, nonceGenerator)
 	if err != nil {
 		return err
 	}
@@ -161,5 +306,10 @@ func (t *vcrTransport) ClearReplayingMutators() {
 }
 
 func (t *vcrTransport) stats() *stats.Stats {
-	return t.cassette.Stats()
+	s := t.cassette.Stats()
+	if s != nil {
+		s.Mode = t.pcb.mode()
+	}
+
+	return s
 }